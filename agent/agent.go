@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/ovrclk/authority/api"
+	"github.com/ovrclk/authority/authority"
+	"github.com/ovrclk/authority/util"
+)
+
+// Agent keeps the certificates listed in its Config current on the host it
+// runs on. Whenever the stored certificate differs from the one on disk the
+// files are rewritten and the certificate's reload command is run. The agent
+// never signs: certificates are renewed where the CA keys may be used, with
+// Client.RenewExpiring, so the API client's credentials only need to read
+// the certificates and their keys.
+type Agent struct {
+	API    *api.Client
+	Config *Config
+	Logger *log.Logger
+
+	failures map[string]int
+	reloads  map[string]bool
+}
+
+// New returns an Agent for the provided API client and configuration, which
+// is validated. A nil logger logs to standard error.
+func New(client *api.Client, cfg *Config, logger *log.Logger) (*Agent, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	return &Agent{
+		API:      client,
+		Config:   cfg,
+		Logger:   logger,
+		failures: map[string]int{},
+		reloads:  map[string]bool{},
+	}, nil
+}
+
+// RunOnce checks every certificate once, returning the errors of those whose
+// check failed.
+func (a *Agent) RunOnce() error {
+	var result error
+	for _, cert := range a.Config.Certificates {
+		if _, err := a.Check(cert); err != nil {
+			result = multierror.Append(result, fmt.Errorf("%s: %v", cert.Name, err))
+		}
+	}
+	return result
+}
+
+// Run checks every certificate each Interval until stop is closed. A
+// certificate whose check fails is retried after RetryInterval, doubling the
+// delay with every further failure, up to Interval.
+func (a *Agent) Run(stop <-chan struct{}) {
+	due := map[string]time.Time{}
+	for {
+		now := time.Now()
+		next := now.Add(a.Config.interval)
+		for _, cert := range a.Config.Certificates {
+			if now.Before(due[cert.Name]) {
+				if due[cert.Name].Before(next) {
+					next = due[cert.Name]
+				}
+				continue
+			}
+
+			if _, err := a.Check(cert); err != nil {
+				a.failures[cert.Name]++
+				delay := a.backoff(a.failures[cert.Name])
+				a.Logger.Printf("%s: %v, retrying in %s", cert.Name, err, delay)
+				due[cert.Name] = now.Add(delay)
+			} else {
+				a.failures[cert.Name] = 0
+				due[cert.Name] = now.Add(a.Config.interval)
+			}
+			if due[cert.Name].Before(next) {
+				next = due[cert.Name]
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(next.Sub(time.Now())):
+		}
+	}
+}
+
+// Check writes the provided certificate's files if they do not hold the
+// stored certificate, running its reload command afterwards. A reload
+// command which failed is run again on the next check. A stored certificate
+// expiring within its warning window is logged, as it should have been
+// renewed by then. It returns whether the files were written.
+func (a *Agent) Check(cert *Certificate) (bool, error) {
+	current, err := a.API.GetCertificate(cert.Name)
+	if err != nil {
+		return false, err
+	}
+	if current.NotAfter.Sub(time.Now()) < api.RenewalWindow(current, cert.warnBefore) {
+		a.Logger.Printf("%s: expires %s and has not been renewed", cert.Name, current.NotAfter.Format(time.RFC3339))
+	}
+
+	var stored *api.Certificate
+	if cert.isWritten(current) {
+		return false, a.reload(cert)
+	}
+	if cert.KeyPath != "" {
+		if stored, err = a.API.Get(cert.Name); err != nil {
+			return false, err
+		}
+		current = stored.Certificate
+	}
+	if err := cert.write(current, stored); err != nil {
+		return false, err
+	}
+	a.Logger.Printf("%s: wrote %s", cert.Name, cert.CertPath)
+
+	a.reloads[cert.Name] = true
+	return true, a.reload(cert)
+}
+
+// reload runs the certificate's reload command if its files were written
+// since the command last succeeded.
+func (a *Agent) reload(cert *Certificate) error {
+	if !a.reloads[cert.Name] || len(cert.Reload) == 0 {
+		return nil
+	}
+	out, err := exec.Command(cert.Reload[0], cert.Reload[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("authority: reload command %q failed: %v: %s", strings.Join(cert.Reload, " "), err, bytes.TrimSpace(out))
+	}
+	delete(a.reloads, cert.Name)
+	return nil
+}
+
+func (a *Agent) backoff(failures int) time.Duration {
+	delay := a.Config.retryInterval
+	for i := 1; i < failures && delay < a.Config.interval; i++ {
+		delay *= 2
+	}
+	if delay > a.Config.interval {
+		delay = a.Config.interval
+	}
+	return delay
+}
+
+// isWritten returns whether the certificate file holds the provided
+// certificate and the key file, if any, exists.
+func (c *Certificate) isWritten(cert *x509.Certificate) bool {
+	data, err := ioutil.ReadFile(c.CertPath)
+	if err != nil || !bytes.Equal(data, util.GetPEMBytesFromCertificate(cert)) {
+		return false
+	}
+	if c.KeyPath != "" {
+		if _, err := os.Stat(c.KeyPath); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// write writes the key before the certificate, so that a certificate on disk
+// is never paired with an older key.
+func (c *Certificate) write(cert *x509.Certificate, stored *api.Certificate) error {
+	if c.KeyPath != "" {
+		if stored.PrivateKey == nil {
+			return authority.ErrKeyNotExportable
+		}
+		if err := util.WriteFileAtomic(c.KeyPath, util.GetPEMBytesFromKey(stored.PrivateKey), c.keyMode, -1, -1); err != nil {
+			return err
+		}
+	}
+	return util.WriteFileAtomic(c.CertPath, util.GetPEMBytesFromCertificate(cert), c.certMode, -1, -1)
+}
@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ovrclk/authority/api"
+	"github.com/ovrclk/authority/config"
+	"github.com/ovrclk/authority/util"
+)
+
+func testClient(t *testing.T) *api.Client {
+	dir, err := ioutil.TempDir("", "authority")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	client, err := api.NewLocalClientWithConfig(dir, &config.Config{
+		Defaults: config.DefaultsConfig{
+			RootDomain: "ovrclk.com",
+			Org:        "Ovrclk",
+			Country:    "USA",
+			CrlDays:    "365",
+			Digest:     "sha256",
+			CertExpiry: "365",
+		},
+		Roles: map[string]config.RoleConfig{
+			"short": config.RoleConfig{TTL: "5m"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("error initializing client %v", err)
+	}
+	if _, err := client.CreateCA(&api.Options{}); err != nil {
+		t.Fatalf("error creating ca: %v", err)
+	}
+	return client
+}
+
+func TestAgentCheck(t *testing.T) {
+	client := testClient(t)
+	if _, _, err := client.Generate("web"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "authority-agent")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	marker := filepath.Join(dir, "reloaded")
+
+	configPath := filepath.Join(dir, "agent.toml")
+	err = ioutil.WriteFile(configPath, []byte(`
+interval = "1h"
+
+[[certificate]]
+name = "web"
+cert_path = "`+filepath.Join(dir, "web.crt")+`"
+key_path = "`+filepath.Join(dir, "web.key")+`"
+reload = ["touch", "`+marker+`"]
+`), 0644)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	a, err := New(client, cfg, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	cert := cfg.Certificates[0]
+
+	written, err := a.Check(cert)
+	if err != nil || !written {
+		t.Fatalf("expected files written, got %v, %v", written, err)
+	}
+	for path, mode := range map[string]os.FileMode{cert.CertPath: 0644, cert.KeyPath: 0600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Fatalf("expected %s with mode %o, got %o", path, mode, info.Mode().Perm())
+		}
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatal("expected reload command to run")
+	}
+	os.Remove(marker)
+
+	if written, err := a.Check(cert); err != nil || written {
+		t.Fatalf("expected nothing written for a current certificate, got %v, %v", written, err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("expected reload command not to run")
+	}
+
+	// a certificate expiring within its warning window is logged, not renewed
+	short, _, err := client.GenerateFromOptions("short", &api.Options{Role: "short"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var logged bytes.Buffer
+	a.Logger = log.New(&logged, "", 0)
+	cert.Name = "short"
+	if written, err := a.Check(cert); err != nil || !written {
+		t.Fatalf("expected files written, got %v, %v", written, err)
+	}
+	if !strings.Contains(logged.String(), "has not been renewed") {
+		t.Fatalf("expected a warning for the expiring certificate, got %q", logged.String())
+	}
+
+	// once renewed operator-side the agent writes the new certificate
+	renewedCerts, err := client.RenewExpiring(30*24*time.Hour, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(renewedCerts) != 1 || renewedCerts[0].Certificate.Subject.CommonName != "short" {
+		t.Fatalf("expected only short renewed, got %v", renewedCerts)
+	}
+	if written, err := a.Check(cert); err != nil || !written {
+		t.Fatalf("expected renewed files written, got %v, %v", written, err)
+	}
+	renewed, err := util.GetCertificateFromPath(cert.CertPath)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if renewed.SerialNumber.Cmp(short.Certificate.SerialNumber) == 0 {
+		t.Fatal("expected the renewed certificate on disk")
+	}
+	key, err := util.GetKeyFromPath(cert.KeyPath)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if key.PublicKey.N.Cmp(renewed.PublicKey.(*rsa.PublicKey).N) != 0 {
+		t.Fatal("expected the renewed key on disk")
+	}
+}
+
+func TestAgentBackoff(t *testing.T) {
+	cfg := &Config{
+		Interval:      "10m",
+		RetryInterval: "1m",
+		Certificates:  []*Certificate{&Certificate{Name: "web", CertPath: "web.crt"}},
+	}
+	a, err := New(nil, cfg, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for failures, expected := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 4: 8 * time.Minute, 5: 10 * time.Minute} {
+		if delay := a.backoff(failures); delay != expected {
+			t.Fatalf("expected %v after %d failures, got %v", expected, failures, delay)
+		}
+	}
+
+	cfg.Certificates[0].CertPath = ""
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected error for a certificate without cert_path")
+	}
+}
@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/ovrclk/authority/config"
+)
+
+// Defaults used for settings left out of the configuration file.
+const (
+	DefaultInterval      = "1h"
+	DefaultWarnBefore    = "7d"
+	DefaultRetryInterval = "1m"
+	DefaultCertMode      = "0644"
+	DefaultKeyMode       = "0600"
+)
+
+// Config is the agent's configuration file, in TOML.
+type Config struct {
+	// Interval is how often every certificate is checked, such as "1h".
+	Interval string `toml:"interval"`
+
+	// WarnBefore logs stored certificates still expiring within this
+	// window, such as "7d", as their renewal is overdue, unless a
+	// certificate sets its own. The window is at most two thirds of a
+	// certificate's lifetime.
+	WarnBefore string `toml:"warn_before"`
+
+	// RetryInterval is the delay before retrying a certificate whose check
+	// failed. It doubles with every further failure, up to Interval.
+	RetryInterval string `toml:"retry_interval"`
+
+	Certificates []*Certificate `toml:"certificate"`
+
+	interval      time.Duration
+	retryInterval time.Duration
+}
+
+// Certificate configures one certificate kept on the host.
+type Certificate struct {
+	// Name is the certificate's common name in the store.
+	Name string `toml:"name"`
+
+	// CertPath and KeyPath are where the PEM encoded certificate and private
+	// key are written. The key is not written if KeyPath is empty.
+	CertPath string `toml:"cert_path"`
+	KeyPath  string `toml:"key_path"`
+
+	// CertMode and KeyMode are the octal permissions of the written files.
+	CertMode string `toml:"cert_mode"`
+	KeyMode  string `toml:"key_mode"`
+
+	// WarnBefore overrides the agent's warning window for this certificate.
+	WarnBefore string `toml:"warn_before"`
+
+	// Reload is run after new files are written, such as
+	// ["systemctl", "reload", "nginx"].
+	Reload []string `toml:"reload"`
+
+	warnBefore time.Duration
+	certMode   os.FileMode
+	keyMode    os.FileMode
+}
+
+// LoadConfig reads and validates the agent configuration file at the provided
+// path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("authority: error reading agent config (%s): %v", path, err)
+	}
+
+	cfg := &Config{}
+	if _, err := toml.Decode(string(data), cfg); err != nil {
+		return nil, fmt.Errorf("authority: invalid agent config (%s): %v", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the configuration and fills in defaults.
+func (c *Config) Validate() error {
+	var err error
+	if c.interval, err = parseDuration("interval", c.Interval, DefaultInterval); err != nil {
+		return err
+	}
+	if c.retryInterval, err = parseDuration("retry_interval", c.RetryInterval, DefaultRetryInterval); err != nil {
+		return err
+	}
+	warnBefore, err := parseDuration("warn_before", c.WarnBefore, DefaultWarnBefore)
+	if err != nil {
+		return err
+	}
+
+	if len(c.Certificates) == 0 {
+		return fmt.Errorf("authority: agent config lists no certificates")
+	}
+	seen := map[string]bool{}
+	for _, cert := range c.Certificates {
+		if cert.Name == "" {
+			return fmt.Errorf("authority: agent config has a certificate without a name")
+		}
+		if seen[cert.Name] {
+			return fmt.Errorf("authority: certificate %s is listed twice in the agent config", cert.Name)
+		}
+		seen[cert.Name] = true
+
+		if cert.CertPath == "" {
+			return fmt.Errorf("authority: certificate %s has no cert_path", cert.Name)
+		}
+		if cert.warnBefore, err = parseDuration(cert.Name+" warn_before", cert.WarnBefore, ""); err != nil {
+			return err
+		}
+		if cert.warnBefore == 0 {
+			cert.warnBefore = warnBefore
+		}
+		if cert.certMode, err = parseMode(cert.Name+" cert_mode", cert.CertMode, DefaultCertMode); err != nil {
+			return err
+		}
+		if cert.keyMode, err = parseMode(cert.Name+" key_mode", cert.KeyMode, DefaultKeyMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseDuration(key, value, def string) (time.Duration, error) {
+	if value == "" {
+		value = def
+	}
+	if value == "" {
+		return 0, nil
+	}
+	d, err := config.ParseTTL(value)
+	if err != nil {
+		return 0, fmt.Errorf("authority: invalid %s in agent config: %v", key, err)
+	}
+	return d, nil
+}
+
+func parseMode(key, value, def string) (os.FileMode, error) {
+	if value == "" {
+		value = def
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("authority: invalid %s in agent config: %q", key, value)
+	}
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ovrclk/authority/backend"
+)
+
+// Operations recorded in the audit log.
+const (
+	OpCreateCA           = "create-ca"
+	OpImportCA           = "import-ca"
+	OpCreate             = "create"
+	OpImport             = "import"
+	OpRenew              = "renew"
+	OpReadKey            = "read-key"
+	OpRevoke             = "revoke"
+	OpHold               = "hold"
+	OpRelease            = "release"
+	OpCreateToken        = "create-token"
+	OpSetConfig          = "set-config"
+	OpLabel              = "label"
+	OpCreateRequest      = "create-request"
+	OpImportIntermediate = "import-intermediate"
+	OpSignIntermediate   = "sign-intermediate"
+	OpSignCRL            = "sign-crl"
+	OpImportCRL          = "import-crl"
+	OpRollover           = "rollover"
+)
+
+// AuditLog returns the entries of the audit log, oldest first.
+func (c *Client) AuditLog() ([]*backend.AuditEntry, error) {
+	return c.backend.ListAuditEntries()
+}
+
+// VerifyAuditLog checks the hash chain of the audit log and that it ends at
+// the recorded head, returning the number of entries verified, or an error
+// naming the first entry that was changed, removed or reordered. Keyed
+// entries are checked with the AuditKey. With an AuditKey, the last entry
+// must be keyed, as anyone with write access to the backend can recompute
+// the hashes of unkeyed entries; entries written before the key was set are
+// only chained.
+func (c *Client) VerifyAuditLog() (int, error) {
+	entries, err := c.AuditLog()
+	if err != nil {
+		return 0, err
+	}
+	prev := ""
+	keyed := false
+	for i, entry := range entries {
+		if entry.Sequence != i+1 {
+			return i, fmt.Errorf("authority: audit entry %d is out of sequence, expected %d", entry.Sequence, i+1)
+		}
+		if entry.PrevHash != prev {
+			return i, fmt.Errorf("authority: audit entry %d does not follow entry %d", entry.Sequence, i)
+		}
+		if entry.Keyed && len(c.AuditKey) == 0 {
+			return i, fmt.Errorf("authority: audit entry %d is keyed, verify it with the audit key", entry.Sequence)
+		}
+		if keyed && !entry.Keyed {
+			return i, fmt.Errorf("authority: audit entry %d is not keyed but follows keyed entries", entry.Sequence)
+		}
+		if entry.ComputeHash(c.AuditKey) != entry.Hash {
+			return i, fmt.Errorf("authority: audit entry %d has been modified", entry.Sequence)
+		}
+		keyed = entry.Keyed
+		prev = entry.Hash
+	}
+	if len(c.AuditKey) > 0 && len(entries) > 0 && !keyed {
+		return 0, fmt.Errorf("authority: audit log is not keyed, it may have been rewritten without the audit key")
+	}
+	head, err := c.backend.GetAuditHead()
+	if err != nil {
+		return len(entries), err
+	}
+	if head.Sequence != len(entries) || head.Hash != prev {
+		return len(entries), fmt.Errorf("authority: audit log ends at entry %d, but its head is entry %d", len(entries), head.Sequence)
+	}
+	return len(entries), nil
+}
+
+// auditAttempts is how many times audit chains an entry to a new head when
+// another entry was appended concurrently.
+const auditAttempts = 5
+
+// audit appends an entry for the provided operation on target to the audit
+// log, chained to its head and keyed with the AuditKey, if set. serial may be
+// nil.
+func (c *Client) audit(operation, target string, serial *big.Int) error {
+	actor, err := c.actor()
+	if err != nil {
+		return fmt.Errorf("authority: %s of %s done, but cannot be audited: %v", operation, target, err)
+	}
+	entry := &backend.AuditEntry{
+		Actor:     actor,
+		Operation: operation,
+		Target:    target,
+		Keyed:     len(c.AuditKey) > 0,
+	}
+	if serial != nil {
+		entry.Serial = serial.Text(16)
+	}
+
+	for i := 0; i < auditAttempts; i++ {
+		var head *backend.AuditHead
+		head, err = c.backend.GetAuditHead()
+		if err != nil {
+			return fmt.Errorf("authority: cannot read audit log: %v", err)
+		}
+		if head.Keyed && !entry.Keyed {
+			return fmt.Errorf("authority: %s of %s done, but cannot be audited: the audit log is keyed and no audit key is set", operation, target)
+		}
+		entry.Sequence = head.Sequence + 1
+		entry.Time = time.Now().UTC()
+		entry.PrevHash = head.Hash
+		entry.Hash = entry.ComputeHash(c.AuditKey)
+
+		if err = c.backend.AppendAuditEntry(entry); err != backend.ErrAuditConflict {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("authority: %s of %s done, but cannot be audited: %v", operation, target, err)
+	}
+	return nil
+}
+
+// auditRead appends an entry for a read of target's private key, unless the
+// backend records reads itself.
+func (c *Client) auditRead(target string, serial *big.Int) error {
+	if auditor, ok := c.backend.(backend.ReadAuditor); ok && auditor.AuditsReads() {
+		return nil
+	}
+	return c.audit(OpReadKey, target, serial)
+}
+
+// actor returns the identity the backend authenticated, if it can, or else
+// the Actor.
+func (c *Client) actor() (string, error) {
+	if identifier, ok := c.backend.(backend.Identifier); ok {
+		if c.identity == "" {
+			identity, err := identifier.Identity()
+			if err != nil {
+				return "", err
+			}
+			c.identity = identity
+		}
+		return c.identity, nil
+	}
+	if c.Actor == "" {
+		return "unknown", nil
+	}
+	return c.Actor, nil
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/ovrclk/authority/authority"
+)
+
+// Chain returns the intermediate CA certificates above the certificate with
+// the provided common name, from its issuer up to but not including the
+// root, as served alongside the certificate by TLS servers.
+func (c *Client) Chain(name string) ([]*x509.Certificate, error) {
+	cert, err := c.GetCertificate(name)
+	if err != nil {
+		return nil, err
+	}
+	cas, err := authority.LoadCAs(c.backend)
+	if err != nil {
+		return nil, err
+	}
+	return authority.Chain(cert, cas)
+}
+
+// checkHierarchy returns an error unless the stored CA named parent belongs
+// to the selected root's hierarchy. Certificates take their serial numbers
+// from the selected root's sequence, so signing them with a CA of another
+// hierarchy could repeat serial numbers under that CA.
+func (c *Client) checkHierarchy(parent string) error {
+	if parent == c.caName() {
+		return nil
+	}
+	cas, err := authority.LoadCAs(c.backend)
+	if err != nil {
+		return err
+	}
+	ca, ok := cas[parent]
+	if !ok {
+		return fmt.Errorf("authority: %s is not a stored CA", parent)
+	}
+	root := authority.RootOf(ca, cas)
+	for name, cert := range cas {
+		if root != nil && cert.Equal(root) && rolloverBase(name) == c.caName() {
+			return nil
+		}
+	}
+	return fmt.Errorf("authority: %s is not in the %s hierarchy, select its root with --ca", parent, c.caName())
+}
+
+// rolloverBase returns the name of the CA the provided name is kept
+// alongside during a rollover, or the name itself.
+func rolloverBase(name string) string {
+	for _, suffix := range []string{authority.NextSuffix, authority.PreviousSuffix} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return name
+}
@@ -1,12 +1,14 @@
 package api
 
 import (
+	"crypto"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/ovrclk/authority/authority"
 	"github.com/ovrclk/authority/backend"
@@ -20,6 +22,65 @@ type Certificate struct {
 	Certificate *x509.Certificate
 	PrivateKey  *rsa.PrivateKey
 	CRL         *pkix.CertificateList
+
+	// KeyIsHeld indicates that the private key is held by the backend, in
+	// which case PrivateKey is nil and the key cannot be exported.
+	KeyIsHeld bool
+
+	// PublicOnly indicates that only the certificate is stored, such as for
+	// a root whose private key is kept offline or a certificate issued for
+	// a provided public key.
+	PublicOnly bool
+
+	// Metadata records who owns the certificate and why it exists.
+	Metadata *backend.Metadata
+}
+
+// Options holds the optional settings used when generating a certificate.
+type Options struct {
+	// Parent is the name of the signing certificate. An empty string will
+	// sign the certificate with the root certificate.
+	Parent string
+
+	// DNSNames and IPAddresses are added as Subject Alt Names.
+	DNSNames    []string
+	IPAddresses []net.IP
+
+	// Subject overrides the subject fields taken from the configuration
+	// defaults.
+	Subject authority.Subject
+
+	// Role names an issuance template from the configuration. The role's
+	// parent, profile, key and TTL are used, its default SANs are applied
+	// when none are provided, and the certificate's names must match its
+	// allowed name patterns.
+	Role string
+
+	// Token controls the backend access token created for the certificate.
+	Token backend.TokenOptions
+
+	// KeyInBackend generates the private key inside the backend, such as
+	// Vault's transit backend, so that it never leaves the backend.
+	KeyInBackend bool
+
+	// PublicKey is certified instead of generating a key, for keys kept in
+	// a device or provisioned elsewhere, and only the certificate is
+	// stored. It may be an RSA, ECDSA or Ed25519 key. PrivateKey is
+	// certified and stored instead of generating a key. At most one of
+	// PublicKey, PrivateKey and KeyInBackend may be set.
+	PublicKey  crypto.PublicKey
+	PrivateKey *rsa.PrivateKey
+
+	// Labels are stored in the certificate's metadata record, keyed as
+	// accepted by backend.Metadata.Set.
+	Labels map[string]string
+
+	// CreatedBy records who created the certificate in its metadata.
+	CreatedBy string
+
+	profile string
+	keyBits int
+	ttl     time.Duration
 }
 
 // Client provides an API for creating, storing, retrieving and revoking x509
@@ -29,8 +90,20 @@ type Client struct {
 	Server string
 	Token  string
 
-	backend backend.Backend
-	config  *config.Config
+	// Actor names who performs operations, as recorded in the audit log, for
+	// backends which cannot identify their callers themselves.
+	Actor string
+
+	// AuditKey keys the hashes of new audit log entries and verifies keyed
+	// entries. It must be kept outside the backend.
+	AuditKey []byte
+
+	backend       backend.Backend
+	config        *config.Config
+	signers       authority.Signers
+	signerConfigs authority.SignerConfigs
+	ca            string
+	identity      string
 }
 
 // Create a new Client for local filesystem API operations given the provided path.
@@ -88,6 +161,38 @@ func newClientWithConfig(backendType, server, token, path string, config *config
 	return c, err
 }
 
+// SetSigner makes the provided in-process signer sign on behalf of the CA
+// with the provided name, instead of a private key stored in the backend.
+// Creating that CA will use the signer's public key.
+func (c *Client) SetSigner(name string, signer crypto.Signer) {
+	if c.signers == nil {
+		c.signers = authority.Signers{}
+	}
+	c.signers[name] = signer
+}
+
+// SetSignerConfig opens the signer configured by cfg, on first use, to sign
+// on behalf of the CA with the provided name. The configuration must come
+// from client-local settings, as opening the signer runs its command or
+// module.
+func (c *Client) SetSignerConfig(name string, cfg config.SignerConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("authority: signer %s: %v", name, err)
+	}
+	if c.signerConfigs == nil {
+		c.signerConfigs = authority.SignerConfigs{}
+	}
+	c.signerConfigs[name] = cfg
+	return nil
+}
+
+// UseCA selects the root CA whose hierarchy subsequent operations work in.
+// An empty name selects the default root, "ca". Each root CA has its own
+// serial numbers, CRL and configuration section.
+func (c *Client) UseCA(name string) {
+	c.ca = name
+}
+
 // Retrieve stored configuration information from the backend.
 func (c *Client) GetConfig() (*config.Config, error) {
 	cfg, err := c.backend.GetConfig()
@@ -107,7 +212,7 @@ func (c *Client) SetCertificate(name string, cert *x509.Certificate, key *rsa.Pr
 	if err = c.backend.PutPrivateKey(name, key); err != nil {
 		return err
 	}
-	return nil
+	return c.audit(OpImport, name, cert.SerialNumber)
 }
 
 // Store authority configuration information in the backend.
@@ -120,7 +225,7 @@ func (c *Client) SetConfig(config *config.Config) error {
 	if err = c.backend.PutConfig(conf); err != nil {
 		return fmt.Errorf("authority: cannot store configuration: %v", err)
 	}
-	return nil
+	return c.audit(OpSetConfig, "config", nil)
 }
 
 // Generate creates and returns a certificate for the provided common name.
@@ -161,6 +266,20 @@ func (c *Client) GenerateWithParent(name string, parent string) (*Certificate, s
 // If dnsNames or ipAddresses are provided and non-empty, the certificate will
 // created with corresponding Subject Alt Names.
 func (c *Client) GenerateWithOptions(name string, parent string, dnsNames []string, ipAddresses []net.IP) (*Certificate, string, error) {
+	return c.GenerateFromOptions(name, &Options{
+		Parent:      parent,
+		DNSNames:    dnsNames,
+		IPAddresses: ipAddresses,
+	})
+}
+
+// GenerateFromOptions creates and returns a certificate for the provided
+// common name, using the provided Options. It will also generate and return a
+// backend access token with granular permissions to access the certificate.
+//
+// If there is already an existing certificate with the same name,
+// GenerateFromOptions will return that certificate, as well as an error.
+func (c *Client) GenerateFromOptions(name string, opts *Options) (*Certificate, string, error) {
 	var err error
 	var token string
 	var clientCert *Certificate
@@ -169,90 +288,263 @@ func (c *Client) GenerateWithOptions(name string, parent string, dnsNames []stri
 		return nil, "", fmt.Errorf("authority: %s is a restricted name", name)
 	}
 
-	cert := &authority.Cert{
-		CommonName:  name,
-		DNSNames:    dnsNames,
-		IPAddresses: ipAddresses,
-		Backend:     c.backend,
-		Config:      c.config,
+	if opts == nil {
+		opts = &Options{}
 	}
 
-	if parent == "" {
-		cert.ParentName = "ca"
+	if opts.Role != "" {
+		if opts, err = c.applyRole(name, opts); err != nil {
+			return nil, "", err
+		}
+	}
+
+	cert := c.cert(name)
+	cert.DNSNames = opts.DNSNames
+	cert.IPAddresses = opts.IPAddresses
+	cert.Subject = opts.Subject
+	cert.Profile = opts.profile
+	cert.KeyBits = opts.keyBits
+	cert.TTL = opts.ttl
+	cert.KeyInBackend = opts.KeyInBackend
+	cert.PublicKey = opts.PublicKey
+	cert.Key = opts.PrivateKey
+
+	if opts.Parent == "" {
+		cert.ParentName = cert.GetCAName()
 	} else {
-		cert.ParentName = parent
+		cert.ParentName = opts.Parent
+	}
+
+	if err = c.checkHierarchy(cert.ParentName); err != nil {
+		return nil, "", err
+	}
+	if parent := c.cert(cert.ParentName); parent.Exists() {
+		if _, err = parent.CompleteRollover(); err != nil {
+			return nil, "", err
+		}
 	}
 
 	if cert.Exists() {
-		clientCert, err = c.Get(name)
+		clientCert, err = c.get(name)
 		if err != nil {
-			return nil, "", fmt.Errorf("authority: certificate %s already exists, but unable to retrieve %v", err)
+			return nil, "", fmt.Errorf("authority: certificate %s already exists, but unable to retrieve %v", name, err)
 		}
 		return clientCert, "", authority.ErrCertAlreadyExists
 	}
 
+	meta, err := newMetadata(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
 	if err = cert.Create(); err != nil {
 		return clientCert, token, err
 	}
 
-	token, err = c.backend.CreateTokenForCertificate(name)
+	if err = c.backend.PutMetadata(cert.GetName(), meta); err != nil {
+		return clientCert, token, fmt.Errorf("authority: unable to store certificate metadata %v", err)
+	}
+	if err = c.audit(OpCreate, cert.GetName(), cert.GetCertificate().SerialNumber); err != nil {
+		return clientCert, token, err
+	}
+
+	token, err = c.backend.CreateTokenForCertificate(name, &opts.Token)
 	if err != nil {
 		return clientCert, token, fmt.Errorf("authority: unable to generate certificate token %v", err)
 	}
 
-	clientCert, err = c.Get(name)
+	clientCert, err = c.get(name)
 	return clientCert, token, err
 }
 
-// Get retrieves a previously generated x509 certificate.
+// applyRole returns a copy of the provided Options with the named role's
+// settings applied, or an error if the request is not allowed by the role.
+func (c *Client) applyRole(name string, opts *Options) (*Options, error) {
+	if c.config == nil {
+		return nil, authority.ErrConfigMissing
+	}
+
+	role, err := c.config.ForCA(c.caName()).GetRole(opts.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := *opts
+	applied.profile = role.Profile
+	applied.keyBits = role.KeyBits
+
+	if role.TTL != "" {
+		if applied.ttl, err = config.ParseTTL(role.TTL); err != nil {
+			return nil, err
+		}
+	}
+
+	parent := role.Parent
+	if parent == "" {
+		parent = c.cert(name).GetCAName()
+	}
+	if opts.Parent != "" && opts.Parent != parent {
+		return nil, fmt.Errorf("authority: role %s must be signed by %s", opts.Role, parent)
+	}
+	applied.Parent = parent
+
+	if len(applied.DNSNames) == 0 && len(applied.IPAddresses) == 0 {
+		applied.DNSNames = role.DNSNames
+		for _, ip := range role.IPAddresses {
+			applied.IPAddresses = append(applied.IPAddresses, net.ParseIP(ip))
+		}
+	}
+
+	for _, n := range append([]string{name}, applied.DNSNames...) {
+		if !role.NameIsAllowed(n) {
+			return nil, fmt.Errorf("authority: name %s is not allowed by role %s", n, opts.Role)
+		}
+	}
+	for _, ip := range applied.IPAddresses {
+		if !role.IPIsAllowed(ip) {
+			return nil, fmt.Errorf("authority: ip address %s is not allowed by role %s", ip, opts.Role)
+		}
+	}
+
+	if !role.AllowSubject && !applied.Subject.IsEmpty() {
+		return nil, fmt.Errorf("authority: role %s does not allow overriding the subject", opts.Role)
+	}
+	if email := applied.Subject.EmailAddress; email != "" {
+		if at := strings.LastIndex(email, "@"); at < 0 || !role.NameIsAllowed(email[at+1:]) {
+			return nil, fmt.Errorf("authority: email address %s is not allowed by role %s", email, opts.Role)
+		}
+	}
+
+	return &applied, nil
+}
+
+// Get retrieves a previously generated x509 certificate and its private
+// key. Reading a private key is recorded in the audit log.
 func (c *Client) Get(name string) (*Certificate, error) {
-	cert := &authority.Cert{
-		CommonName: name,
-		Backend:    c.backend,
-		Config:     c.config,
+	cert, err := c.get(name)
+	if err != nil {
+		return nil, err
+	}
+	if cert.PrivateKey != nil {
+		if err := c.auditRead(cert.CommonName, cert.Certificate.SerialNumber); err != nil {
+			return nil, err
+		}
 	}
+	return cert, nil
+}
+
+// GetCertificate retrieves a previously generated x509 certificate without
+// its private key.
+func (c *Client) GetCertificate(name string) (*x509.Certificate, error) {
+	cert := c.cert(name)
+	if !cert.Exists() {
+		return nil, authority.ErrCertNotFound
+	}
+	return cert.GetCertificate(), nil
+}
+
+func (c *Client) get(name string) (*Certificate, error) {
+	cert := c.cert(name)
 
 	if !cert.Exists() {
 		return nil, authority.ErrCertNotFound
 	}
 
+	meta, err := c.backend.GetMetadata(cert.GetName())
+	if err != nil {
+		return nil, err
+	}
+
 	return &Certificate{
 		CommonName:  cert.CommonName,
 		Certificate: cert.GetCertificate(),
 		PrivateKey:  cert.GetPrivateKey(),
+		KeyIsHeld:   cert.KeyIsHeld(),
+		PublicOnly:  cert.IsPublicOnly(),
+		Metadata:    meta,
 	}, nil
 }
 
-// Revoke adds the certificate with the provided common name to the signing
+// Revoke adds the certificate with the provided common name to its issuing
 // certificate's certificate revocation list, assuming that the indicated
 // certificate exists.
 func (c *Client) Revoke(name string) error {
-	ca, err := authority.GetCA(c.backend, c.config)
+	_, err := c.RevokeWithOptions(name, nil)
+	return err
+}
+
+// CreateToken creates a new backend access token with granular permissions to
+// access the certificate with the provided common name.
+func (c *Client) CreateToken(name string, opts *backend.TokenOptions) (string, error) {
+	if !c.backend.CheckCertificateExists(name) {
+		return "", authority.ErrCertNotFound
+	}
+	token, err := c.backend.CreateTokenForCertificate(name, opts)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("authority: unable to generate certificate token %v", err)
 	}
+	return token, c.audit(OpCreateToken, name, nil)
+}
 
-	cert := &authority.Cert{
-		CommonName: name,
-		Backend:    c.backend,
-		Config:     c.config,
+// ListTokens returns the backend access tokens created for the certificate
+// with the provided common name.
+func (c *Client) ListTokens(name string) ([]backend.TokenInfo, error) {
+	if !c.backend.CheckCertificateExists(name) {
+		return nil, authority.ErrCertNotFound
 	}
+	return c.backend.ListTokensForCertificate(name)
+}
 
-	if !cert.Exists() {
-		return authority.ErrCertNotFound
+// CreateCA creates the selected root certificate using the provided Options,
+// if it does not already exist, and returns it. Only the subject, key and TTL
+// settings of the Options apply to the root certificate.
+func (c *Client) CreateCA(opts *Options) (*Certificate, error) {
+	if opts == nil {
+		opts = &Options{}
 	}
 
-	err = ca.Revoke(cert.GetCertificate())
-	if err != nil {
-		return fmt.Errorf("authority: unable to revoke certificate %v", err)
+	cert := c.cert(c.caName())
+	cert.Subject = opts.Subject
+	cert.KeyInBackend = opts.KeyInBackend
+	cert.PublicKey = opts.PublicKey
+	cert.Key = opts.PrivateKey
+
+	if cert.GetName() != authority.DefaultCA && !nameIsValid(cert.GetName()) {
+		return nil, fmt.Errorf("authority: %s is a restricted name", cert.GetName())
+	}
+	if cert.Exists() && !authority.IsSelfSigned(cert.GetCertificate()) {
+		return nil, fmt.Errorf("authority: %s exists and is not a root certificate", cert.GetName())
 	}
 
-	return nil
+	if !cert.Exists() {
+		if err := cert.Create(); err != nil {
+			return nil, err
+		}
+		if err := c.audit(OpCreateCA, cert.GetName(), cert.GetCertificate().SerialNumber); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.getCA()
 }
 
-// GetCA retrieves the root certificate, private key and certificate revocation list.
+// GetCA retrieves the selected root certificate, private key and certificate
+// revocation list. Reading the private key is recorded in the audit log.
 func (c *Client) GetCA() (*Certificate, error) {
-	cert, err := authority.GetCA(c.backend, c.config)
+	ca, err := c.getCA()
+	if err != nil {
+		return nil, err
+	}
+	if ca.PrivateKey != nil {
+		if err := c.auditRead(ca.CommonName, ca.Certificate.SerialNumber); err != nil {
+			return nil, err
+		}
+	}
+	return ca, nil
+}
+
+func (c *Client) getCA() (*Certificate, error) {
+	cert, err := c.loadCA()
 	if err != nil {
 		return nil, err
 	}
@@ -273,9 +565,62 @@ func (c *Client) GetCA() (*Certificate, error) {
 		Certificate: cert.GetCertificate(),
 		PrivateKey:  cert.GetPrivateKey(),
 		CRL:         crl,
+		KeyIsHeld:   cert.KeyIsHeld(),
+		PublicOnly:  cert.IsPublicOnly(),
 	}, nil
 }
 
+// loadCA returns the selected root certificate, completing a rollover whose
+// switch date has passed. The default root is created if it does not exist
+// yet, while other roots must be created explicitly.
+func (c *Client) loadCA() (*authority.Cert, error) {
+	root := c.cert(c.caName())
+	if !root.Exists() {
+		if root.GetName() != authority.DefaultCA {
+			return nil, authority.ErrCertNotFound
+		}
+		if err := root.Create(); err != nil {
+			return nil, err
+		}
+		if err := c.audit(OpCreateCA, root.GetName(), root.GetCertificate().SerialNumber); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := root.CompleteRollover(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func (c *Client) existingCA() (*authority.Cert, error) {
+	root := c.cert(c.caName())
+	if !root.Exists() {
+		return nil, authority.ErrCertNotFound
+	}
+	return root, nil
+}
+
+func (c *Client) caName() string {
+	return (&authority.Cert{CA: c.ca}).GetCAName()
+}
+
+// cert returns a Cert with the provided name in the selected hierarchy, using
+// that hierarchy's configuration.
+func (c *Client) cert(name string) *authority.Cert {
+	cfg := c.config
+	if cfg != nil {
+		cfg = cfg.ForCA(c.caName())
+	}
+	return &authority.Cert{
+		CommonName:    name,
+		CA:            c.ca,
+		Backend:       c.backend,
+		Config:        cfg,
+		Signers:       c.signers,
+		SignerConfigs: c.signerConfigs,
+	}
+}
+
 var restrictedNames []string = []string{"ca", "cert", "config", "crl", "generate", "get", "key", "revoke"}
 
 func nameIsValid(name string) bool {
@@ -3,15 +3,27 @@ package api
 import (
 	"bufio"
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"math/big"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/ovrclk/authority/authority"
+	"github.com/ovrclk/authority/backend"
 	"github.com/ovrclk/authority/config"
 )
 
@@ -77,7 +89,7 @@ func TestApiClientWithConfig(t *testing.T) {
 
 	api, err := NewClient(server, token)
 	if err != nil {
-		t.Fatal("error initializing client %v", err)
+		t.Fatalf("error initializing client %v", err)
 	}
 
 	c, err := api.GetConfig()
@@ -176,7 +188,7 @@ func TestApiClientWithChildCert(t *testing.T) {
 
 	api, err := NewClient(server, token)
 	if err != nil {
-		t.Fatal("error initializing client %v", err)
+		t.Fatalf("error initializing client %v", err)
 	}
 
 	c, err := api.GetConfig()
@@ -222,7 +234,7 @@ func TestCertSANs(t *testing.T) {
 
 	api, err := NewClient(server, token)
 	if err != nil {
-		t.Fatal("error initializing client %v", err)
+		t.Fatalf("error initializing client %v", err)
 	}
 
 	c, err := api.GetConfig()
@@ -263,3 +275,1078 @@ func TestCertSANs(t *testing.T) {
 	foo := <-done
 	fmt.Println("done", foo)
 }
+
+func testLocalClient(t *testing.T, cfg *config.Config) *Client {
+	dir, err := ioutil.TempDir("", "authority")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	api, err := NewLocalClientWithConfig(dir, cfg)
+	if err != nil {
+		t.Fatalf("error initializing client %v", err)
+	}
+	return api
+}
+
+func TestGenerateWithRole(t *testing.T) {
+	cfg := testConfig()
+	cfg.Roles = map[string]config.RoleConfig{
+		"web": config.RoleConfig{
+			Profile:      "server",
+			TTL:          "30d",
+			AllowedNames: []string{"*.ovrclk.com"},
+			DNSNames:     []string{"www.ovrclk.com"},
+		},
+		"subject": config.RoleConfig{
+			AllowedNames: []string{"*.ovrclk.com", "ovrclk.com"},
+			AllowSubject: true,
+		},
+	}
+	api := testLocalClient(t, cfg)
+
+	client, _, err := api.GenerateFromOptions("web.ovrclk.com", &Options{Role: "web"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	cert := client.Certificate
+	if cert.IsCA {
+		t.Fatal("expected server profile certificate")
+	}
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != "www.ovrclk.com" {
+		t.Fatal("expected role default dns san")
+	}
+	if cert.NotAfter.After(time.Now().Add(31 * 24 * time.Hour)) {
+		t.Fatal("expected role ttl to be applied")
+	}
+
+	if _, _, err := api.GenerateFromOptions("web.example.com", &Options{Role: "web"}); err == nil {
+		t.Fatal("expected error for name not allowed by role")
+	}
+	if _, _, err := api.GenerateFromOptions("db.ovrclk.com", &Options{Role: "web", Parent: "other"}); err == nil {
+		t.Fatal("expected error for parent not allowed by role")
+	}
+	if _, _, err := api.GenerateFromOptions("db.ovrclk.com", &Options{Role: "web", IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}}); err == nil {
+		t.Fatal("expected error for ip address not allowed by role")
+	}
+	if _, _, err := api.GenerateFromOptions("db.ovrclk.com", &Options{Role: "web", Subject: authority.Subject{Organization: "Other"}}); err == nil {
+		t.Fatal("expected error for subject override not allowed by role")
+	}
+	if _, _, err := api.GenerateFromOptions("mail.ovrclk.com", &Options{Role: "subject", Subject: authority.Subject{EmailAddress: "ops@example.com"}}); err == nil {
+		t.Fatal("expected error for email address not allowed by role")
+	}
+	if _, _, err := api.GenerateFromOptions("mail.ovrclk.com", &Options{Role: "subject", Subject: authority.Subject{EmailAddress: "ops@ovrclk.com"}}); err != nil {
+		t.Fatalf("expected subject override allowed by role, got %v", err)
+	}
+}
+
+func TestCertTokens(t *testing.T) {
+	server, token, mutex, done := getVaultInfo(t)
+
+	api, err := NewClientWithConfig(server, token, testConfig())
+	if err != nil {
+		t.Fatalf("error initializing client %v", err)
+	}
+
+	_, certToken, err := api.GenerateFromOptions("foo", &Options{
+		Token: backend.TokenOptions{TTL: time.Hour, NumUses: 5},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if certToken == "" {
+		t.Fatal("expected an access token")
+	}
+
+	if _, err := api.CreateToken("foo", &backend.TokenOptions{TTL: time.Hour}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	tokens, err := api.ListTokens("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("expected 2 tokens, got %d", len(tokens))
+	}
+	for _, info := range tokens {
+		if !info.Valid || info.ExpiresAt.IsZero() {
+			t.Fatalf("expected valid expiring token, got %v", info)
+		}
+	}
+
+	if err := api.Revoke("foo"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	tokens, err = api.ListTokens("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(tokens) != 0 {
+		t.Fatal("expected tokens to be revoked with the certificate")
+	}
+
+	mutex.Unlock()
+	<-done
+}
+
+func TestCASigner(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	api := testLocalClient(t, testConfig())
+	api.SetSigner("ca", key)
+
+	ca, err := api.CreateCA(&Options{})
+	if err != nil {
+		t.Fatalf("error creating ca: %v", err)
+	}
+	if ca.PrivateKey != nil {
+		t.Fatal("expected ca key not to be stored")
+	}
+	if !ca.KeyIsHeld {
+		t.Fatal("expected ca key to be held by the signer")
+	}
+
+	client, _, err := api.Generate("client")
+	if err != nil {
+		t.Fatalf("error creating client cert: %v", err)
+	}
+	if err := client.Certificate.CheckSignatureFrom(ca.Certificate); err != nil {
+		t.Fatalf("expected client cert signed by external ca key: %v", err)
+	}
+
+	if err := api.Revoke("client"); err != nil {
+		t.Fatalf("error revoking client cert: %v", err)
+	}
+	ca, err = api.GetCA()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := ca.Certificate.CheckCRLSignature(ca.CRL); err != nil {
+		t.Fatalf("expected crl signed by external ca key: %v", err)
+	}
+}
+
+func TestOfflineRoot(t *testing.T) {
+	offline := testLocalClient(t, testConfig())
+	root, err := offline.CreateCA(&Options{})
+	if err != nil {
+		t.Fatalf("error creating offline root: %v", err)
+	}
+
+	cfg := testConfig()
+	cfg.Policy.OfflineRoot = true
+	online := testLocalClient(t, cfg)
+	if _, err := online.CreateCA(&Options{}); err != authority.ErrRootOffline {
+		t.Fatalf("expected offline root policy to refuse root creation, got %v", err)
+	}
+	if err := online.ImportCA(root.Certificate); err != nil {
+		t.Fatalf("error importing root: %v", err)
+	}
+
+	csr, err := online.CreateRequest("intermediate", &Options{})
+	if err != nil {
+		t.Fatalf("error creating request: %v", err)
+	}
+	signed, err := offline.SignIntermediate(csr, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("error signing intermediate: %v", err)
+	}
+	if err := online.ImportIntermediate("intermediate", signed); err != nil {
+		t.Fatalf("error importing intermediate: %v", err)
+	}
+
+	// intermediates do not outlive the root
+	csr, err = online.CreateRequest("long", &Options{})
+	if err != nil {
+		t.Fatalf("error creating request: %v", err)
+	}
+	long, err := offline.SignIntermediate(csr, 100*365*24*time.Hour)
+	if err != nil {
+		t.Fatalf("error signing intermediate: %v", err)
+	}
+	if !long.NotAfter.Equal(root.Certificate.NotAfter) {
+		t.Fatalf("expected the intermediate to expire with the root at %v, got %v", root.Certificate.NotAfter, long.NotAfter)
+	}
+
+	// requests are held to the signing store's subject policy
+	offline.config.Policy.LockedSubject = []string{"org"}
+	csr, err = online.CreateRequest("other", &Options{Subject: authority.Subject{Organization: "Other"}})
+	if err != nil {
+		t.Fatalf("error creating request: %v", err)
+	}
+	if _, err := offline.SignIntermediate(csr, 24*time.Hour); err == nil {
+		t.Fatal("expected error signing a request with a locked subject field changed")
+	}
+	offline.config.Policy.LockedSubject = nil
+
+	// a leaf certificate cannot be imported as an intermediate
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1000),
+		Subject:      csr.Subject,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, root.Certificate, csr.PublicKey, root.PrivateKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	notCA, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := online.ImportIntermediate("long", notCA); err == nil {
+		t.Fatal("expected error importing a certificate which is not a CA")
+	}
+
+	ca, err := online.GetCA()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !ca.PublicOnly || ca.PrivateKey != nil {
+		t.Fatal("expected online root to be public only")
+	}
+	if _, _, err := online.Generate("leaf"); err != authority.ErrKeyOffline {
+		t.Fatalf("expected root signing to fail online, got %v", err)
+	}
+
+	leaf, _, err := online.GenerateWithParent("leaf", "intermediate")
+	if err != nil {
+		t.Fatalf("error issuing from intermediate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(root.Certificate)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(signed)
+	_, err = leaf.Certificate.Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		t.Fatalf("expected leaf to chain to offline root: %v", err)
+	}
+
+	if err := offline.Revoke("intermediate"); err != nil {
+		t.Fatalf("error revoking intermediate offline: %v", err)
+	}
+	crl, err := offline.SignCRL()
+	if err != nil {
+		t.Fatalf("error signing crl: %v", err)
+	}
+	if err := online.ImportCRL(crl); err != nil {
+		t.Fatalf("error importing crl: %v", err)
+	}
+	ca, err = online.GetCA()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	revoked := ca.CRL.TBSCertList.RevokedCertificates
+	if len(revoked) != 1 || revoked[0].SerialNumber.Cmp(signed.SerialNumber) != 0 {
+		t.Fatal("expected imported crl to revoke the intermediate")
+	}
+}
+
+func TestMultipleCAs(t *testing.T) {
+	cfg := testConfig()
+	cfg.CAs = map[string]config.CAConfig{
+		"staging": config.CAConfig{
+			Defaults: config.DefaultsConfig{Org: "Staging"},
+		},
+	}
+	api := testLocalClient(t, cfg)
+
+	prod, err := api.CreateCA(&Options{})
+	if err != nil {
+		t.Fatalf("error creating default ca: %v", err)
+	}
+
+	api.UseCA("staging")
+	if _, err := api.GetCA(); err != authority.ErrCertNotFound {
+		t.Fatalf("expected named ca not to be created implicitly, got %v", err)
+	}
+	staging, err := api.CreateCA(&Options{})
+	if err != nil {
+		t.Fatalf("error creating staging ca: %v", err)
+	}
+	if staging.Certificate.Subject.Organization[0] != "Staging" {
+		t.Fatal("expected staging ca to use its config section")
+	}
+	if staging.Certificate.SerialNumber.Cmp(prod.Certificate.SerialNumber) != 0 {
+		t.Fatal("expected separate serial number sequences")
+	}
+
+	leaf, _, err := api.Generate("staging-leaf")
+	if err != nil {
+		t.Fatalf("error creating staging leaf: %v", err)
+	}
+	if err := leaf.Certificate.CheckSignatureFrom(staging.Certificate); err != nil {
+		t.Fatalf("expected leaf signed by staging ca: %v", err)
+	}
+
+	// issuers of another hierarchy, and names holding other certificates,
+	// are refused
+	api.UseCA("")
+	if _, _, err := api.Generate("prod-intermediate"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	api.UseCA("staging")
+	if _, _, err := api.GenerateWithParent("mixed", "prod-intermediate"); err == nil {
+		t.Fatal("expected error issuing from a parent in another hierarchy")
+	}
+	if _, _, err := api.GenerateWithParent("mixed", "missing"); err == nil || !strings.Contains(err.Error(), "is not a stored CA") {
+		t.Fatalf("expected error issuing from a parent which is not stored, got %v", err)
+	}
+	api.UseCA("staging-leaf")
+	if _, err := api.CreateCA(&Options{}); err == nil {
+		t.Fatal("expected error creating a CA over a leaf certificate")
+	}
+	api.UseCA("staging")
+
+	if err := api.Revoke("staging-leaf"); err != nil {
+		t.Fatalf("error revoking staging leaf: %v", err)
+	}
+	staging, err = api.GetCA()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(staging.CRL.TBSCertList.RevokedCertificates) != 1 {
+		t.Fatal("expected revocation on staging crl")
+	}
+
+	api.UseCA("")
+	prod, err = api.GetCA()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(prod.CRL.TBSCertList.RevokedCertificates) != 0 {
+		t.Fatal("expected default crl to be unchanged")
+	}
+}
+
+func TestRollover(t *testing.T) {
+	api := testLocalClient(t, testConfig())
+	old, err := api.CreateCA(&Options{})
+	if err != nil {
+		t.Fatalf("error creating ca: %v", err)
+	}
+	before, _, err := api.Generate("before")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	r, err := api.Rollover("ca", time.Now().Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("error rolling over ca: %v", err)
+	}
+	if _, err := api.Rollover("ca", time.Now(), 0); err == nil {
+		t.Fatal("expected error for second pending rollover")
+	}
+
+	bundle, err := api.TrustBundle()
+	if err != nil || len(bundle) != 2 {
+		t.Fatalf("expected both roots in trust bundle: %v", err)
+	}
+
+	// the old root's certificates chain to the new root through the cross
+	// certificate, and the reverse
+	newRoots := x509.NewCertPool()
+	newRoots.AddCert(r.Next)
+	cross := x509.NewCertPool()
+	cross.AddCert(r.CrossOld)
+	_, err = before.Certificate.Verify(x509.VerifyOptions{
+		Roots:         newRoots,
+		Intermediates: cross,
+		CurrentTime:   time.Now().Add(2 * time.Hour),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		t.Fatalf("expected old certificate to chain to new root: %v", err)
+	}
+	if err := r.CrossNew.CheckSignatureFrom(old.Certificate); err != nil {
+		t.Fatalf("expected new root key cross-signed by old root: %v", err)
+	}
+
+	report, err := api.RolloverReport()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(report) != 1 || report[0].CommonName != "before" {
+		t.Fatal("expected report of certificate issued by old root")
+	}
+
+	// a rollover due now switches issuance on the next certificate
+	api = testLocalClient(t, testConfig())
+	old, _ = api.CreateCA(&Options{})
+	api.Generate("before")
+	if _, err := api.Rollover("ca", time.Now().Add(-time.Minute), 0); err != nil {
+		t.Fatalf("error rolling over ca: %v", err)
+	}
+	after, _, err := api.Generate("after")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	current, err := api.GetCA()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if current.Certificate.Equal(old.Certificate) {
+		t.Fatal("expected rollover to complete")
+	}
+	if err := after.Certificate.CheckSignatureFrom(current.Certificate); err != nil {
+		t.Fatalf("expected new certificate signed by new root: %v", err)
+	}
+	report, err = api.RolloverReport()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(report) != 1 || report[0].CommonName != "before" {
+		t.Fatal("expected report of certificate issued by previous root")
+	}
+}
+
+func TestCascadingRevocation(t *testing.T) {
+	api := testLocalClient(t, testConfig())
+	if _, err := api.CreateCA(&Options{}); err != nil {
+		t.Fatalf("error creating ca: %v", err)
+	}
+	if _, _, err := api.Generate("intermediate"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	leaf, _, err := api.GenerateWithParent("leaf", "intermediate")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	other, _, err := api.GenerateWithParent("other", "intermediate")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// a certificate is revoked on its issuer's CRL, not the root's
+	if err := api.Revoke("leaf"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !api.cert("intermediate").IsRevoked(leaf.Certificate.SerialNumber) {
+		t.Fatal("expected leaf on the intermediate CRL")
+	}
+	if api.cert("ca").IsRevoked(leaf.Certificate.SerialNumber) {
+		t.Fatal("expected leaf not on the root CRL")
+	}
+
+	revoked, err := api.RevokeWithOptions("intermediate", &RevokeOptions{
+		Reason:  authority.ReasonKeyCompromise,
+		Cascade: true,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(revoked) != 3 || revoked[0] != "intermediate" {
+		t.Fatalf("expected intermediate and its children revoked, got %v", revoked)
+	}
+
+	der, err := api.GetCRL("intermediate")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	crl, err := x509.ParseCRL(der)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	found := false
+	for _, entry := range crl.TBSCertList.RevokedCertificates {
+		if entry.SerialNumber.Cmp(other.Certificate.SerialNumber) == 0 {
+			found = true
+			if authority.RevocationReason(entry) != authority.ReasonCACompromise {
+				t.Fatal("expected descendant revoked with reason cACompromise")
+			}
+		}
+	}
+	if !found {
+		t.Fatal("expected descendant on the intermediate CRL")
+	}
+	if len(crl.TBSCertList.RevokedCertificates) != 2 {
+		t.Fatal("expected an already revoked certificate listed once")
+	}
+
+	// certificates issued by an intermediate's key before a rollover are
+	// revoked along with it
+	api = testLocalClient(t, testConfig())
+	if _, err := api.CreateCA(&Options{}); err != nil {
+		t.Fatalf("error creating ca: %v", err)
+	}
+	if _, _, err := api.Generate("intermediate"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	before, _, err := api.GenerateWithParent("before", "intermediate")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := api.Rollover("intermediate", time.Now().Add(-time.Minute), 0); err != nil {
+		t.Fatalf("error rolling over intermediate: %v", err)
+	}
+	if _, _, err := api.GenerateWithParent("after", "intermediate"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	revoked, err = api.RevokeWithOptions("intermediate", &RevokeOptions{Cascade: true})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(revoked) != 4 {
+		t.Fatalf("expected both intermediate generations and their children revoked, got %v", revoked)
+	}
+	if !api.cert("intermediate" + authority.PreviousSuffix).IsRevoked(before.Certificate.SerialNumber) {
+		t.Fatal("expected certificate issued before the rollover on the previous CRL")
+	}
+}
+
+func TestRevokeUnstored(t *testing.T) {
+	api := testLocalClient(t, testConfig())
+	if _, err := api.CreateCA(&Options{}); err != nil {
+		t.Fatalf("error creating ca: %v", err)
+	}
+	lost, _, err := api.Generate("lost")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := api.RevokeCertificate(lost.Certificate, authority.ReasonKeyCompromise); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !api.cert("ca").IsRevoked(lost.Certificate.SerialNumber) {
+		t.Fatal("expected certificate on the issuer CRL")
+	}
+
+	other := testLocalClient(t, testConfig())
+	foreign, _, err := other.Generate("foreign")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := api.RevokeCertificate(foreign.Certificate, authority.ReasonUnspecified); err == nil {
+		t.Fatal("expected error for certificate not signed by a stored CA")
+	}
+
+	serial := big.NewInt(1000)
+	if err := api.RevokeSerial("", serial, authority.ReasonUnspecified); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !api.cert("ca").IsRevoked(serial) {
+		t.Fatal("expected serial on the CA CRL")
+	}
+	if err := api.RevokeSerial("missing", serial, authority.ReasonUnspecified); err == nil {
+		t.Fatal("expected error for unknown issuer")
+	}
+}
+
+func TestCertificateHistory(t *testing.T) {
+	api := testLocalClient(t, testConfig())
+	first, _, err := api.Generate("laptop")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	second, _, err := api.Generate("replacement")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// re-importing a certificate under the same name keeps the old one
+	if err := api.SetCertificate("laptop", second.Certificate, second.PrivateKey); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	history, err := api.History("laptop")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(history) != 2 || !history[0].Certificate.Equal(first.Certificate) {
+		t.Fatal("expected the replaced certificate as the first version")
+	}
+	if history[0].Status != StatusSuperseded || history[1].Status != StatusActive || !history[1].Current {
+		t.Fatalf("unexpected statuses %s and %s", history[0].Status, history[1].Status)
+	}
+
+	if _, err := api.RevokeWithOptions("laptop", &RevokeOptions{Version: 1}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	history, err = api.History("laptop")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if history[0].Status != StatusRevoked || history[1].Status != StatusActive {
+		t.Fatal("expected only the first version revoked")
+	}
+
+	if _, err := api.GetVersion("laptop", 3); err == nil {
+		t.Fatal("expected error for missing version")
+	}
+}
+
+func TestCertificateMetadata(t *testing.T) {
+	api := testLocalClient(t, testConfig())
+	_, _, err := api.GenerateFromOptions("db-03", &Options{
+		Labels:    map[string]string{"owner": "alice", "tags": "db,prod", "rack": "r1"},
+		CreatedBy: "bob",
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, _, err := api.GenerateFromOptions("web-01", &Options{Labels: map[string]string{"team": "web"}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, _, err := api.GenerateFromOptions("bad", &Options{Labels: map[string]string{"created-by": "eve"}}); err == nil {
+		t.Fatal("expected error setting creation metadata")
+	}
+
+	cert, err := api.Get("db-03")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	meta := cert.Metadata
+	if meta.Owner != "alice" || len(meta.Tags) != 2 || meta.Labels["rack"] != "r1" || meta.CreatedBy != "bob" || meta.CreatedAt.IsZero() {
+		t.Fatalf("unexpected metadata %+v", meta)
+	}
+
+	if _, err := api.SetLabels("db-03", map[string]string{"team": "storage", "rack": ""}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	certs, err := api.List(map[string]string{"team": "storage", "tags": "prod"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(certs) != 1 || certs[0].CommonName != "db-03" {
+		t.Fatal("expected only db-03 to match the filter")
+	}
+	if _, ok := certs[0].Metadata.Labels["rack"]; ok {
+		t.Fatal("expected empty label value to clear the label")
+	}
+
+	all, err := api.List(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected ca and both certificates listed, got %d", len(all))
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	api := testLocalClient(t, testConfig())
+	api.Actor = "alice"
+	if _, err := api.CreateCA(&Options{}); err != nil {
+		t.Fatalf("error creating ca: %v", err)
+	}
+	created, _, err := api.Generate("laptop")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := api.Get("laptop"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := api.Revoke("laptop"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	entries, err := api.AuditLog()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var ops []string
+	for _, e := range entries[1:] {
+		ops = append(ops, e.Operation)
+	}
+	if strings.Join(ops, ",") != "create-ca,create,read-key,revoke" {
+		t.Fatalf("unexpected audited operations %v", ops)
+	}
+	last := entries[len(entries)-1]
+	if last.Actor != "alice" || last.Target != "laptop" || last.Serial != created.Certificate.SerialNumber.Text(16) {
+		t.Fatalf("unexpected audit entry %+v", last)
+	}
+	if n, err := api.VerifyAuditLog(); err != nil || n != len(entries) {
+		t.Fatalf("expected audit log to verify: %v", err)
+	}
+
+	path := filepath.Join(api.Path, "audit.log")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	truncated := data[:strings.LastIndex(strings.TrimSpace(string(data)), "\n")+1]
+	if err := ioutil.WriteFile(path, truncated, 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := api.VerifyAuditLog(); err == nil {
+		t.Fatal("expected audit log missing its last entry to fail verification")
+	}
+
+	tampered := strings.Replace(string(data), `"actor":"alice","operation":"read-key"`, `"actor":"mallory","operation":"read-key"`, 1)
+	if err := ioutil.WriteFile(path, []byte(tampered), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := api.VerifyAuditLog(); err == nil {
+		t.Fatal("expected modified audit log to fail verification")
+	}
+}
+
+func TestKeyedAuditLog(t *testing.T) {
+	api := testLocalClient(t, testConfig())
+	if _, err := api.CreateCA(&Options{}); err != nil {
+		t.Fatalf("error creating ca: %v", err)
+	}
+	api.AuditKey = []byte("audit secret")
+	if _, _, err := api.Generate("laptop"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if n, err := api.VerifyAuditLog(); err != nil || n != 3 {
+		t.Fatalf("expected keyed audit log to verify: %d %v", n, err)
+	}
+
+	// without the key, the log can be neither verified nor appended to
+	api.AuditKey = nil
+	if _, err := api.VerifyAuditLog(); err == nil {
+		t.Fatal("expected keyed audit log not to verify without the key")
+	}
+	if err := api.Revoke("laptop"); err == nil || !strings.Contains(err.Error(), "audit key") {
+		t.Fatalf("expected unkeyed entry after keyed entries refused, got %v", err)
+	}
+
+	// rewriting the log as unkeyed entries, with a matching head, is noticed
+	entries, err := api.AuditLog()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var lines []string
+	prev := ""
+	for _, entry := range entries {
+		entry.Keyed = false
+		entry.PrevHash = prev
+		entry.Hash = entry.ComputeHash(nil)
+		prev = entry.Hash
+		line, _ := json.Marshal(entry)
+		lines = append(lines, string(line))
+	}
+	if err := ioutil.WriteFile(filepath.Join(api.Path, "audit.log"), []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	head, _ := json.Marshal(&backend.AuditHead{Sequence: len(entries), Hash: prev})
+	if err := ioutil.WriteFile(filepath.Join(api.Path, "audit.head"), head, 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := api.VerifyAuditLog(); err != nil {
+		t.Fatalf("expected rewritten log to verify without the key: %v", err)
+	}
+	api.AuditKey = []byte("audit secret")
+	if _, err := api.VerifyAuditLog(); err == nil {
+		t.Fatal("expected rewritten log to fail verification with the key")
+	}
+}
+
+func TestExpiryReport(t *testing.T) {
+	cfg := testConfig()
+	cfg.Roles = map[string]config.RoleConfig{
+		"short":        config.RoleConfig{TTL: "10d"},
+		"intermediate": config.RoleConfig{TTL: "10d", Parent: "intermediate"},
+	}
+	api := testLocalClient(t, cfg)
+	if _, err := api.CreateCA(&Options{}); err != nil {
+		t.Fatalf("error creating ca: %v", err)
+	}
+	if _, _, err := api.Generate("intermediate"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, _, err := api.GenerateFromOptions("soon", &Options{Role: "intermediate"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, _, err := api.GenerateFromOptions("revoked", &Options{Role: "short"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := api.Revoke("revoked"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	report, err := api.ExpiryReport(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var names []string
+	for _, e := range report {
+		names = append(names, e.Issuer+"/"+e.Name)
+	}
+	if strings.Join(names, ",") != "/ca,ca/intermediate,intermediate/soon" {
+		t.Fatalf("unexpected report %v", names)
+	}
+	if remaining := report[2].Remaining(); remaining <= 0 || remaining > 10*24*time.Hour {
+		t.Fatalf("unexpected remaining time %v", remaining)
+	}
+}
+
+func TestRenew(t *testing.T) {
+	api := testLocalClient(t, testConfig())
+	if _, err := api.CreateCA(&Options{}); err != nil {
+		t.Fatalf("error creating ca: %v", err)
+	}
+	old, _, err := api.GenerateWithOptions("web", "", []string{"web.example.com"}, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	renewed, err := api.Renew("web")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if renewed.Certificate.SerialNumber.Cmp(old.Certificate.SerialNumber) == 0 {
+		t.Fatal("expected a new serial number")
+	}
+	if renewed.PrivateKey.N.Cmp(old.PrivateKey.N) == 0 {
+		t.Fatal("expected a new private key")
+	}
+	if len(renewed.Certificate.DNSNames) != 1 || renewed.Certificate.DNSNames[0] != "web.example.com" {
+		t.Fatalf("expected SANs to be kept, got %v", renewed.Certificate.DNSNames)
+	}
+	lifetime := old.Certificate.NotAfter.Sub(old.Certificate.NotBefore)
+	for i := 0; i < 2; i++ {
+		if renewed.Certificate.NotAfter.Sub(renewed.Certificate.NotBefore) != lifetime {
+			t.Fatalf("expected the lifetime %v kept, got %v", lifetime, renewed.Certificate.NotAfter.Sub(renewed.Certificate.NotBefore))
+		}
+		if renewed, err = api.Renew("web"); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	ca, err := api.GetCA()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := renewed.Certificate.CheckSignatureFrom(ca.Certificate); err != nil {
+		t.Fatalf("expected renewed certificate signed by ca: %v", err)
+	}
+
+	history, err := api.History("web")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(history) != 4 || !history[0].Certificate.Equal(old.Certificate) {
+		t.Fatal("expected the replaced certificate kept as a previous version")
+	}
+
+	if _, err := api.Renew("ca"); err == nil {
+		t.Fatal("expected error renewing a root")
+	}
+	if err := api.Revoke("web"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := api.Renew("web"); err == nil {
+		t.Fatal("expected error renewing a revoked certificate")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	api := testLocalClient(t, testConfig())
+	if _, err := api.CreateCA(&Options{}); err != nil {
+		t.Fatalf("error creating ca: %v", err)
+	}
+	if _, _, err := api.Generate("intermediate"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	leaf, _, err := api.GenerateWithOptions("leaf", "intermediate", []string{"leaf.example.com"}, []net.IP{net.ParseIP("10.0.0.1")})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	inspection, err := api.Inspect("leaf")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if inspection.Name != "leaf" || inspection.Status != StatusActive {
+		t.Fatalf("unexpected name %s or status %s", inspection.Name, inspection.Status)
+	}
+	if strings.Join(inspection.Chain, ",") != "intermediate,ca" {
+		t.Fatalf("unexpected chain %v", inspection.Chain)
+	}
+	if inspection.KeyType != "RSA" || inspection.KeySize != 2048 {
+		t.Fatalf("unexpected key %s %d", inspection.KeyType, inspection.KeySize)
+	}
+	if len(inspection.IPAddresses) != 1 || inspection.IPAddresses[0] != "10.0.0.1" {
+		t.Fatalf("unexpected ip addresses %v", inspection.IPAddresses)
+	}
+
+	if err := api.Hold("leaf"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	inspection, err = api.InspectCertificate(leaf.Certificate)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if inspection.Name != "" || inspection.Status != StatusOnHold {
+		t.Fatalf("unexpected name %s or status %s", inspection.Name, inspection.Status)
+	}
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	api := testLocalClient(t, testConfig())
+	if _, err := api.CreateCA(&Options{}); err != nil {
+		t.Fatalf("error creating ca: %v", err)
+	}
+	if _, _, err := api.Generate("intermediate"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	leaf, _, err := api.GenerateWithOptions("leaf", "intermediate", []string{"leaf.example.com"}, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	opts := &VerifyOptions{Name: "leaf", Purpose: PurposeServer, Host: "leaf.example.com"}
+	v, err := api.VerifyCertificate(leaf.Certificate, opts)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !v.Valid || strings.Join(v.Chain, ",") != "intermediate,ca" {
+		t.Fatalf("expected a valid certificate under intermediate, got %v %v", v.Chain, v.Problems)
+	}
+
+	opts = &VerifyOptions{Name: "intermediate", Host: "other.example.com"}
+	if v, err = api.VerifyCertificate(leaf.Certificate, opts); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if v.Valid || len(v.Problems) != 2 {
+		t.Fatalf("expected host and name problems, got %v", v.Problems)
+	}
+
+	if err := api.Revoke("intermediate"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if v, err = api.VerifyCertificate(leaf.Certificate, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if v.Valid || len(v.Problems) != 1 || !strings.Contains(v.Problems[0], "revoked") {
+		t.Fatalf("expected the revoked intermediate, got %v", v.Problems)
+	}
+
+	if _, err := api.VerifyCertificate(leaf.Certificate, &VerifyOptions{Purpose: "email"}); err == nil {
+		t.Fatal("expected error for an unknown purpose")
+	}
+
+	// a CA's name constraints apply to the certificates below it
+	ca, err := api.GetCA()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(100),
+		Subject:               pkix.Name{CommonName: "constrained"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		PermittedDNSDomains:   []string{"example.org"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, key.Public(), ca.PrivateKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	constrained, _ := x509.ParseCertificate(der)
+	if err := api.backend.PutCertificate("constrained", constrained); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	template = &x509.Certificate{
+		SerialNumber: big.NewInt(101),
+		Subject:      pkix.Name{CommonName: "outside"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"outside.example.com"},
+	}
+	if der, err = x509.CreateCertificate(rand.Reader, template, constrained, key.Public(), key); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	outside, _ := x509.ParseCertificate(der)
+	if v, err = api.VerifyCertificate(outside, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if v.Valid || len(v.Problems) != 1 || !strings.Contains(v.Problems[0], "not valid") {
+		t.Fatalf("expected the name constraint violated, got %v", v.Problems)
+	}
+}
+
+func TestGenerateWithProvidedKey(t *testing.T) {
+	api := testLocalClient(t, testConfig())
+	if _, err := api.CreateCA(&Options{}); err != nil {
+		t.Fatalf("error creating ca: %v", err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	device, _, err := api.GenerateFromOptions("device", &Options{PublicKey: ecKey.Public()})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !device.PublicOnly || device.PrivateKey != nil {
+		t.Fatal("expected only the certificate to be stored")
+	}
+	if pub, ok := device.Certificate.PublicKey.(*ecdsa.PublicKey); !ok || pub.X.Cmp(ecKey.X) != 0 {
+		t.Fatal("expected the certificate to hold the provided public key")
+	}
+	renewed, err := api.Renew("device")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if pub, ok := renewed.Certificate.PublicKey.(*ecdsa.PublicKey); !ok || pub.X.Cmp(ecKey.X) != 0 {
+		t.Fatal("expected renewal to keep the provided public key")
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	byok, _, err := api.GenerateFromOptions("byok", &Options{PrivateKey: rsaKey})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if byok.PrivateKey == nil || byok.PrivateKey.N.Cmp(rsaKey.N) != 0 {
+		t.Fatal("expected the provided private key to be stored")
+	}
+
+	// only RSA keys are given key encipherment
+	for name, opts := range map[string]*Options{
+		"ec-server":  &Options{PublicKey: ecKey.Public(), profile: "server"},
+		"rsa-server": &Options{PublicKey: rsaKey.Public(), profile: "server"},
+	} {
+		server, _, err := api.GenerateFromOptions(name, opts)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		_, isRSA := opts.PublicKey.(*rsa.PublicKey)
+		if encipherment := server.Certificate.KeyUsage&x509.KeyUsageKeyEncipherment != 0; encipherment != isRSA {
+			t.Fatalf("expected key encipherment for %s to be %v", name, isRSA)
+		}
+	}
+
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, _, err := api.GenerateFromOptions("weak", &Options{PublicKey: weakKey.Public()}); err == nil {
+		t.Fatal("expected error providing a 1024 bit RSA key")
+	}
+	p224Key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, _, err := api.GenerateFromOptions("p224", &Options{PublicKey: p224Key.Public()}); err == nil {
+		t.Fatal("expected error providing a P-224 key")
+	}
+
+	opts := &Options{PublicKey: ecKey.Public(), PrivateKey: rsaKey}
+	if _, _, err := api.GenerateFromOptions("both", opts); err == nil {
+		t.Fatal("expected error providing both a public and a private key")
+	}
+	opts = &Options{PublicKey: ecKey.Public(), KeyInBackend: true}
+	if _, _, err := api.GenerateFromOptions("transit", opts); err == nil {
+		t.Fatal("expected error providing a key to generate in the backend")
+	}
+}
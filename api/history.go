@@ -0,0 +1,89 @@
+package api
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/ovrclk/authority/authority"
+)
+
+// Statuses of a certificate version.
+const (
+	StatusActive     = "active"
+	StatusSuperseded = "superseded"
+	StatusExpired    = "expired"
+	StatusRevoked    = "revoked"
+	StatusOnHold     = "on hold"
+)
+
+// Version is one issuance of a certificate name. Every certificate stored
+// under a name is kept as a version, numbered from 1 in the order stored.
+type Version struct {
+	Number      int
+	Certificate *x509.Certificate
+
+	// Current is set for the certificate presently stored under the name.
+	Current bool
+
+	// Status is one of the Status constants. Revocation takes precedence
+	// over expiry, and expiry over being superseded by a newer version.
+	Status string
+}
+
+// History returns every version of the certificate with the provided common
+// name, oldest first.
+func (c *Client) History(name string) ([]*Version, error) {
+	certs, err := c.backend.GetCertificateVersions(c.cert(name).GetName())
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, authority.ErrCertNotFound
+	}
+
+	cas, err := authority.LoadCAs(c.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	versions := make([]*Version, len(certs))
+	for i, cert := range certs {
+		v := &Version{
+			Number:      i + 1,
+			Certificate: cert,
+			Current:     i == len(certs)-1,
+			Status:      StatusActive,
+		}
+		switch {
+		case now.After(cert.NotAfter):
+			v.Status = StatusExpired
+		case !v.Current:
+			v.Status = StatusSuperseded
+		}
+		if issuer := authority.IssuerName(cert, cas); issuer != "" {
+			if reason, revoked := c.cert(issuer).Revocation(cert.SerialNumber); revoked {
+				v.Status = StatusRevoked
+				if reason == authority.ReasonCertificateHold {
+					v.Status = StatusOnHold
+				}
+			}
+		}
+		versions[i] = v
+	}
+	return versions, nil
+}
+
+// GetVersion returns the provided version of the certificate with the
+// provided common name, as numbered by History.
+func (c *Client) GetVersion(name string, number int) (*Version, error) {
+	versions, err := c.History(name)
+	if err != nil {
+		return nil, err
+	}
+	if number < 1 || number > len(versions) {
+		return nil, fmt.Errorf("authority: %s has no version %d, it has %d", name, number, len(versions))
+	}
+	return versions[number-1], nil
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/ovrclk/authority/authority"
+	"github.com/ovrclk/authority/util"
+)
+
+// StatusNotYetValid is the status of a certificate before its NotBefore
+// date.
+const StatusNotYetValid = "not yet valid"
+
+// Inspection is a decoded description of a certificate.
+type Inspection struct {
+	// Name is the stored name of the certificate, empty for certificates
+	// which are not stored.
+	Name string `json:"name,omitempty"`
+
+	Subject            string                `json:"subject"`
+	Issuer             string                `json:"issuer"`
+	Serial             string                `json:"serial"`
+	NotBefore          time.Time             `json:"not_before"`
+	NotAfter           time.Time             `json:"not_after"`
+	DNSNames           []string              `json:"dns_names,omitempty"`
+	IPAddresses        []string              `json:"ip_addresses,omitempty"`
+	EmailAddresses     []string              `json:"email_addresses,omitempty"`
+	URIs               []string              `json:"uris,omitempty"`
+	KeyType            string                `json:"key_type"`
+	KeySize            int                   `json:"key_size"`
+	SignatureAlgorithm string                `json:"signature_algorithm"`
+	IsCA               bool                  `json:"is_ca"`
+	KeyUsage           []string              `json:"key_usage,omitempty"`
+	ExtKeyUsage        []string              `json:"ext_key_usage,omitempty"`
+	Extensions         []*InspectedExtension `json:"extensions"`
+	SHA1Fingerprint    string                `json:"sha1_fingerprint"`
+	SHA256Fingerprint  string                `json:"sha256_fingerprint"`
+
+	// SPKIPin is the base64 SHA-256 digest of the public key info.
+	SPKIPin string `json:"spki_pin"`
+
+	// Chain lists the names of the stored CAs above the certificate, from
+	// its issuer up to the root. It is empty for roots and for certificates
+	// whose issuer is not stored.
+	Chain []string `json:"chain"`
+
+	// Status is one of the Status constants. Revocation is only known for
+	// certificates issued by a stored CA.
+	Status string `json:"status"`
+}
+
+// InspectedExtension describes a certificate extension.
+type InspectedExtension struct {
+	OID      string `json:"oid"`
+	Name     string `json:"name,omitempty"`
+	Critical bool   `json:"critical"`
+}
+
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "digitalSignature"},
+	{x509.KeyUsageContentCommitment, "contentCommitment"},
+	{x509.KeyUsageKeyEncipherment, "keyEncipherment"},
+	{x509.KeyUsageDataEncipherment, "dataEncipherment"},
+	{x509.KeyUsageKeyAgreement, "keyAgreement"},
+	{x509.KeyUsageCertSign, "keyCertSign"},
+	{x509.KeyUsageCRLSign, "cRLSign"},
+	{x509.KeyUsageEncipherOnly, "encipherOnly"},
+	{x509.KeyUsageDecipherOnly, "decipherOnly"},
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "any",
+	x509.ExtKeyUsageServerAuth:      "serverAuth",
+	x509.ExtKeyUsageClientAuth:      "clientAuth",
+	x509.ExtKeyUsageCodeSigning:     "codeSigning",
+	x509.ExtKeyUsageEmailProtection: "emailProtection",
+	x509.ExtKeyUsageIPSECEndSystem:  "ipsecEndSystem",
+	x509.ExtKeyUsageIPSECTunnel:     "ipsecTunnel",
+	x509.ExtKeyUsageIPSECUser:       "ipsecUser",
+	x509.ExtKeyUsageTimeStamping:    "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSPSigning",
+}
+
+var extensionNames = map[string]string{
+	"2.5.29.14":               "subjectKeyIdentifier",
+	"2.5.29.15":               "keyUsage",
+	"2.5.29.17":               "subjectAltName",
+	"2.5.29.19":               "basicConstraints",
+	"2.5.29.30":               "nameConstraints",
+	"2.5.29.31":               "cRLDistributionPoints",
+	"2.5.29.32":               "certificatePolicies",
+	"2.5.29.35":               "authorityKeyIdentifier",
+	"2.5.29.37":               "extKeyUsage",
+	"1.3.6.1.5.5.7.1.1":       "authorityInfoAccess",
+	"1.3.6.1.4.1.11129.2.4.2": "signedCertificateTimestamps",
+}
+
+// Inspect describes the certificate stored under the provided common name.
+func (c *Client) Inspect(name string) (*Inspection, error) {
+	cert, err := c.GetCertificate(name)
+	if err != nil {
+		return nil, err
+	}
+	inspection, err := c.InspectCertificate(cert)
+	if err != nil {
+		return nil, err
+	}
+	inspection.Name = c.cert(name).GetName()
+	return inspection, nil
+}
+
+// InspectCertificate describes the provided certificate, which need not be
+// stored. Its chain and revocation status are found through the stored CAs
+// whose keys signed it.
+func (c *Client) InspectCertificate(cert *x509.Certificate) (*Inspection, error) {
+	cas, err := authority.LoadCAs(c.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Inspection{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		Serial:             fmt.Sprintf("%x", cert.SerialNumber),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		DNSNames:           cert.DNSNames,
+		EmailAddresses:     cert.EmailAddresses,
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		IsCA:               cert.IsCA,
+		SHA1Fingerprint:    util.SHA1Fingerprint(cert),
+		SHA256Fingerprint:  util.SHA256Fingerprint(cert),
+		SPKIPin:            util.SPKIPin(cert),
+		Chain:              []string{},
+		Status:             StatusActive,
+	}
+	for _, ip := range cert.IPAddresses {
+		i.IPAddresses = append(i.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		i.URIs = append(i.URIs, uri.String())
+	}
+
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		i.KeyType, i.KeySize = "RSA", pub.N.BitLen()
+	case *ecdsa.PublicKey:
+		i.KeyType, i.KeySize = "ECDSA", pub.Curve.Params().BitSize
+	default:
+		i.KeyType = cert.PublicKeyAlgorithm.String()
+	}
+
+	for _, u := range keyUsageNames {
+		if cert.KeyUsage&u.usage != 0 {
+			i.KeyUsage = append(i.KeyUsage, u.name)
+		}
+	}
+	i.ExtKeyUsage = extKeyUsages(cert)
+	for _, ext := range cert.Extensions {
+		i.Extensions = append(i.Extensions, &InspectedExtension{
+			OID:      ext.Id.String(),
+			Name:     extensionNames[ext.Id.String()],
+			Critical: ext.Critical,
+		})
+	}
+
+	now := time.Now()
+	switch {
+	case now.Before(cert.NotBefore):
+		i.Status = StatusNotYetValid
+	case now.After(cert.NotAfter):
+		i.Status = StatusExpired
+	}
+
+	issued := cert
+	for n := 0; n < len(cas); n++ {
+		name := authority.IssuerName(issued, cas)
+		if name == "" {
+			break
+		}
+		if n == 0 {
+			if reason, revoked := c.cert(name).Revocation(cert.SerialNumber); revoked {
+				i.Status = StatusRevoked
+				if reason == authority.ReasonCertificateHold {
+					i.Status = StatusOnHold
+				}
+			}
+		}
+		i.Chain = append(i.Chain, name)
+		issued = cas[name]
+	}
+	return i, nil
+}
+
+func extKeyUsages(cert *x509.Certificate) []string {
+	var names []string
+	for _, u := range cert.ExtKeyUsage {
+		name, ok := extKeyUsageNames[u]
+		if !ok {
+			name = fmt.Sprintf("unknown (%d)", u)
+		}
+		names = append(names, name)
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		names = append(names, oid.String())
+	}
+	return names
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"time"
+
+	"github.com/ovrclk/authority/authority"
+	"github.com/ovrclk/authority/backend"
+)
+
+// GetMetadata returns the metadata record of the certificate with the
+// provided common name.
+func (c *Client) GetMetadata(name string) (*backend.Metadata, error) {
+	cert := c.cert(name)
+	if !cert.Exists() {
+		return nil, authority.ErrCertNotFound
+	}
+	return c.backend.GetMetadata(cert.GetName())
+}
+
+// SetLabels sets the provided keys in the metadata record of the certificate
+// with the provided common name, and returns the updated record. An empty
+// value clears a key.
+func (c *Client) SetLabels(name string, labels map[string]string) (*backend.Metadata, error) {
+	meta, err := c.GetMetadata(name)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range labels {
+		if err := meta.Set(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.backend.PutMetadata(c.cert(name).GetName(), meta); err != nil {
+		return nil, err
+	}
+	return meta, c.audit(OpLabel, c.cert(name).GetName(), nil)
+}
+
+// List returns the stored certificates whose metadata matches every key in
+// filter, sorted by name. A nil filter returns every certificate.
+func (c *Client) List(filter map[string]string) ([]*Certificate, error) {
+	names, err := c.backend.ListCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*Certificate
+	for _, name := range names {
+		meta, err := c.backend.GetMetadata(name)
+		if err != nil {
+			return nil, err
+		}
+		if !meta.Matches(filter) {
+			continue
+		}
+		cert, err := c.backend.GetCertificate(name)
+		if err != nil || cert == nil {
+			continue
+		}
+		certs = append(certs, &Certificate{
+			CommonName:  name,
+			Certificate: cert,
+			Metadata:    meta,
+		})
+	}
+	return certs, nil
+}
+
+func newMetadata(opts *Options) (*backend.Metadata, error) {
+	meta := &backend.Metadata{
+		CreatedBy: opts.CreatedBy,
+		CreatedAt: time.Now().UTC(),
+	}
+	for key, value := range opts.Labels {
+		if err := meta.Set(key, value); err != nil {
+			return nil, err
+		}
+	}
+	return meta, nil
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// ImportCA stores the provided certificate as the selected root without its
+// private key. This marks the root as public only: certificates are issued
+// by intermediates signed offline, and the root key is never touched.
+func (c *Client) ImportCA(cert *x509.Certificate) error {
+	root := c.cert(c.caName())
+	if err := cert.CheckSignatureFrom(cert); err != nil {
+		return fmt.Errorf("authority: root certificate is not self-signed: %v", err)
+	}
+	if err := root.ImportPublic(cert); err != nil {
+		return err
+	}
+	return c.audit(OpImportCA, root.GetName(), cert.SerialNumber)
+}
+
+// CreateRequest generates and stores the private key for an intermediate
+// with the provided name, and returns a certificate signing request for it
+// to be signed by an offline root with SignIntermediate. Only the subject,
+// SANs and key settings of the Options apply.
+func (c *Client) CreateRequest(name string, opts *Options) (*x509.CertificateRequest, error) {
+	if !nameIsValid(name) {
+		return nil, fmt.Errorf("authority: %s is a restricted name", name)
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	cert := c.cert(name)
+	cert.Subject = opts.Subject
+	cert.DNSNames = opts.DNSNames
+	cert.IPAddresses = opts.IPAddresses
+	cert.KeyBits = opts.keyBits
+	cert.KeyInBackend = opts.KeyInBackend
+
+	csr, err := cert.CreateRequest()
+	if err != nil {
+		return nil, err
+	}
+	return csr, c.audit(OpCreateRequest, cert.GetName(), nil)
+}
+
+// ImportIntermediate stores the signed certificate for an intermediate whose
+// request was created with CreateRequest. The certificate must match the
+// stored key and be signed by the stored root.
+func (c *Client) ImportIntermediate(name string, cert *x509.Certificate) error {
+	intermediate := c.cert(name)
+	if err := intermediate.ImportSigned(cert); err != nil {
+		return err
+	}
+	return c.audit(OpImportIntermediate, intermediate.GetName(), cert.SerialNumber)
+}
+
+// SignIntermediate signs the provided certificate signing request with the
+// root key, returning an intermediate CA certificate valid for ttl. This is
+// run against the offline store holding the root key.
+func (c *Client) SignIntermediate(csr *x509.CertificateRequest, ttl time.Duration) (*x509.Certificate, error) {
+	root, err := c.existingCA()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := root.SignRequest(csr, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return cert, c.audit(OpSignIntermediate, csr.Subject.CommonName, cert.SerialNumber)
+}
+
+// SignCRL re-signs the root certificate revocation list with the root key
+// and returns it DER encoded, for import into online stores with ImportCRL.
+func (c *Client) SignCRL() ([]byte, error) {
+	root, err := c.existingCA()
+	if err != nil {
+		return nil, err
+	}
+	crl, err := root.SignCRL()
+	if err != nil {
+		return nil, err
+	}
+	return crl, c.audit(OpSignCRL, root.GetName(), nil)
+}
+
+// ImportCRL stores a DER encoded root certificate revocation list signed by
+// the offline root.
+func (c *Client) ImportCRL(der []byte) error {
+	root, err := c.existingCA()
+	if err != nil {
+		return err
+	}
+	if err := root.ImportCRL(der); err != nil {
+		return err
+	}
+	return c.audit(OpImportCRL, root.GetName(), nil)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/ovrclk/authority/authority"
+)
+
+// Renew reissues the certificate with the provided common name from the CA
+// that issued it, with a new key and serial number and the subject, SANs and
+// lifetime of the current certificate. Certificates issued by a CA whose key
+// has since been rolled over are renewed by its replacement. Revoked
+// certificates are not renewed. The replaced certificate is kept as a
+// previous version.
+func (c *Client) Renew(name string) (*Certificate, error) {
+	cert := c.cert(name)
+	if !cert.Exists() {
+		return nil, authority.ErrCertNotFound
+	}
+
+	cas, err := authority.LoadCAs(c.backend)
+	if err != nil {
+		return nil, err
+	}
+	parentName := authority.IssuerName(cert.GetCertificate(), cas)
+	if parentName == "" {
+		return nil, fmt.Errorf("authority: cannot find the issuer of %s", cert.GetName())
+	}
+	if err := c.checkHierarchy(parentName); err != nil {
+		return nil, err
+	}
+	if c.cert(parentName).IsRevoked(cert.GetCertificate().SerialNumber) {
+		return nil, fmt.Errorf("authority: %s is revoked and cannot be renewed", cert.GetName())
+	}
+	parent := c.cert(strings.TrimSuffix(parentName, authority.PreviousSuffix))
+	if _, err := parent.CompleteRollover(); err != nil {
+		return nil, err
+	}
+
+	renewed, err := cert.Renew(parent)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.audit(OpRenew, cert.GetName(), renewed.SerialNumber); err != nil {
+		return nil, err
+	}
+	return c.get(name)
+}
+
+// RenewalWindow returns how long before its expiry cert is renewed: within,
+// clamped to two thirds of the certificate's lifetime so that a certificate
+// living shorter than the window is not renewed every time it is checked.
+func RenewalWindow(cert *x509.Certificate, within time.Duration) time.Duration {
+	if max := cert.NotAfter.Sub(cert.NotBefore) * 2 / 3; within > max {
+		return max
+	}
+	return within
+}
+
+// RenewExpiring renews every stored leaf and intermediate whose metadata
+// matches filter and which expires within its RenewalWindow. Renewal signs
+// with the issuing CA's key, so this is run where that key may be used, such
+// as from cron on an operator's machine; hosts then only fetch the renewed
+// certificates. It returns the renewed certificates, and an error listing
+// those which could not be renewed.
+func (c *Client) RenewExpiring(within time.Duration, filter map[string]string) ([]*Certificate, error) {
+	report, err := c.ExpiryReport(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var renewed []*Certificate
+	var result error
+	for _, expiry := range report {
+		if expiry.Issuer == "" || expiry.Remaining() >= RenewalWindow(expiry.Certificate, within) {
+			continue
+		}
+		cert, err := c.Renew(expiry.Name)
+		if err != nil {
+			result = multierror.Append(result, fmt.Errorf("%s: %v", expiry.Name, err))
+			continue
+		}
+		renewed = append(renewed, cert)
+	}
+	return renewed, result
+}
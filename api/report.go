@@ -0,0 +1,71 @@
+package api
+
+import (
+	"crypto/x509"
+	"sort"
+	"time"
+
+	"github.com/ovrclk/authority/authority"
+)
+
+// Expiry describes when a stored certificate expires.
+type Expiry struct {
+	Name        string
+	Certificate *x509.Certificate
+
+	// Issuer is the name of the stored CA that signed the certificate, or
+	// empty for self-signed roots and certificates whose issuer is not
+	// stored.
+	Issuer string
+}
+
+// Remaining returns the time left until the certificate expires, negative
+// once it has expired.
+func (e *Expiry) Remaining() time.Duration {
+	return e.Certificate.NotAfter.Sub(time.Now())
+}
+
+// ExpiryReport returns every stored certificate, roots, intermediates and
+// leaves, whose metadata matches filter, sorted by issuer and then by
+// expiry. Revoked certificates and the certificates kept alongside a CA
+// during a rollover are left out.
+func (c *Client) ExpiryReport(filter map[string]string) ([]*Expiry, error) {
+	certs, err := c.List(filter)
+	if err != nil {
+		return nil, err
+	}
+	cas, err := authority.LoadCAs(c.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	var report []*Expiry
+	for _, cert := range certs {
+		if authority.IsRolloverName(cert.CommonName) {
+			continue
+		}
+		issuer := authority.IssuerName(cert.Certificate, cas)
+		if issuer != "" && c.cert(issuer).IsRevoked(cert.Certificate.SerialNumber) {
+			continue
+		}
+		report = append(report, &Expiry{
+			Name:        cert.CommonName,
+			Certificate: cert.Certificate,
+			Issuer:      issuer,
+		})
+	}
+
+	sort.Sort(byIssuerAndExpiry(report))
+	return report, nil
+}
+
+type byIssuerAndExpiry []*Expiry
+
+func (r byIssuerAndExpiry) Len() int      { return len(r) }
+func (r byIssuerAndExpiry) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r byIssuerAndExpiry) Less(i, j int) bool {
+	if r[i].Issuer != r[j].Issuer {
+		return r[i].Issuer < r[j].Issuer
+	}
+	return r[i].Certificate.NotAfter.Before(r[j].Certificate.NotAfter)
+}
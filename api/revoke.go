@@ -0,0 +1,279 @@
+package api
+
+import (
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ovrclk/authority/authority"
+)
+
+// RevokeOptions holds the optional settings used when revoking a
+// certificate.
+type RevokeOptions struct {
+	// Reason is the RFC 5280 reason code recorded for the certificate.
+	Reason int
+
+	// Cascade also revokes every certificate issued below the certificate,
+	// with reason cACompromise.
+	Cascade bool
+
+	// Version selects a version of the certificate, as numbered by History.
+	// Zero selects the current version. Revoking a previous version leaves
+	// the backend access tokens alone and cannot cascade.
+	Version int
+}
+
+// RevokeWithOptions adds the certificate with the provided common name to
+// the certificate revocation list of the CA that issued it, and revokes its
+// backend access tokens. It returns the names of all certificates revoked.
+func (c *Client) RevokeWithOptions(name string, opts *RevokeOptions) ([]string, error) {
+	if opts == nil {
+		opts = &RevokeOptions{}
+	}
+
+	cert := c.cert(name)
+	if !cert.Exists() {
+		return nil, authority.ErrCertNotFound
+	}
+
+	if opts.Version != 0 {
+		version, err := c.GetVersion(name, opts.Version)
+		if err != nil {
+			return nil, err
+		}
+		if !version.Current {
+			if opts.Cascade {
+				return nil, fmt.Errorf("authority: only the current version of %s can be revoked with cascade", name)
+			}
+			if err := c.RevokeCertificate(version.Certificate, opts.Reason); err != nil {
+				return nil, err
+			}
+			return []string{cert.GetName()}, nil
+		}
+	}
+
+	cas, err := authority.LoadCAs(c.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked := []string{}
+	if err := c.revokeIssued(cert, opts.Reason, cas); err != nil {
+		return revoked, err
+	}
+	revoked = append(revoked, cert.GetName())
+
+	if !opts.Cascade {
+		return revoked, nil
+	}
+
+	descendants, err := c.descendants(cert.GetName(), cas)
+	if err != nil {
+		return revoked, err
+	}
+	for _, descendant := range descendants {
+		if err := c.revokeIssued(c.cert(descendant), authority.ReasonCACompromise, cas); err != nil {
+			return revoked, err
+		}
+		revoked = append(revoked, descendant)
+	}
+	return revoked, nil
+}
+
+// RevokeCertificate adds the provided certificate to the certificate
+// revocation list of the stored CA that signed it. The certificate does not
+// need to be in the store, so certificates that were overwritten or lost can
+// still be revoked.
+func (c *Client) RevokeCertificate(cert *x509.Certificate, reason int) error {
+	cas, err := authority.LoadCAs(c.backend)
+	if err != nil {
+		return err
+	}
+	issuerName := authority.IssuerName(cert, cas)
+	if issuerName == "" {
+		return fmt.Errorf("authority: certificate %s is not signed by any stored CA", cert.Subject.CommonName)
+	}
+	if err := c.cert(issuerName).RevokeWithReason(cert, reason); err != nil {
+		return err
+	}
+	return c.audit(OpRevoke, cert.Subject.CommonName, cert.SerialNumber)
+}
+
+// RevokeSerial adds the provided serial number to the certificate
+// revocation list of the CA with the provided name, or of the selected CA if
+// issuer is empty. The certificate does not need to be in the store.
+func (c *Client) RevokeSerial(issuer string, serial *big.Int, reason int) error {
+	if issuer == "" {
+		issuer = c.caName()
+	}
+	ca := c.cert(issuer)
+	if !ca.Exists() {
+		return fmt.Errorf("authority: issuer %s does not exist", issuer)
+	}
+	if !ca.GetCertificate().IsCA {
+		return fmt.Errorf("authority: issuer %s is not a CA certificate", issuer)
+	}
+	if serial.Sign() <= 0 {
+		return fmt.Errorf("authority: invalid serial number %s", serial)
+	}
+	if err := ca.RevokeSerial(serial, reason); err != nil {
+		return err
+	}
+	return c.audit(OpRevoke, ca.GetName(), serial)
+}
+
+// Hold suspends the certificate with the provided common name by adding it
+// to its issuer's certificate revocation list with reason certificateHold,
+// until it is released with Release. Its tokens are left untouched.
+func (c *Client) Hold(name string) error {
+	cert, issuer, err := c.certAndIssuer(name)
+	if err != nil {
+		return err
+	}
+	if err := issuer.Hold(cert.GetCertificate()); err != nil {
+		return err
+	}
+	return c.audit(OpHold, cert.GetName(), cert.GetCertificate().SerialNumber)
+}
+
+// Release lifts a hold placed with Hold, removing the certificate with the
+// provided common name from its issuer's certificate revocation list.
+func (c *Client) Release(name string) error {
+	cert, issuer, err := c.certAndIssuer(name)
+	if err != nil {
+		return err
+	}
+	if err := issuer.Release(cert.GetCertificate()); err != nil {
+		return err
+	}
+	return c.audit(OpRelease, cert.GetName(), cert.GetCertificate().SerialNumber)
+}
+
+// GetCRL returns the DER encoded certificate revocation list of the CA with
+// the provided name. A CRL is signed if the CA has none yet.
+func (c *Client) GetCRL(name string) ([]byte, error) {
+	ca := c.cert(name)
+	if !ca.Exists() {
+		return nil, authority.ErrCertNotFound
+	}
+	if !ca.GetCertificate().IsCA {
+		return nil, fmt.Errorf("authority: %s is not a CA certificate", name)
+	}
+	if crl := ca.GetCRLRaw(); len(crl) > 0 {
+		return crl, nil
+	}
+	return ca.SignCRL()
+}
+
+// certAndIssuer returns the existing certificate with the provided name and
+// the CA that issued it.
+func (c *Client) certAndIssuer(name string) (*authority.Cert, *authority.Cert, error) {
+	cert := c.cert(name)
+	if !cert.Exists() {
+		return nil, nil, authority.ErrCertNotFound
+	}
+	cas, err := authority.LoadCAs(c.backend)
+	if err != nil {
+		return nil, nil, err
+	}
+	issuer, err := c.issuer(cert, cas)
+	return cert, issuer, err
+}
+
+// issuer returns the CA in cas that issued cert.
+func (c *Client) issuer(cert *authority.Cert, cas map[string]*x509.Certificate) (*authority.Cert, error) {
+	issuerName := authority.IssuerName(cert.GetCertificate(), cas)
+	if issuerName == "" {
+		return nil, fmt.Errorf("authority: cannot find the issuer of %s", cert.GetName())
+	}
+	return c.cert(issuerName), nil
+}
+
+// revokeIssued revokes cert on its issuer's CRL and revokes its tokens.
+func (c *Client) revokeIssued(cert *authority.Cert, reason int, cas map[string]*x509.Certificate) error {
+	issuer, err := c.issuer(cert, cas)
+	if err != nil {
+		return err
+	}
+
+	err = issuer.RevokeWithReason(cert.GetCertificate(), reason)
+	if err != nil {
+		return fmt.Errorf("authority: unable to revoke certificate %s: %v", cert.GetName(), err)
+	}
+
+	err = c.backend.RevokeTokensForCertificate(cert.GetName())
+	if err != nil {
+		return fmt.Errorf("authority: certificate %s revoked, but unable to revoke its tokens %v", cert.GetName(), err)
+	}
+	return c.audit(OpRevoke, cert.GetName(), cert.GetCertificate().SerialNumber)
+}
+
+// descendants returns the names of all stored certificates issued below the
+// CA with the provided name, parents before their children. The generations
+// of a CA kept alongside it during a rollover count as the CA, so their
+// certificates, and the certificates they issued, are included.
+func (c *Client) descendants(name string, cas map[string]*x509.Certificate) ([]string, error) {
+	names, err := c.backend.ListCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	certs := map[string]*x509.Certificate{}
+	children := map[string][]string{}
+	generations := map[string][]string{}
+	for _, n := range names {
+		if strings.HasSuffix(n, authority.CrossNewSuffix) || strings.HasSuffix(n, authority.CrossOldSuffix) {
+			continue
+		}
+		cert := c.cert(n).GetCertificate()
+		if cert == nil {
+			continue
+		}
+		certs[n] = cert
+		if base := rolloverBase(n); base != n {
+			generations[base] = append(generations[base], n)
+		}
+		issuer := authority.IssuerName(cert, cas)
+		children[issuer] = append(children[issuer], n)
+	}
+
+	// a completed rollover stores the same certificate under two names, so
+	// certificates are only revoked once
+	var found []string
+	seen := map[string]bool{}
+	if cert, ok := certs[name]; ok {
+		seen[string(cert.Raw)] = true
+	}
+	add := func(n string) bool {
+		raw := string(certs[n].Raw)
+		if seen[raw] {
+			return false
+		}
+		seen[raw] = true
+		found = append(found, n)
+		return true
+	}
+
+	queue := []string{name}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		issuers := []string{parent}
+		for _, generation := range generations[parent] {
+			if add(generation) {
+				queue = append(queue, generation)
+			}
+			issuers = append(issuers, generation)
+		}
+		for _, issuer := range issuers {
+			for _, child := range children[issuer] {
+				if add(child) {
+					queue = append(queue, child)
+				}
+			}
+		}
+	}
+	return found, nil
+}
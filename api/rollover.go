@@ -0,0 +1,136 @@
+package api
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/ovrclk/authority/authority"
+)
+
+// Rollover replaces the key of the CA with the provided name, either the
+// selected root or an intermediate, with a new key that takes over issuance
+// at switchAt. The replacement is valid for ttl, or for the lifetime of the
+// current certificate if ttl is zero. A root is cross-signed with its
+// replacement in both directions.
+func (c *Client) Rollover(name string, switchAt time.Time, ttl time.Duration) (*authority.Rollover, error) {
+	cert := c.cert(name)
+	if !cert.Exists() {
+		return nil, authority.ErrCertNotFound
+	}
+
+	var parent *authority.Cert
+	if !cert.IsRoot() {
+		cas, err := authority.LoadCAs(c.backend)
+		if err != nil {
+			return nil, err
+		}
+		parentName := authority.IssuerName(cert.GetCertificate(), cas)
+		if parentName == "" {
+			return nil, fmt.Errorf("authority: cannot find the issuer of %s", name)
+		}
+		if err := c.checkHierarchy(parentName); err != nil {
+			return nil, err
+		}
+		parent = c.cert(parentName)
+	}
+
+	r, err := cert.Rollover(parent, switchAt, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return r, c.audit(OpRollover, cert.GetName(), r.Next.SerialNumber)
+}
+
+// TrustBundle returns the root certificates to trust for the selected
+// hierarchy: the current root, a pending replacement root, and the root it
+// replaced while that is still valid.
+func (c *Client) TrustBundle() ([]*x509.Certificate, error) {
+	root, err := c.loadCA()
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := []*x509.Certificate{root.GetCertificate()}
+	if root.RolloverPending() {
+		bundle = append(bundle, c.cert(root.GetName()+authority.NextSuffix).GetCertificate())
+	}
+	previous := c.cert(root.GetName() + authority.PreviousSuffix)
+	if previous.Exists() && authority.IsActive(previous.GetCertificate()) {
+		bundle = append(bundle, previous.GetCertificate())
+	}
+	return bundle, nil
+}
+
+// TrustStore returns the root certificates of TrustBundle keyed by their
+// stored names, for use as keystore aliases.
+func (c *Client) TrustStore() (map[string]*x509.Certificate, error) {
+	bundle, err := c.TrustBundle()
+	if err != nil {
+		return nil, err
+	}
+
+	store := map[string]*x509.Certificate{}
+	name := c.caName()
+	for _, cert := range bundle {
+		for _, candidate := range []string{name, name + authority.NextSuffix, name + authority.PreviousSuffix} {
+			stored := c.cert(candidate)
+			if stored.Exists() && stored.GetCertificate().Equal(cert) {
+				store[candidate] = cert
+				break
+			}
+		}
+	}
+	return store, nil
+}
+
+// RolloverReport returns the active, unrevoked certificates which chain only
+// to the key replaced by the selected root's rollover: the current key while
+// the rollover is pending, or the previous key once it has completed. They
+// must be reissued before the old root expires.
+func (c *Client) RolloverReport() ([]*Certificate, error) {
+	root, err := c.loadCA()
+	if err != nil {
+		return nil, err
+	}
+
+	var old *x509.Certificate
+	if root.RolloverPending() {
+		old = root.GetCertificate()
+	} else if previous := c.cert(root.GetName() + authority.PreviousSuffix); previous.Exists() {
+		old = previous.GetCertificate()
+	} else {
+		return nil, fmt.Errorf("authority: %s has not been rolled over", root.GetName())
+	}
+
+	cas, err := authority.LoadCAs(c.backend)
+	if err != nil {
+		return nil, err
+	}
+	names, err := c.backend.ListCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	var report []*Certificate
+	for _, name := range names {
+		cert := c.cert(name)
+		if cert.IsRoot() || authority.IsRolloverName(name) {
+			continue
+		}
+		certificate := cert.GetCertificate()
+		if certificate == nil || !authority.IsActive(certificate) {
+			continue
+		}
+
+		top := authority.RootOf(certificate, cas)
+		if top == nil || !top.Equal(old) {
+			continue
+		}
+		if issuer := authority.IssuerName(certificate, cas); issuer != "" && c.cert(issuer).IsRevoked(certificate.SerialNumber) {
+			continue
+		}
+		report = append(report, &Certificate{CommonName: name, Certificate: certificate})
+	}
+	return report, nil
+}
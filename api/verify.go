@@ -0,0 +1,258 @@
+package api
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ovrclk/authority/authority"
+)
+
+// Purposes a certificate can be verified for.
+const (
+	PurposeServer = "server"
+	PurposeClient = "client"
+)
+
+// VerifyOptions are the checks made by VerifyCertificate beyond its chain,
+// validity and revocation. Empty fields are not checked.
+type VerifyOptions struct {
+	// Name is the stored name the certificate must be the current
+	// version of.
+	Name string
+
+	// Purpose is one of the Purpose constants.
+	Purpose string
+
+	// Host is a DNS name or IP address the certificate must be valid for.
+	Host string
+}
+
+// Verification is the result of VerifyCertificate.
+type Verification struct {
+	// Chain lists the names of the stored CAs above the certificate, from
+	// its issuer up to the root, if a valid path to a stored root was found.
+	Chain []string `json:"chain"`
+
+	// Valid is set if no problems were found.
+	Valid bool `json:"valid"`
+
+	// Problems explains each reason the certificate is not valid.
+	Problems []string `json:"problems"`
+}
+
+func (v *Verification) problem(format string, args ...interface{}) {
+	v.Problems = append(v.Problems, fmt.Sprintf(format, args...))
+}
+
+// VerifyCertificate checks that the provided certificate chains to a stored
+// root through stored CAs, as x509 path validation does, including basic
+// constraints, path lengths, name constraints and extended key usages, that
+// it and its issuers are within their validity periods, that no issuer's CRL
+// lists the certificate below it and that each CRL is current, along with
+// the checks in opts. Problems found are reported in the Verification; an
+// error is only returned if the store could not be read.
+func (c *Client) VerifyCertificate(cert *x509.Certificate, opts *VerifyOptions) (*Verification, error) {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+	if opts.Purpose != "" && opts.Purpose != PurposeServer && opts.Purpose != PurposeClient {
+		return nil, fmt.Errorf("authority: unknown purpose %s, expected %s or %s", opts.Purpose, PurposeServer, PurposeClient)
+	}
+	cas, err := authority.LoadCAs(c.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Verification{Chain: []string{}}
+	now := time.Now()
+	checkValidity(v, "certificate", cert, now)
+	if opts.Purpose != "" {
+		checkPurpose(v, cert, opts.Purpose)
+	}
+
+	usage := x509.ExtKeyUsageAny
+	switch opts.Purpose {
+	case PurposeServer:
+		usage = x509.ExtKeyUsageServerAuth
+	case PurposeClient:
+		usage = x509.ExtKeyUsageClientAuth
+	}
+	chain, err := buildChain(cert, cas, usage, now)
+	if invalid, ok := err.(x509.CertificateInvalidError); ok && invalid.Reason == x509.IncompatibleUsage {
+		// the purpose is reported above if the certificate itself forbids
+		// it, otherwise one of its CAs does
+		if len(v.Problems) == 0 {
+			v.problem("certificate chain is not allowed for %s authentication: %v", opts.Purpose, err)
+		}
+		chain, err = buildChain(cert, cas, x509.ExtKeyUsageAny, now)
+	}
+	switch err.(type) {
+	case nil:
+	case x509.UnknownAuthorityError:
+		v.problem("certificate does not chain to a stored root: %v", err)
+	default:
+		v.problem("certificate chain is not valid: %v", err)
+	}
+
+	for i := 1; i < len(chain); i++ {
+		ca, issued := chain[i], chain[i-1]
+		name := authority.IssuerName(issued, cas)
+		v.Chain = append(v.Chain, name)
+		checkValidity(v, "CA "+name, ca, now)
+		if ca.KeyUsage != 0 && ca.KeyUsage&x509.KeyUsageCertSign == 0 {
+			v.problem("CA %s is not allowed to sign certificates", name)
+		}
+		c.checkCRL(v, name, ca, issued, now)
+	}
+
+	if opts.Host != "" {
+		if err := cert.VerifyHostname(opts.Host); err != nil {
+			v.problem("certificate is not valid for host %s, it is valid for %s", opts.Host, strings.Join(hostNames(cert), ", "))
+		}
+	}
+	if opts.Name != "" {
+		if err := c.checkName(v, cert, opts.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	v.Valid = len(v.Problems) == 0
+	return v, nil
+}
+
+// buildChain verifies cert with the self-signed CAs in cas as roots and the
+// others as intermediates, returning the chain from cert up to its root.
+// Validity periods are checked separately with more helpful messages, so if
+// a certificate in the chain has expired or is not yet valid the chain is
+// built as of the last, then the first, moment cert itself is valid.
+func buildChain(cert *x509.Certificate, cas map[string]*x509.Certificate, usage x509.ExtKeyUsage, now time.Time) ([]*x509.Certificate, error) {
+	roots := x509.NewCertPool()
+	intermediates := x509.NewCertPool()
+	for _, ca := range cas {
+		if authority.IsSelfSigned(ca) {
+			roots.AddCert(ca)
+		} else {
+			intermediates.AddCert(ca)
+		}
+	}
+
+	var first error
+	for _, at := range []time.Time{now, cert.NotAfter, cert.NotBefore} {
+		chains, err := cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   at,
+			KeyUsages:     []x509.ExtKeyUsage{usage},
+		})
+		if err == nil {
+			return chains[0], nil
+		}
+		if first == nil {
+			first = err
+		}
+		if invalid, ok := err.(x509.CertificateInvalidError); !ok || invalid.Reason != x509.Expired {
+			return nil, err
+		}
+	}
+	return nil, first
+}
+
+func checkValidity(v *Verification, what string, cert *x509.Certificate, now time.Time) {
+	switch {
+	case now.Before(cert.NotBefore):
+		v.problem("%s is not valid before %s", what, cert.NotBefore.Format(time.RFC3339))
+	case now.After(cert.NotAfter):
+		v.problem("%s expired on %s", what, cert.NotAfter.Format(time.RFC3339))
+	}
+}
+
+// checkCRL checks the CRL of the CA stored as name, which signed issued.
+// A CA which has never revoked a certificate has no CRL.
+func (c *Client) checkCRL(v *Verification, name string, ca, issued *x509.Certificate, now time.Time) {
+	raw := c.cert(name).GetCRLRaw()
+	if len(raw) == 0 {
+		return
+	}
+	crl, err := x509.ParseCRL(raw)
+	if err != nil {
+		v.problem("CRL of %s cannot be parsed: %v", name, err)
+		return
+	}
+	if err := ca.CheckCRLSignature(crl); err != nil {
+		v.problem("CRL of %s is not signed by it", name)
+		return
+	}
+	if crl.HasExpired(now) {
+		v.problem("CRL of %s expired on %s", name, crl.TBSCertList.NextUpdate.Format(time.RFC3339))
+	}
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(issued.SerialNumber) != 0 {
+			continue
+		}
+		what := "certificate"
+		if issued.IsCA {
+			what = "CA " + issued.Subject.CommonName
+		}
+		if authority.RevocationReason(revoked) == authority.ReasonCertificateHold {
+			v.problem("%s is on hold on the CRL of %s since %s", what, name, revoked.RevocationTime.Format(time.RFC3339))
+		} else {
+			v.problem("%s was revoked by %s on %s", what, name, revoked.RevocationTime.Format(time.RFC3339))
+		}
+	}
+}
+
+func checkPurpose(v *Verification, cert *x509.Certificate, purpose string) {
+	usage := x509.ExtKeyUsageServerAuth
+	if purpose == PurposeClient {
+		usage = x509.ExtKeyUsageClientAuth
+	}
+	// a certificate without extended key usages may be used for anything
+	allowed := len(cert.ExtKeyUsage) == 0 && len(cert.UnknownExtKeyUsage) == 0
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage || u == x509.ExtKeyUsageAny {
+			allowed = true
+		}
+	}
+	if !allowed {
+		v.problem("certificate is not allowed for %s authentication, its extended key usages are %s", purpose, strings.Join(extKeyUsages(cert), ", "))
+	}
+	if cert.KeyUsage != 0 && cert.KeyUsage&(x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment) == 0 {
+		v.problem("certificate key usage allows neither digitalSignature nor keyEncipherment")
+	}
+}
+
+func hostNames(cert *x509.Certificate) []string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	if len(names) == 0 {
+		names = append(names, "no hosts")
+	}
+	return names
+}
+
+// checkName checks that cert is the certificate currently stored as name.
+func (c *Client) checkName(v *Verification, cert *x509.Certificate, name string) error {
+	versions, err := c.History(name)
+	if err == authority.ErrCertNotFound {
+		v.problem("no certificate is stored as %s", name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, version := range versions {
+		if !version.Certificate.Equal(cert) {
+			continue
+		}
+		if !version.Current {
+			v.problem("certificate is version %d of %s, superseded by version %d", version.Number, name, len(versions))
+		}
+		return nil
+	}
+	v.problem("certificate is not one stored as %s", name)
+	return nil
+}
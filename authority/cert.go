@@ -1,7 +1,7 @@
 package authority
 
 import (
-	"crypto/rand"
+	"crypto"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
@@ -22,7 +22,38 @@ type Cert struct {
 	ParentName  string
 	DNSNames    []string
 	IPAddresses []net.IP
-
+	Subject     Subject
+
+	// Profile selects the key usages of the certificate, KeyBits the size
+	// of its private key, and TTL its validity period. Zero values use the
+	// defaults.
+	Profile string
+	KeyBits int
+	TTL     time.Duration
+
+	// KeyInBackend generates the private key inside the backend, which
+	// must implement backend.KeyHolder. The key is never exported, and all
+	// signatures are made by the backend.
+	KeyInBackend bool
+
+	// PublicKey, if set, is certified instead of a generated key, and only
+	// the certificate is stored, for keys kept in a device or elsewhere.
+	// Key, if set, is certified and stored instead of a generated key.
+	PublicKey crypto.PublicKey
+	Key       *rsa.PrivateKey
+
+	// CA names the root of the hierarchy this Cert belongs to, which
+	// determines its serial number sequence and default parent. An empty
+	// CA is the default root, DefaultCA.
+	CA string
+
+	// Signers provides in-process signers for CA keys which are not kept in
+	// the backend, keyed by CA name. SignerConfigs are opened for names not
+	// found here.
+	Signers       Signers
+	SignerConfigs SignerConfigs
+
+	signer      crypto.Signer
 	certificate *x509.Certificate
 	privateKey  *rsa.PrivateKey
 	crl         *pkix.CertificateList
@@ -31,23 +62,36 @@ type Cert struct {
 	*config.Config
 }
 
+// DefaultCA is the name of the root certificate used when no other root CA
+// is selected.
+const DefaultCA = "ca"
+
 // GetCA returns the root certificate, creating it if it does not already
 // exist.
 func GetCA(backend backend.Backend, config *config.Config) (*Cert, error) {
-	return GetCert("ca", backend, config)
+	return GetCert(DefaultCA, backend, config)
 }
 
 // GetCertificate returns the certificate with the supplied if it already exists.
 func GetCert(name string, backend backend.Backend, config *config.Config) (*Cert, error) {
+	return GetCertWithSigners(name, backend, config, nil, nil)
+}
+
+// GetCertWithSigners returns the certificate with the supplied name if it
+// already exists, using the provided signers and signer configurations for
+// CA keys kept outside the backend.
+func GetCertWithSigners(name string, backend backend.Backend, config *config.Config, signers Signers, configs SignerConfigs) (*Cert, error) {
 	cert := &Cert{
-		CommonName: name,
-		Backend:    backend,
-		Config:     config,
+		CommonName:    name,
+		Backend:       backend,
+		Config:        config,
+		Signers:       signers,
+		SignerConfigs: configs,
 	}
 
-	// we'll implicitly make a CA cert
+	// we'll implicitly make a CA cert, unless the root is kept offline
 	if !cert.Exists() {
-		if name == "ca" {
+		if name == DefaultCA {
 			err := cert.Create()
 			if err != nil {
 				return nil, err
@@ -60,12 +104,18 @@ func GetCert(name string, backend backend.Backend, config *config.Config) (*Cert
 	return cert, nil
 }
 
-// Load the certificate and private key from the backend.
+// Load the certificate and private key from the backend. Certificates whose
+// key is held elsewhere, or is offline, are loaded without a private key.
 func (c *Cert) load() {
 	var err error
 	if c.certificate, err = c.Backend.GetCertificate(c.GetName()); err != nil {
 		return
 	}
+	if !c.Backend.CheckPrivateKeyExists(c.GetName()) {
+		// the key is held by the backend or a signer, or is offline
+		c.loaded = true
+		return
+	}
 	if c.privateKey, err = c.Backend.GetPrivateKey(c.GetName()); err != nil {
 		return
 	}
@@ -80,9 +130,41 @@ func (c *Cert) store() error {
 		}
 	}
 
+	if c.privateKey == nil {
+		return nil
+	}
 	return c.Backend.PutPrivateKey(c.GetName(), c.privateKey)
 }
 
+// KeyIsHeld returns whether this Cert's private key is held by the backend or
+// an external signer rather than stored, in which case it cannot be exported.
+func (c *Cert) KeyIsHeld() bool {
+	if c.hasExternalSigner() {
+		return true
+	}
+	holder, ok := c.Backend.(backend.KeyHolder)
+	return ok && holder.CheckHeldKeyExists(c.GetName())
+}
+
+// GetSigner returns a crypto.Signer for this Cert's private key, which is
+// either an external signer, the stored private key or a signer for a key
+// held by the backend.
+func (c *Cert) GetSigner() (crypto.Signer, error) {
+	if c.hasExternalSigner() {
+		return c.getExternalSigner()
+	}
+	if key := c.GetPrivateKey(); key != nil {
+		return key, nil
+	}
+	if holder, ok := c.Backend.(backend.KeyHolder); ok && holder.CheckHeldKeyExists(c.GetName()) {
+		return holder.GetHeldKey(c.GetName())
+	}
+	if c.IsPublicOnly() {
+		return nil, ErrKeyOffline
+	}
+	return nil, ErrKeyMissing
+}
+
 // GetCertificate returns the certificate for this Cert, loading it if
 // neccesary in the process.
 func (c *Cert) GetCertificate() *x509.Certificate {
@@ -110,36 +192,7 @@ func (c *Cert) GetCRLRaw() []byte {
 // Revoke adds the provided certificate to this Cert's CRL. If this Cert is
 // not a root certificate, it will return an error.
 func (c *Cert) Revoke(cert *x509.Certificate) error {
-	bytes := c.GetCRLRaw()
-	if len(bytes) == 0 {
-		c.crl = &pkix.CertificateList{}
-	} else {
-		var err error
-		c.crl, err = x509.ParseCRL(bytes)
-		if err != nil {
-			return err
-		}
-	}
-
-	revocation := pkix.RevokedCertificate{
-		SerialNumber:   cert.SerialNumber,
-		RevocationTime: time.Now().UTC(),
-	}
-
-	currentlyRevoked := c.crl.TBSCertList.RevokedCertificates
-	currentlyRevoked = append(currentlyRevoked, revocation)
-
-	ca := c.GetCertificate()
-	key := c.GetPrivateKey()
-
-	if key == nil {
-		return fmt.Errorf("authority: can't load private key")
-	}
-
-	newCRL, _ := ca.CreateCRL(rand.Reader, key, currentlyRevoked, time.Now().UTC(), time.Now().UTC().AddDate(10, 0, 0))
-	c.Backend.PutCRL(c.CommonName, newCRL)
-
-	return nil
+	return c.RevokeWithReason(cert, ReasonUnspecified)
 }
 
 // Create creates the certificate and private key for this Cert.
@@ -154,10 +207,14 @@ func (c *Cert) Create() error {
 		return nil
 	}
 
+	if c.IsRoot() && c.Config != nil && c.Config.Policy.OfflineRoot {
+		return ErrRootOffline
+	}
+
 	var err error
 
 	if c.certificate, c.privateKey, err = ssl.CreateCertificate(); err != nil {
-		return fmt.Errorf("authority: %v", err)
+		return err
 	}
 
 	c.loaded = true
@@ -175,7 +232,20 @@ func (c *Cert) Exists() bool {
 	return c.Backend.CheckCertificateExists(c.GetName())
 }
 
+// GetCAName returns the name of the root of this Cert's hierarchy.
+func (c *Cert) GetCAName() string {
+	if c.CA == "" {
+		return DefaultCA
+	}
+	return strings.Replace(strings.ToLower(c.CA), " ", "-", -1)
+}
+
+// IsRoot returns whether this Cert is the root of its hierarchy.
+func (c *Cert) IsRoot() bool {
+	return c.GetName() == c.GetCAName()
+}
+
 // determines whether a root certificate has been created
 func (c *Cert) rootCertMissing() bool {
-	return c.Backend.CheckCertificateExists("ca")
+	return !c.Backend.CheckCertificateExists(c.GetCAName())
 }
@@ -1,7 +1,14 @@
 package authority
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"fmt"
 	"io/ioutil"
 	"testing"
@@ -139,6 +146,52 @@ func TestRevokeCert(t *testing.T) {
 	}
 }
 
+func TestHoldCert(t *testing.T) {
+	backend, config := testAuthorityConfig(t)
+	cert := &Cert{
+		CommonName: "laptop",
+		Backend:    backend,
+		Config:     config,
+	}
+	if err := cert.Create(); err != nil {
+		t.Fatal("can't create certificate", err)
+	}
+	serial := cert.GetCertificate().SerialNumber
+
+	ca, _ := GetCA(backend, config)
+	if err := ca.Release(cert.GetCertificate()); err != ErrCertNotOnHold {
+		t.Fatal("expected error releasing a certificate not on hold")
+	}
+
+	if err := ca.Hold(cert.GetCertificate()); err != nil {
+		t.Fatal("can't hold certificate", err)
+	}
+	crlList, err := x509.ParseCRL(ca.GetCRLRaw())
+	if err != nil {
+		t.Fatal("error parsing CRL:", err)
+	}
+	entries := crlList.TBSCertList.RevokedCertificates
+	if len(entries) != 1 || RevocationReason(entries[0]) != ReasonCertificateHold {
+		t.Fatal("expected certificate on hold in revocation list")
+	}
+
+	if err := ca.Release(cert.GetCertificate()); err != nil {
+		t.Fatal("can't release certificate", err)
+	}
+	if ca.IsRevoked(serial) {
+		t.Fatal("expected released certificate removed from revocation list")
+	}
+
+	// a hold can become a permanent revocation, which cannot be released
+	ca.Hold(cert.GetCertificate())
+	if err := ca.RevokeWithReason(cert.GetCertificate(), ReasonKeyCompromise); err != nil {
+		t.Fatal("can't revoke certificate", err)
+	}
+	if err := ca.Release(cert.GetCertificate()); err != ErrCertRevoked {
+		t.Fatal("expected error releasing a revoked certificate")
+	}
+}
+
 func TestLoadCert(t *testing.T) {
 	backend, config := testAuthorityConfig(t)
 	cert := &Cert{
@@ -329,3 +382,203 @@ func TestRevokeChainedCert(t *testing.T) {
 		t.Fatal("root cert should have empty crl, but it doesnt")
 	}
 }
+
+func TestSubjectOverrides(t *testing.T) {
+	backend, config := testAuthorityConfig(t)
+	cert := &Cert{
+		CommonName: "foo",
+		Backend:    backend,
+		Config:     config,
+		Subject: Subject{
+			Organization: "override",
+			SerialNumber: "1234",
+		},
+	}
+
+	if err := cert.Create(); err != nil {
+		t.Fatal("cert creation failed:", err)
+	}
+
+	subject := cert.GetCertificate().Subject
+	if len(subject.Organization) != 1 || subject.Organization[0] != "override" {
+		t.Fatalf("expected overridden organization, got %v", subject.Organization)
+	}
+	if len(subject.Locality) != 1 || subject.Locality[0] != "sf" {
+		t.Fatalf("expected default locality, got %v", subject.Locality)
+	}
+	if subject.SerialNumber != "1234" {
+		t.Fatalf("expected subject serial number, got %s", subject.SerialNumber)
+	}
+
+	found := false
+	for _, name := range subject.Names {
+		if name.Type.Equal(oidEmailAddress) && name.Value == "user@example.com" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("expected default email address in subject")
+	}
+}
+
+func TestLockedSubject(t *testing.T) {
+	backend, config := testAuthorityConfig(t)
+	config.Policy.LockedSubject = []string{"org"}
+
+	cert := &Cert{
+		CommonName: "foo",
+		Backend:    backend,
+		Config:     config,
+		Subject:    Subject{Organization: "override"},
+	}
+
+	if err := cert.Create(); err == nil {
+		t.Fatal("expected error overriding a locked subject field")
+	}
+
+	// an extra attribute with the organization's type would override it
+	cert.Subject.Organization = ""
+	cert.Subject.ExtraNames = []pkix.AttributeTypeAndValue{{Type: asn1.ObjectIdentifier{2, 5, 4, 10}, Value: "override"}}
+	if err := cert.Create(); err == nil {
+		t.Fatal("expected error setting a subject field as an extra attribute")
+	}
+
+	cert.Subject.Organization = "foo"
+	cert.Subject.ExtraNames = nil
+	if err := cert.Create(); err != nil {
+		t.Fatal("cert creation failed:", err)
+	}
+}
+
+// heldKeyBackend is a file backend which holds private keys in memory, in the
+// way a KeyHolder such as Vault transit would.
+type heldKeyBackend struct {
+	*backend.File
+	keys map[string]*rsa.PrivateKey
+}
+
+// opaqueSigner hides the concrete private key type behind crypto.Signer.
+type opaqueSigner struct {
+	crypto.Signer
+}
+
+func (b *heldKeyBackend) CheckHeldKeyExists(name string) bool {
+	_, ok := b.keys[name]
+	return ok
+}
+
+func (b *heldKeyBackend) CreateHeldKey(name string, bits int) (crypto.Signer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+	b.keys[name] = key
+	return opaqueSigner{key}, nil
+}
+
+func (b *heldKeyBackend) GetHeldKey(name string) (crypto.Signer, error) {
+	return opaqueSigner{b.keys[name]}, nil
+}
+
+func TestHeldKeyCert(t *testing.T) {
+	fileBackend, config := testAuthorityConfig(t)
+	held := &heldKeyBackend{File: fileBackend.(*backend.File), keys: map[string]*rsa.PrivateKey{}}
+
+	ca := &Cert{
+		CommonName:   "ca",
+		Backend:      held,
+		Config:       config,
+		KeyInBackend: true,
+	}
+	if err := ca.Create(); err != nil {
+		t.Fatal("ca creation failed:", err)
+	}
+	if held.CheckPrivateKeyExists("ca") {
+		t.Fatal("held ca key should not be stored")
+	}
+
+	cert := &Cert{
+		CommonName: "foo",
+		Backend:    held,
+		Config:     config,
+	}
+	if err := cert.Create(); err != nil {
+		t.Fatal("cert creation failed:", err)
+	}
+
+	ca, err := GetCA(held, config)
+	if err != nil {
+		t.Fatal("can't get ca:", err)
+	}
+	if !ca.KeyIsHeld() || ca.GetPrivateKey() != nil {
+		t.Fatal("expected ca key to be held by the backend")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.GetCertificate())
+	if _, err := cert.GetCertificate().Verify(x509.VerifyOptions{Roots: roots}); err != nil {
+		t.Fatal("failed to verify certificate: " + err.Error())
+	}
+
+	if err := ca.Revoke(cert.GetCertificate()); err != nil {
+		t.Fatal("failed to revoke certificate:", err)
+	}
+	crl, err := x509.ParseCRL(ca.GetCRLRaw())
+	if err != nil {
+		t.Fatal("error parsing CRL:", err)
+	}
+	if err := ca.GetCertificate().CheckCRLSignature(crl); err != nil {
+		t.Fatal("bad CRL signature:", err)
+	}
+}
+
+func TestECDSASigner(t *testing.T) {
+	backend, config := testAuthorityConfig(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	signers := Signers{"ca": key}
+
+	ca := &Cert{CommonName: "ca", Backend: backend, Config: config, Signers: signers}
+	if err := ca.Create(); err != nil {
+		t.Fatal("ca creation failed:", err)
+	}
+	cert := &Cert{CommonName: "foo", Backend: backend, Config: config, Signers: signers}
+	if err := cert.Create(); err != nil {
+		t.Fatal("cert creation failed:", err)
+	}
+	if cert.GetCertificate().SignatureAlgorithm != x509.ECDSAWithSHA256 {
+		t.Fatalf("expected an ECDSA signature, got %v", cert.GetCertificate().SignatureAlgorithm)
+	}
+	for curve, expected := range map[elliptic.Curve]x509.SignatureAlgorithm{elliptic.P384(): x509.ECDSAWithSHA384, elliptic.P521(): x509.ECDSAWithSHA512} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if algorithm := signatureAlgorithm(key.Public()); algorithm != expected {
+			t.Fatalf("expected %v for %s, got %v", expected, curve.Params().Name, algorithm)
+		}
+	}
+
+	renewed, err := cert.Renew(ca)
+	if err != nil {
+		t.Fatal("renewal failed:", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.GetCertificate())
+	if _, err := renewed.Verify(x509.VerifyOptions{Roots: roots}); err != nil {
+		t.Fatal("failed to verify certificate: " + err.Error())
+	}
+
+	if err := ca.Revoke(renewed); err != nil {
+		t.Fatal("failed to revoke certificate:", err)
+	}
+	crl, err := x509.ParseCRL(ca.GetCRLRaw())
+	if err != nil {
+		t.Fatal("error parsing CRL:", err)
+	}
+	if err := ca.GetCertificate().CheckCRLSignature(crl); err != nil {
+		t.Fatal("bad CRL signature:", err)
+	}
+}
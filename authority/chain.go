@@ -0,0 +1,127 @@
+package authority
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ovrclk/authority/backend"
+)
+
+// maxChainLength bounds chain walks, so that a store holding certificates
+// which sign each other cannot loop.
+const maxChainLength = 10
+
+// LoadCAs returns the stored CA certificates by name. Rollover cross
+// certificates are left out, so that each chain ends at a single root.
+func LoadCAs(b backend.Backend) (map[string]*x509.Certificate, error) {
+	names, err := b.ListCertificates()
+	if err != nil {
+		return nil, err
+	}
+	cas := map[string]*x509.Certificate{}
+	for _, name := range names {
+		if isCrossName(name) {
+			continue
+		}
+		cert, err := b.GetCertificate(name)
+		if err != nil || cert == nil || !cert.IsCA {
+			continue
+		}
+		cas[name] = cert
+	}
+	return cas, nil
+}
+
+// IssuerName returns the name of the CA in cas whose key signed cert, or an
+// empty string if there is none. Self-signed certificates have no issuer.
+// CAs kept alongside a rollover are only chosen if no other CA matches.
+func IssuerName(cert *x509.Certificate, cas map[string]*x509.Certificate) string {
+	if IsSelfSigned(cert) {
+		return ""
+	}
+
+	var names []string
+	for name := range cas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	found := ""
+	for _, name := range names {
+		ca := cas[name]
+		if !bytes.Equal(cert.RawIssuer, ca.RawSubject) || cert.CheckSignatureFrom(ca) != nil {
+			continue
+		}
+		if !IsRolloverName(name) {
+			return name
+		}
+		if found == "" {
+			found = name
+		}
+	}
+	return found
+}
+
+// RootOf returns the self-signed root at the end of cert's chain through
+// cas, or nil if the chain does not end at a stored root.
+func RootOf(cert *x509.Certificate, cas map[string]*x509.Certificate) *x509.Certificate {
+	for i := 0; i < maxChainLength; i++ {
+		if IsSelfSigned(cert) {
+			return cert
+		}
+		name := IssuerName(cert, cas)
+		if name == "" {
+			return nil
+		}
+		cert = cas[name]
+	}
+	return nil
+}
+
+// IsSelfSigned returns whether cert is a self-signed root certificate.
+func IsSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// IsRevoked returns whether this Cert's CRL lists the provided serial
+// number.
+func (c *Cert) IsRevoked(serial *big.Int) bool {
+	_, revoked := c.Revocation(serial)
+	return revoked
+}
+
+// IsActive returns whether cert is within its validity period.
+func IsActive(cert *x509.Certificate) bool {
+	now := time.Now()
+	return !now.Before(cert.NotBefore) && !now.After(cert.NotAfter)
+}
+
+func isCrossName(name string) bool {
+	return strings.HasSuffix(name, CrossNewSuffix) || strings.HasSuffix(name, CrossOldSuffix)
+}
+
+// Chain returns the CA certificates in cas above cert, from its issuer up to
+// but not including the self-signed root. It fails if the chain does not end
+// at a stored root.
+func Chain(cert *x509.Certificate, cas map[string]*x509.Certificate) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for i := 0; i < maxChainLength; i++ {
+		if IsSelfSigned(cert) {
+			return chain, nil
+		}
+		name := IssuerName(cert, cas)
+		if name == "" {
+			return nil, fmt.Errorf("authority: cannot find the issuer of %s", cert.Subject.CommonName)
+		}
+		cert = cas[name]
+		if !IsSelfSigned(cert) {
+			chain = append(chain, cert)
+		}
+	}
+	return nil, fmt.Errorf("authority: certificate chain is longer than %d", maxChainLength)
+}
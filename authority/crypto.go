@@ -1,61 +1,149 @@
 package authority
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"errors"
 	"fmt"
 	"time"
+
+	"github.com/ovrclk/authority/backend"
 )
 
 const keySize = 2048
 
+// backdate is how far before issuance certificates become valid, to allow
+// for clock skew.
+const backdate = 5 * time.Minute
+
 // Crypto provides and interface for lower level x509 certificate operations.
 type Crypto struct {
 	*Cert
 }
 
-// CreateCertificate creates a new certificate and private key. The
-// certificate will be signed by the root certificate.
+// CreateCertificate creates a new certificate and private key, unless a key
+// was provided. The certificate will be signed by the root certificate.
 func (c *Crypto) CreateCertificate() (*x509.Certificate, *rsa.PrivateKey, error) {
 	if c.Cert.Config == nil {
-		return nil, nil, errors.New("configuration not available")
+		return nil, nil, ErrConfigMissing
 	}
-	d := &c.Cert.Config.Defaults
-	subject := &pkix.Name{
-		Country:            []string{d.Country},
-		Organization:       []string{d.Org},
-		OrganizationalUnit: []string{d.OrgUnit},
-		Locality:           []string{d.City},
-		Province:           []string{d.Region},
-		CommonName:         c.Cert.CommonName,
+	merged, err := c.Cert.Subject.merge(c.Cert.Config)
+	if err != nil {
+		return nil, nil, err
 	}
+	subject := merged.toName(c.Cert.CommonName)
 
-	key := c.makePrivateKey(keySize)
-	certBytes := c.makeCert(subject, key)
-	cert, err := x509.ParseCertificate(certBytes)
+	bits := c.Cert.KeyBits
+	if bits == 0 {
+		bits = keySize
+	}
+
+	var key *rsa.PrivateKey
+	var signer crypto.Signer
+	var pub crypto.PublicKey
+
+	if err := c.checkProvidedKey(bits); err != nil {
+		return nil, nil, err
+	}
+
+	if c.Cert.PublicKey != nil {
+		pub = c.Cert.PublicKey
+	} else if c.Cert.Key != nil {
+		key = c.Cert.Key
+		signer = key
+	} else if c.Cert.hasExternalSigner() {
+		if signer, err = c.Cert.getExternalSigner(); err != nil {
+			return nil, nil, err
+		}
+	} else if c.Cert.KeyInBackend {
+		holder, ok := c.Backend.(backend.KeyHolder)
+		if !ok {
+			return nil, nil, ErrBackendCannotHoldKeys
+		}
+		if signer, err = holder.CreateHeldKey(c.Cert.GetName(), bits); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		key = c.makePrivateKey(bits)
+		signer = key
+	}
+
+	if signer != nil {
+		pub = signer.Public()
+	}
+
+	certBytes, err := c.makeCert(subject, pub, signer)
 	if err != nil {
 		return nil, nil, err
 	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("authority: %v", err)
+	}
 
 	return cert, key, nil
 }
 
-func (c *Crypto) getSubject() *pkix.Name {
-	d := &c.Cert.Config.Defaults
-	subject := &pkix.Name{
-		CommonName:   c.Cert.CommonName,
-		Organization: []string{d.Org},
-		Locality:     []string{d.City},
-		Country:      []string{d.Country},
+// checkProvidedKey checks that at most one of the public key, private key
+// and key in backend options is set, and that a provided key is an RSA key
+// of at least bits when the key size was chosen, or otherwise an acceptable
+// key as checked by checkKeyStrength.
+func (c *Crypto) checkProvidedKey(bits int) error {
+	provided := c.Cert.PublicKey
+	if c.Cert.Key != nil {
+		if provided != nil {
+			return fmt.Errorf("authority: provide either a public key or a private key, not both")
+		}
+		provided = c.Cert.Key.Public()
+	}
+	if provided == nil {
+		return nil
+	}
+	if c.Cert.KeyInBackend {
+		return fmt.Errorf("authority: a provided key cannot be generated in the backend")
+	}
+	if c.Cert.PublicKey != nil && c.Cert.IsRoot() {
+		return fmt.Errorf("authority: a root is self-signed and needs its private key")
+	}
+	if c.Cert.KeyBits == 0 {
+		return checkKeyStrength(c.Cert.GetName(), provided)
+	}
+	rsaPub, ok := provided.(*rsa.PublicKey)
+	if !ok || rsaPub.N.BitLen() < bits {
+		return fmt.Errorf("authority: %s needs an RSA key of at least %d bits", c.Cert.GetName(), bits)
+	}
+	return nil
+}
+
+// checkKeyStrength checks that a key provided for name without a chosen key
+// size is an RSA key of at least keySize bits, an ECDSA key on P-256, P-384
+// or P-521, or an Ed25519 key.
+func checkKeyStrength(name string, pub crypto.PublicKey) error {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < keySize {
+			return fmt.Errorf("authority: %s needs an RSA key of at least %d bits, got %d", name, keySize, pub.N.BitLen())
+		}
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return fmt.Errorf("authority: %s needs an ECDSA key on P-256, P-384 or P-521, got %s", name, pub.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+	default:
+		return fmt.Errorf("authority: %s has an unsupported %T key, expected RSA, ECDSA or Ed25519", name, pub)
 	}
-	return subject
+	return nil
 }
 
 func (c *Crypto) makePrivateKey(bits int) *rsa.PrivateKey {
-	privateKey, err := rsa.GenerateKey(rand.Reader, keySize)
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
 		fmt.Println("error:", err)
 	}
@@ -63,28 +151,31 @@ func (c *Crypto) makePrivateKey(bits int) *rsa.PrivateKey {
 	return privateKey
 }
 
-func (c *Crypto) makeCert(subject *pkix.Name, key *rsa.PrivateKey) []byte {
+// makeCert creates a certificate for pub, signed by the parent or, for a
+// root, by key.
+func (c *Crypto) makeCert(subject *pkix.Name, pub crypto.PublicKey, key crypto.Signer) ([]byte, error) {
 	var parent *x509.Certificate = nil
-	var parentKey *rsa.PrivateKey = nil
+	var parentKey crypto.Signer = nil
 	var signingCert *Cert
 	var err error
 
 	now := time.Now()
+	notAfter := now.AddDate(10, 0, 0)
+	if c.TTL > 0 {
+		notAfter = now.Add(c.TTL)
+	}
+
 	template := x509.Certificate{
-		SerialNumber:       c.Backend.GetNextSerialNumber(),
-		Subject:            *subject,
-		SignatureAlgorithm: x509.SHA256WithRSA,
-		NotBefore:          now.Add(-5 * time.Minute).UTC(),
-		NotAfter:           now.AddDate(10, 0, 0).UTC(),
+		SerialNumber: c.Backend.GetNextSerialNumber(c.GetCAName()),
+		Subject:      *subject,
+		NotBefore:    now.Add(-backdate).UTC(),
+		NotAfter:     notAfter.UTC(),
 	}
 
-	template.KeyUsage |= x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign
-	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
-	template.IsCA = true
-	template.BasicConstraintsValid = true
+	applyProfile(&template, c.Profile, pub)
 
 	if c.ParentName == "" {
-		c.ParentName = "ca"
+		c.ParentName = c.GetCAName()
 	}
 
 	if c.DNSNames != nil {
@@ -95,24 +186,76 @@ func (c *Crypto) makeCert(subject *pkix.Name, key *rsa.PrivateKey) []byte {
 		template.IPAddresses = c.IPAddresses
 	}
 
-	if subject.CommonName == "ca" {
+	if c.IsRoot() {
 		parent = &template
 		parentKey = key
 	} else {
-		signingCert, err = GetCert(c.ParentName, c.Backend, c.Config)
+		signingCert, err = GetCertWithSigners(c.ParentName, c.Backend, c.Config, c.Signers, c.SignerConfigs)
 		if err != nil {
-			return nil
+			return nil, err
 		}
 		parent = signingCert.GetCertificate()
-		parentKey = signingCert.GetPrivateKey()
+		parentKey, err = signingCert.GetSigner()
+		if err != nil {
+			return nil, err
+		}
 		template.Issuer = parent.Subject
 	}
+	template.SignatureAlgorithm = signatureAlgorithm(parentKey.Public())
 
-	cert, err := x509.CreateCertificate(rand.Reader, &template, parent, &key.PublicKey, parentKey)
-
+	cert, err := x509.CreateCertificate(rand.Reader, &template, parent, pub, parentKey)
 	if err != nil {
-		fmt.Println("error:", err)
+		return nil, fmt.Errorf("authority: cannot create certificate: %v", err)
+	}
+
+	return cert, nil
+}
+
+// signatureAlgorithm returns the algorithm used to sign with a key of the
+// provided type: SHA-256 with RSA, ECDSA with the hash matching the curve's
+// size, or Ed25519.
+func signatureAlgorithm(pub crypto.PublicKey) x509.SignatureAlgorithm {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P384():
+			return x509.ECDSAWithSHA384
+		case elliptic.P521():
+			return x509.ECDSAWithSHA512
+		}
+		return x509.ECDSAWithSHA256
+	case ed25519.PublicKey:
+		return x509.PureEd25519
+	}
+	return x509.SHA256WithRSA
+}
+
+// applyProfile sets the key usages and basic constraints for the provided
+// certificate profile. Key encipherment is only set for RSA keys, as ECDSA
+// and Ed25519 keys cannot encrypt.
+func applyProfile(template *x509.Certificate, profile string, pub crypto.PublicKey) {
+	template.BasicConstraintsValid = true
+	leafUsage := x509.KeyUsageDigitalSignature
+	if _, ok := pub.(*rsa.PublicKey); ok {
+		leafUsage |= x509.KeyUsageKeyEncipherment
 	}
 
-	return cert
+	switch profile {
+	case "ca":
+		template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		template.IsCA = true
+	case "server":
+		template.KeyUsage = leafUsage
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	case "client":
+		template.KeyUsage = leafUsage
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	case "peer":
+		template.KeyUsage = leafUsage
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+	default:
+		template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+		template.IsCA = true
+	}
 }
@@ -7,5 +7,13 @@ import (
 var (
 	ErrCertNotFound      = errors.New("authority: certificate not found")
 	ErrCertAlreadyExists = errors.New("authority: certificate already exists")
+	ErrCertRevoked       = errors.New("authority: certificate is revoked, not on hold")
+	ErrCertNotOnHold     = errors.New("authority: certificate is not on hold")
 	ErrConfigMissing     = errors.New("authority: cannot open configuraiton, or it does not exist")
+
+	ErrBackendCannotHoldKeys = errors.New("authority: backend cannot hold private keys")
+	ErrKeyNotExportable      = errors.New("authority: private key is held by the backend and cannot be exported")
+	ErrKeyMissing            = errors.New("authority: can't load private key")
+	ErrKeyOffline            = errors.New("authority: private key is offline, only the certificate is stored")
+	ErrRootOffline           = errors.New("authority: root is kept offline, import its certificate with ca:import")
 )
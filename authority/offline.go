@@ -0,0 +1,283 @@
+package authority
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ovrclk/authority/backend"
+)
+
+// IsPublicOnly returns whether this Cert is stored without any private key,
+// such as a root certificate whose key is kept offline.
+func (c *Cert) IsPublicOnly() bool {
+	return c.Exists() && !c.Backend.CheckPrivateKeyExists(c.GetName()) && !c.KeyIsHeld()
+}
+
+// CreateRequest generates and stores the private key for this Cert and
+// returns a certificate signing request for it, to be signed elsewhere,
+// typically by an offline root. The signed certificate is stored with
+// ImportSigned. Calling CreateRequest again before then reuses the key.
+func (c *Cert) CreateRequest() (*x509.CertificateRequest, error) {
+	if c.Config == nil {
+		return nil, ErrConfigMissing
+	}
+	if c.Exists() {
+		return nil, ErrCertAlreadyExists
+	}
+
+	merged, err := c.Subject.merge(c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := c.pendingSigner()
+	if err == ErrKeyMissing {
+		key, err = c.createPendingKey()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.CertificateRequest{
+		Subject:     *merged.toName(c.CommonName),
+		DNSNames:    c.DNSNames,
+		IPAddresses: c.IPAddresses,
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, fmt.Errorf("authority: cannot create certificate request: %v", err)
+	}
+	return x509.ParseCertificateRequest(der)
+}
+
+// ImportSigned stores the provided certificate for this Cert, after checking
+// that it matches the key generated by CreateRequest and is signed by this
+// Cert's parent and is a CA certificate.
+func (c *Cert) ImportSigned(cert *x509.Certificate) error {
+	if c.Exists() {
+		return ErrCertAlreadyExists
+	}
+
+	key, err := c.pendingSigner()
+	if err != nil {
+		return err
+	}
+	if !cert.IsCA || !cert.BasicConstraintsValid {
+		return fmt.Errorf("authority: certificate for %s is not a CA certificate", c.GetName())
+	}
+	if !samePublicKey(key.Public(), cert.PublicKey) {
+		return fmt.Errorf("authority: certificate does not match the private key of %s", c.GetName())
+	}
+
+	parentName := c.ParentName
+	if parentName == "" {
+		parentName = c.GetCAName()
+	}
+	parent := &Cert{CommonName: parentName, Backend: c.Backend, Config: c.Config}
+	if !parent.Exists() {
+		return fmt.Errorf("authority: parent certificate %s does not exist", parentName)
+	}
+	if err := cert.CheckSignatureFrom(parent.GetCertificate()); err != nil {
+		return fmt.Errorf("authority: certificate is not signed by %s: %v", parentName, err)
+	}
+
+	return c.Backend.PutCertificate(c.GetName(), cert)
+}
+
+// SignRequest signs the provided certificate signing request as an
+// intermediate CA certificate valid for ttl, but no longer than this Cert,
+// using this Cert's key. The request's subject is subject to the policy and
+// filled in from the configuration defaults, as for Create. A public only
+// copy of the certificate is stored under the request's common name, so that
+// it can later be revoked from this store.
+func (c *Cert) SignRequest(csr *x509.CertificateRequest, ttl time.Duration) (*x509.Certificate, error) {
+	if c.Config == nil {
+		return nil, ErrConfigMissing
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("authority: invalid certificate request signature: %v", err)
+	}
+	subject, err := subjectFromName(csr.Subject)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := subject.merge(c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	intermediate := &Cert{CommonName: csr.Subject.CommonName, CA: c.CA, Backend: c.Backend, Config: c.Config}
+	if len(intermediate.GetName()) == 0 {
+		return nil, fmt.Errorf("authority: certificate request has no common name")
+	}
+	if intermediate.Exists() {
+		return nil, ErrCertAlreadyExists
+	}
+
+	key, err := c.GetSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if ttl == 0 {
+		ttl = 5 * 365 * 24 * time.Hour
+	}
+	parent := c.GetCertificate()
+	notAfter := now.Add(ttl)
+	if notAfter.After(parent.NotAfter) {
+		notAfter = parent.NotAfter
+	}
+	template := x509.Certificate{
+		SerialNumber:       c.Backend.GetNextSerialNumber(c.GetCAName()),
+		Subject:            *merged.toName(csr.Subject.CommonName),
+		SignatureAlgorithm: signatureAlgorithm(key.Public()),
+		NotBefore:          now.Add(-backdate).UTC(),
+		NotAfter:           notAfter.UTC(),
+		DNSNames:           csr.DNSNames,
+		IPAddresses:        csr.IPAddresses,
+	}
+	applyProfile(&template, "ca", csr.PublicKey)
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, parent, csr.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("authority: cannot sign certificate request: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Backend.PutCertificate(intermediate.GetName(), cert); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// ImportPublic stores the provided certificate for this Cert without a
+// private key, such as the certificate of a root kept offline.
+func (c *Cert) ImportPublic(cert *x509.Certificate) error {
+	if c.Exists() {
+		return ErrCertAlreadyExists
+	}
+	if !cert.IsCA {
+		return fmt.Errorf("authority: certificate for %s is not a CA certificate", c.GetName())
+	}
+	return c.Backend.PutCertificate(c.GetName(), cert)
+}
+
+// SignCRL re-signs this Cert's certificate revocation list with fresh update
+// times, stores it and returns it DER encoded. Roots kept offline must have
+// their CRL re-signed within every crl_days period and imported online with
+// ImportCRL.
+func (c *Cert) SignCRL() ([]byte, error) {
+	revoked, err := c.revokedCertificates()
+	if err != nil {
+		return nil, err
+	}
+	return c.writeCRL(revoked)
+}
+
+// ImportCRL stores a certificate revocation list signed elsewhere by this
+// Cert's key, refusing lists with a bad signature or older than the stored
+// one.
+func (c *Cert) ImportCRL(der []byte) error {
+	crl, err := x509.ParseCRL(der)
+	if err != nil {
+		return fmt.Errorf("authority: cannot parse CRL: %v", err)
+	}
+	if err := c.GetCertificate().CheckCRLSignature(crl); err != nil {
+		return fmt.Errorf("authority: CRL is not signed by %s: %v", c.GetName(), err)
+	}
+
+	if raw := c.GetCRLRaw(); len(raw) > 0 {
+		current, err := x509.ParseCRL(raw)
+		if err == nil && crl.TBSCertList.ThisUpdate.Before(current.TBSCertList.ThisUpdate) {
+			return fmt.Errorf("authority: CRL is older than the stored CRL")
+		}
+	}
+
+	return c.Backend.PutCRL(c.CommonName, der)
+}
+
+// writeCRL signs, stores and returns a certificate revocation list holding
+// the provided revocations. The list is valid for crl_days, or ten years if
+// it is not configured.
+func (c *Cert) writeCRL(revoked []pkix.RevokedCertificate) ([]byte, error) {
+	key, err := c.GetSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	nextUpdate := now.AddDate(10, 0, 0)
+	if c.Config != nil {
+		if days, err := strconv.Atoi(c.Config.Defaults.CrlDays); err == nil && days > 0 {
+			nextUpdate = now.AddDate(0, 0, days)
+		}
+	}
+
+	crl, err := c.GetCertificate().CreateCRL(rand.Reader, key, revoked, now, nextUpdate)
+	if err != nil {
+		return nil, fmt.Errorf("authority: cannot sign CRL: %v", err)
+	}
+	if err := c.Backend.PutCRL(c.CommonName, crl); err != nil {
+		return nil, err
+	}
+	return crl, nil
+}
+
+// pendingSigner returns the stored or backend-held private key of a Cert
+// created by CreateRequest, whose certificate has not been imported yet.
+func (c *Cert) pendingSigner() (crypto.Signer, error) {
+	if c.Backend.CheckPrivateKeyExists(c.GetName()) {
+		return c.Backend.GetPrivateKey(c.GetName())
+	}
+	if holder, ok := c.Backend.(backend.KeyHolder); ok && holder.CheckHeldKeyExists(c.GetName()) {
+		return holder.GetHeldKey(c.GetName())
+	}
+	return nil, ErrKeyMissing
+}
+
+func (c *Cert) createPendingKey() (crypto.Signer, error) {
+	bits := c.KeyBits
+	if bits == 0 {
+		bits = keySize
+	}
+
+	if c.KeyInBackend {
+		holder, ok := c.Backend.(backend.KeyHolder)
+		if !ok {
+			return nil, ErrBackendCannotHoldKeys
+		}
+		return holder.CreateHeldKey(c.GetName(), bits)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Backend.PutPrivateKey(c.GetName(), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func samePublicKey(a, b crypto.PublicKey) bool {
+	aBytes, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		return false
+	}
+	bBytes, err := x509.MarshalPKIXPublicKey(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aBytes, bBytes)
+}
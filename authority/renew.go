@@ -0,0 +1,89 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// Renew replaces this Cert's certificate with a new one signed by parent,
+// with the subject, SANs, key usages and lifetime of the current
+// certificate. A new private key is generated, unless the key is held by
+// the backend or an external signer, or only the certificate is stored, in
+// which case the key is kept. The backend keeps the replaced certificate as
+// a previous version. Roots are replaced with Rollover instead.
+func (c *Cert) Renew(parent *Cert) (*x509.Certificate, error) {
+	if !c.Exists() {
+		return nil, ErrCertNotFound
+	}
+	current := c.GetCertificate()
+	if IsSelfSigned(current) {
+		return nil, fmt.Errorf("authority: %s is a root, replace it with a rollover", c.GetName())
+	}
+	if parent == nil || !parent.Exists() {
+		return nil, fmt.Errorf("authority: renewal of %s needs its parent", c.GetName())
+	}
+	signingKey, err := parent.GetSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	var key *rsa.PrivateKey
+	var pub crypto.PublicKey
+	if c.KeyIsHeld() {
+		held, err := c.GetSigner()
+		if err != nil {
+			return nil, err
+		}
+		pub = held.Public()
+	} else if c.IsPublicOnly() {
+		pub = current.PublicKey
+	} else {
+		bits := keySize
+		if rsaPub, ok := current.PublicKey.(*rsa.PublicKey); ok {
+			bits = rsaPub.N.BitLen()
+		}
+		if key, err = rsa.GenerateKey(rand.Reader, bits); err != nil {
+			return nil, err
+		}
+		pub = key.Public()
+	}
+
+	// NotBefore is backdated, the lifetime asked for starts at issuance
+	lifetime := current.NotAfter.Sub(current.NotBefore) - backdate
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          c.Backend.GetNextSerialNumber(c.GetCAName()),
+		RawSubject:            current.RawSubject,
+		NotBefore:             now.Add(-backdate).UTC(),
+		NotAfter:              now.Add(lifetime).UTC(),
+		DNSNames:              current.DNSNames,
+		IPAddresses:           current.IPAddresses,
+		EmailAddresses:        current.EmailAddresses,
+		KeyUsage:              current.KeyUsage,
+		ExtKeyUsage:           current.ExtKeyUsage,
+		BasicConstraintsValid: current.BasicConstraintsValid,
+		IsCA:                  current.IsCA,
+		MaxPathLen:            current.MaxPathLen,
+		MaxPathLenZero:        current.MaxPathLenZero,
+	}
+	cert, err := createCert(template, parent.GetCertificate(), pub, signingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != nil {
+		if err := c.Backend.PutPrivateKey(c.GetName(), key); err != nil {
+			return nil, err
+		}
+		c.privateKey = key
+	}
+	if err := c.Backend.PutCertificate(c.GetName(), cert); err != nil {
+		return nil, err
+	}
+	c.certificate = cert
+	return cert, nil
+}
@@ -0,0 +1,135 @@
+package authority
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"time"
+)
+
+// Revocation reason codes, as defined in RFC 5280 section 5.3.1.
+const (
+	ReasonUnspecified          = 0
+	ReasonKeyCompromise        = 1
+	ReasonCACompromise         = 2
+	ReasonAffiliationChanged   = 3
+	ReasonSuperseded           = 4
+	ReasonCessationOfOperation = 5
+	ReasonCertificateHold      = 6
+)
+
+var oidReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// RevokeWithReason adds the provided certificate to this Cert's CRL with the
+// provided reason code. A certificate already on the CRL keeps its original
+// entry, unless it is on hold and is now revoked for another reason.
+func (c *Cert) RevokeWithReason(cert *x509.Certificate, reason int) error {
+	return c.RevokeSerial(cert.SerialNumber, reason)
+}
+
+// RevokeSerial adds the certificate with the provided serial number to this
+// Cert's CRL with the provided reason code, as RevokeWithReason does. The
+// certificate itself is not needed, so certificates missing from the store
+// can still be revoked.
+func (c *Cert) RevokeSerial(serial *big.Int, reason int) error {
+	revoked, err := c.revokedCertificates()
+	if err != nil {
+		return err
+	}
+	for i, r := range revoked {
+		if r.SerialNumber.Cmp(serial) != 0 {
+			continue
+		}
+		if RevocationReason(r) != ReasonCertificateHold || reason == ReasonCertificateHold {
+			return nil
+		}
+		revoked = append(revoked[:i:i], revoked[i+1:]...)
+		break
+	}
+
+	revocation := pkix.RevokedCertificate{
+		SerialNumber:   serial,
+		RevocationTime: time.Now().UTC(),
+	}
+	if reason != ReasonUnspecified {
+		value, err := asn1.Marshal(asn1.Enumerated(reason))
+		if err != nil {
+			return err
+		}
+		revocation.Extensions = []pkix.Extension{{Id: oidReasonCode, Value: value}}
+	}
+
+	_, err = c.writeCRL(append(revoked, revocation))
+	return err
+}
+
+// Hold suspends the provided certificate by adding it to this Cert's CRL
+// with reason certificateHold. Unlike other revocations, a hold can be
+// lifted with Release.
+func (c *Cert) Hold(cert *x509.Certificate) error {
+	return c.RevokeWithReason(cert, ReasonCertificateHold)
+}
+
+// Release lifts a hold placed by Hold, removing the provided certificate
+// from this Cert's CRL. Certificates revoked for any other reason stay
+// revoked.
+func (c *Cert) Release(cert *x509.Certificate) error {
+	revoked, err := c.revokedCertificates()
+	if err != nil {
+		return err
+	}
+	for i, r := range revoked {
+		if r.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+			continue
+		}
+		if RevocationReason(r) != ReasonCertificateHold {
+			return ErrCertRevoked
+		}
+		_, err = c.writeCRL(append(revoked[:i:i], revoked[i+1:]...))
+		return err
+	}
+	return ErrCertNotOnHold
+}
+
+// Revocation returns the reason code the provided serial number is listed
+// with on this Cert's CRL, and whether it is listed at all.
+func (c *Cert) Revocation(serial *big.Int) (int, bool) {
+	entries, err := c.revokedCertificates()
+	if err != nil {
+		return ReasonUnspecified, false
+	}
+	for _, revoked := range entries {
+		if revoked.SerialNumber.Cmp(serial) == 0 {
+			return RevocationReason(revoked), true
+		}
+	}
+	return ReasonUnspecified, false
+}
+
+// RevocationReason returns the reason code of a CRL entry.
+func RevocationReason(revoked pkix.RevokedCertificate) int {
+	for _, ext := range revoked.Extensions {
+		if ext.Id.Equal(oidReasonCode) {
+			var reason asn1.Enumerated
+			if _, err := asn1.Unmarshal(ext.Value, &reason); err == nil {
+				return int(reason)
+			}
+		}
+	}
+	return ReasonUnspecified
+}
+
+// revokedCertificates returns the entries of this Cert's CRL.
+func (c *Cert) revokedCertificates() ([]pkix.RevokedCertificate, error) {
+	raw := c.GetCRLRaw()
+	if len(raw) == 0 {
+		c.crl = &pkix.CertificateList{}
+		return nil, nil
+	}
+	var err error
+	if c.crl, err = x509.ParseCRL(raw); err != nil {
+		return nil, err
+	}
+	return c.crl.TBSCertList.RevokedCertificates, nil
+}
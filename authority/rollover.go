@@ -0,0 +1,237 @@
+package authority
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Names of the certificates kept alongside a CA during a rollover, as
+// suffixes of the CA's name.
+const (
+	NextSuffix     = "-next"
+	PreviousSuffix = "-previous"
+	CrossNewSuffix = "-cross-new"
+	CrossOldSuffix = "-cross-old"
+)
+
+// Rollover holds the certificates created when replacing a CA's key.
+type Rollover struct {
+	// Next is the replacement CA certificate, which takes over issuance
+	// from its NotBefore date.
+	Next *x509.Certificate
+
+	// CrossNew certifies the replacement root's key with the current root,
+	// and CrossOld certifies the current root's key with the replacement,
+	// so that either root validates certificates issued under the other.
+	// They are only created when rolling over a root.
+	CrossNew *x509.Certificate
+	CrossOld *x509.Certificate
+}
+
+// Rollover creates a new key and certificate to replace this CA's, which
+// take over issuance at switchAt. The replacement is valid for ttl from
+// switchAt, or for the current certificate's lifetime if ttl is zero. Roots
+// are replaced by a new self-signed certificate and cross-signed both ways,
+// while intermediates are replaced by a new certificate signed by parent.
+func (c *Cert) Rollover(parent *Cert, switchAt time.Time, ttl time.Duration) (*Rollover, error) {
+	if !c.Exists() {
+		return nil, ErrCertNotFound
+	}
+	current := c.GetCertificate()
+	if !current.IsCA {
+		return nil, fmt.Errorf("authority: %s is not a CA certificate", c.GetName())
+	}
+	if c.KeyIsHeld() {
+		return nil, fmt.Errorf("authority: rollover of keys held outside the store is not supported")
+	}
+	currentKey, err := c.GetSigner()
+	if err != nil {
+		return nil, err
+	}
+	if c.RolloverPending() {
+		return nil, fmt.Errorf("authority: a rollover of %s is already pending", c.GetName())
+	}
+
+	if ttl == 0 {
+		ttl = current.NotAfter.Sub(current.NotBefore)
+	}
+	bits := keySize
+	if pub, ok := current.PublicKey.(*rsa.PublicKey); ok {
+		bits = pub.N.BitLen()
+	}
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+
+	template := c.caTemplate(current, switchAt.UTC(), switchAt.Add(ttl).UTC())
+	signingCert, signingKey := template, crypto.Signer(key)
+	if c.IsRoot() {
+		// cross certificates need the two roots to have distinct names
+		template.RawSubject = nil
+		template.Subject = generationName(current.Subject, template.SerialNumber.String())
+	} else {
+		if parent == nil {
+			return nil, fmt.Errorf("authority: rollover of intermediate %s needs its parent", c.GetName())
+		}
+		signingCert = parent.GetCertificate()
+		if signingKey, err = parent.GetSigner(); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &Rollover{}
+	if r.Next, err = createCert(template, signingCert, key.Public(), signingKey); err != nil {
+		return nil, err
+	}
+
+	next := c.sibling(NextSuffix)
+	if err := c.Backend.PutPrivateKey(next.GetName(), key); err != nil {
+		return nil, err
+	}
+	if err := c.Backend.PutCertificate(next.GetName(), r.Next); err != nil {
+		return nil, err
+	}
+
+	if !c.IsRoot() {
+		return r, nil
+	}
+
+	now := time.Now()
+	crossNew := c.caTemplate(r.Next, now.Add(-5*time.Minute).UTC(), current.NotAfter)
+	if r.CrossNew, err = createCert(crossNew, current, key.Public(), currentKey); err != nil {
+		return nil, err
+	}
+	crossOld := c.caTemplate(current, switchAt.UTC(), current.NotAfter)
+	if r.CrossOld, err = createCert(crossOld, r.Next, current.PublicKey, key); err != nil {
+		return nil, err
+	}
+
+	if err := c.Backend.PutCertificate(c.sibling(CrossNewSuffix).GetName(), r.CrossNew); err != nil {
+		return nil, err
+	}
+	if err := c.Backend.PutCertificate(c.sibling(CrossOldSuffix).GetName(), r.CrossOld); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// RolloverPending returns whether a replacement created by Rollover has not
+// yet become this CA's certificate.
+func (c *Cert) RolloverPending() bool {
+	next := c.sibling(NextSuffix)
+	if !next.Exists() || !c.Exists() {
+		return false
+	}
+	return !bytes.Equal(next.GetCertificate().Raw, c.GetCertificate().Raw)
+}
+
+// CompleteRollover makes a pending replacement created by Rollover this CA's
+// certificate and key once its switch date has passed. The replaced
+// certificate, key and CRL are kept as the "-previous" certificate, so that
+// certificates it issued can still be revoked. It returns whether the
+// switch happened.
+func (c *Cert) CompleteRollover() (bool, error) {
+	if !c.RolloverPending() {
+		return false, nil
+	}
+	next := c.sibling(NextSuffix)
+	nextCert := next.GetCertificate()
+	if time.Now().Before(nextCert.NotBefore) {
+		return false, nil
+	}
+
+	previous := c.sibling(PreviousSuffix)
+	if err := c.Backend.PutCertificate(previous.GetName(), c.GetCertificate()); err != nil {
+		return false, err
+	}
+	if err := c.Backend.PutPrivateKey(previous.GetName(), c.GetPrivateKey()); err != nil {
+		return false, err
+	}
+	if crl := c.GetCRLRaw(); len(crl) > 0 {
+		if err := c.Backend.PutCRL(previous.CommonName, crl); err != nil {
+			return false, err
+		}
+	}
+
+	c.certificate, c.privateKey = nextCert, next.GetPrivateKey()
+	c.loaded = true
+	if err := c.store(); err != nil {
+		return false, err
+	}
+	_, err := c.writeCRL(nil)
+	return err == nil, err
+}
+
+// IsRolloverName returns whether the provided name is one of the
+// certificates kept alongside a CA during a rollover.
+func IsRolloverName(name string) bool {
+	for _, suffix := range []string{NextSuffix, PreviousSuffix, CrossNewSuffix, CrossOldSuffix} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cert) sibling(suffix string) *Cert {
+	return &Cert{
+		CommonName: c.GetName() + suffix,
+		CA:         c.CA,
+		Backend:    c.Backend,
+		Config:     c.Config,
+	}
+}
+
+// caTemplate returns a CA certificate template with the subject and key
+// usages of the provided certificate.
+func (c *Cert) caTemplate(like *x509.Certificate, notBefore, notAfter time.Time) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber:          c.Backend.GetNextSerialNumber(c.GetCAName()),
+		RawSubject:            like.RawSubject,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              like.KeyUsage,
+		ExtKeyUsage:           like.ExtKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            like.MaxPathLen,
+		MaxPathLenZero:        like.MaxPathLenZero,
+	}
+}
+
+// generationName returns a copy of name, including all its attributes, with
+// its serialNumber attribute set to the provided generation.
+func generationName(name pkix.Name, generation string) pkix.Name {
+	oidSerialNumber := asn1.ObjectIdentifier{2, 5, 4, 5}
+	renamed := pkix.Name{}
+	for _, attr := range name.Names {
+		if !attr.Type.Equal(oidSerialNumber) {
+			renamed.ExtraNames = append(renamed.ExtraNames, attr)
+		}
+	}
+	renamed.ExtraNames = append(renamed.ExtraNames, pkix.AttributeTypeAndValue{
+		Type:  oidSerialNumber,
+		Value: generation,
+	})
+	return renamed
+}
+
+// createCert signs a certificate for pub from template, with the signature
+// algorithm for key.
+func createCert(template, parent *x509.Certificate, pub crypto.PublicKey, key crypto.Signer) (*x509.Certificate, error) {
+	template.SignatureAlgorithm = signatureAlgorithm(key.Public())
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, key)
+	if err != nil {
+		return nil, fmt.Errorf("authority: cannot create certificate: %v", err)
+	}
+	return x509.ParseCertificate(der)
+}
@@ -0,0 +1,44 @@
+package authority
+
+import (
+	"crypto"
+
+	"github.com/ovrclk/authority/config"
+	"github.com/ovrclk/authority/signer"
+)
+
+// Signers maps CA names to in-process signers for CA keys which are not kept
+// in the backend.
+type Signers map[string]crypto.Signer
+
+// SignerConfigs maps CA names to the configuration of signers for CA keys
+// which are not kept in the backend. They must come from client-local
+// settings, as opening a signer runs its command or module.
+type SignerConfigs map[string]config.SignerConfig
+
+// hasExternalSigner returns whether this Cert's key is provided by an
+// in-process or a configured signer.
+func (c *Cert) hasExternalSigner() bool {
+	if _, ok := c.Signers[c.GetName()]; ok {
+		return true
+	}
+	_, ok := c.SignerConfigs[c.GetName()]
+	return ok
+}
+
+// getExternalSigner returns the in-process or configured signer for this
+// Cert's key. Configured signers are opened once and reused.
+func (c *Cert) getExternalSigner() (crypto.Signer, error) {
+	if s, ok := c.Signers[c.GetName()]; ok {
+		return s, nil
+	}
+	if c.signer == nil {
+		cfg := c.SignerConfigs[c.GetName()]
+		s, err := signer.New(&cfg)
+		if err != nil {
+			return nil, err
+		}
+		c.signer = s
+	}
+	return c.signer, nil
+}
@@ -0,0 +1,144 @@
+package authority
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/ovrclk/authority/config"
+)
+
+// oidEmailAddress is the PKCS #9 emailAddress attribute.
+var oidEmailAddress = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+
+// Subject holds per-certificate subject fields. Any field left empty is
+// filled in from the configuration defaults when the certificate is created.
+type Subject struct {
+	Country            string
+	Organization       string
+	OrganizationalUnit string
+	Locality           string
+	Province           string
+	EmailAddress       string
+	SerialNumber       string
+	ExtraNames         []pkix.AttributeTypeAndValue
+}
+
+// fieldOIDs maps the attribute types of the Subject fields, and of the
+// common name, to their configuration keys. Extra attributes may not use
+// them, since pkix.Name lets ExtraNames override the fields.
+var fieldOIDs = map[string]string{
+	"2.5.4.3":                "common_name",
+	"2.5.4.5":                "serial_number",
+	"2.5.4.6":                "country",
+	"2.5.4.7":                "city",
+	"2.5.4.8":                "region",
+	"2.5.4.10":               "org",
+	"2.5.4.11":               "org_unit",
+	oidEmailAddress.String(): "email",
+}
+
+// subjectFields maps configuration keys to the matching Subject field, and is
+// used to merge defaults and enforce locked fields.
+func (s *Subject) subjectFields() map[string]*string {
+	return map[string]*string{
+		"country":  &s.Country,
+		"org":      &s.Organization,
+		"org_unit": &s.OrganizationalUnit,
+		"city":     &s.Locality,
+		"region":   &s.Province,
+		"email":    &s.EmailAddress,
+	}
+}
+
+// IsEmpty returns whether no field or extra attribute of this Subject is
+// set, so that the configuration defaults are used unchanged.
+func (s *Subject) IsEmpty() bool {
+	for _, field := range s.subjectFields() {
+		if *field != "" {
+			return false
+		}
+	}
+	return s.SerialNumber == "" && len(s.ExtraNames) == 0
+}
+
+// merge returns a copy of this Subject with empty fields filled from the
+// configuration defaults. It returns an error if the Subject sets a field to
+// a value other than the default when the policy locks that field, or if an
+// extra attribute has the type of one of the fields.
+func (s Subject) merge(cfg *config.Config) (*Subject, error) {
+	for _, attr := range s.ExtraNames {
+		if key, ok := fieldOIDs[attr.Type.String()]; ok {
+			return nil, fmt.Errorf("authority: subject attribute %s is the %s field and cannot be set as an extra attribute", attr.Type, key)
+		}
+	}
+
+	merged := s
+	fields := merged.subjectFields()
+	for key, field := range fields {
+		def := cfg.GetItem(key)
+		if cfg.Policy.SubjectIsLocked(key) && *field != "" && *field != def {
+			return nil, fmt.Errorf("authority: subject field %s is locked to %q by policy", key, def)
+		}
+		if *field == "" {
+			*field = def
+		}
+	}
+	return &merged, nil
+}
+
+// subjectFromName returns the Subject holding the fields and extra
+// attributes of the provided name, other than its common name, such as the
+// subject of a certificate signing request. Fields with several values are
+// refused, as a Subject holds one value per field.
+func subjectFromName(name pkix.Name) (*Subject, error) {
+	s := &Subject{}
+	fields := s.subjectFields()
+	fields["serial_number"] = &s.SerialNumber
+	for _, attr := range name.Names {
+		key, ok := fieldOIDs[attr.Type.String()]
+		if !ok {
+			s.ExtraNames = append(s.ExtraNames, attr)
+			continue
+		}
+		if key == "common_name" {
+			continue
+		}
+		value, ok := attr.Value.(string)
+		if !ok || *fields[key] != "" {
+			return nil, fmt.Errorf("authority: subject field %s must have a single string value", key)
+		}
+		*fields[key] = value
+	}
+	return s, nil
+}
+
+// toName builds the pkix.Name for a certificate with the given common name.
+func (s *Subject) toName(commonName string) *pkix.Name {
+	name := &pkix.Name{
+		Country:            nonEmpty(s.Country),
+		Organization:       nonEmpty(s.Organization),
+		OrganizationalUnit: nonEmpty(s.OrganizationalUnit),
+		Locality:           nonEmpty(s.Locality),
+		Province:           nonEmpty(s.Province),
+		SerialNumber:       s.SerialNumber,
+		CommonName:         commonName,
+	}
+
+	if s.EmailAddress != "" {
+		name.ExtraNames = append(name.ExtraNames, pkix.AttributeTypeAndValue{
+			Type:  oidEmailAddress,
+			Value: s.EmailAddress,
+		})
+	}
+	name.ExtraNames = append(name.ExtraNames, s.ExtraNames...)
+
+	return name
+}
+
+func nonEmpty(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
@@ -0,0 +1,89 @@
+package backend
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrAuditConflict is returned by AppendAuditEntry when the entry does not
+// follow the head of the log, because another entry was appended since the
+// head was read. The entry should be chained to the new head and appended
+// again.
+var ErrAuditConflict = errors.New("authority: audit log was appended to concurrently")
+
+// AuditEntry is one record of the audit log. Each entry's Hash covers its
+// fields and the previous entry's hash, so that changing, removing or
+// reordering entries breaks the chain. A Keyed entry's hash is an HMAC under
+// an audit key kept outside the backend, so that only holders of the key can
+// recompute the chain.
+type AuditEntry struct {
+	Sequence  int       `json:"sequence"`
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor"`
+	Operation string    `json:"operation"`
+	Target    string    `json:"target"`
+	Serial    string    `json:"serial,omitempty"`
+	PrevHash  string    `json:"prev_hash"`
+	Keyed     bool      `json:"keyed,omitempty"`
+	Hash      string    `json:"hash"`
+}
+
+// ComputeHash returns the hex encoded hash of the entry's fields and its
+// PrevHash: an HMAC-SHA256 under key if the entry is Keyed, otherwise a
+// SHA-256 hash.
+func (e *AuditEntry) ComputeHash(key []byte) string {
+	data := []byte(fmt.Sprintf("%d\n%s\n%s\n%s\n%s\n%s\n%s",
+		e.Sequence, e.Time.UTC().Format(time.RFC3339Nano), e.Actor, e.Operation, e.Target, e.Serial, e.PrevHash))
+	if e.Keyed {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditHead records the sequence number and hash of the last entry of the
+// audit log, so that appending does not need to read the whole log and
+// entries removed from its end are noticed. An empty log has a zero head.
+type AuditHead struct {
+	Sequence int    `json:"sequence"`
+	Hash     string `json:"hash"`
+	Keyed    bool   `json:"keyed,omitempty"`
+}
+
+// Follows reports whether entry is the next entry after the head.
+func (h *AuditHead) Follows(entry *AuditEntry) bool {
+	return entry.Sequence == h.Sequence+1 && entry.PrevHash == h.Hash
+}
+
+func headOf(entries []*AuditEntry) *AuditHead {
+	if len(entries) == 0 {
+		return &AuditHead{}
+	}
+	return headFor(entries[len(entries)-1])
+}
+
+func headFor(entry *AuditEntry) *AuditHead {
+	return &AuditHead{Sequence: entry.Sequence, Hash: entry.Hash, Keyed: entry.Keyed}
+}
+
+// ReadAuditor is implemented by backends which record reads in an audit
+// trail of their own, along with the caller's identity, such as Vault's
+// audit devices. Reads of private keys are not appended to the audit log of
+// these backends, so that credentials which may only read need no access to
+// the log.
+type ReadAuditor interface {
+	AuditsReads() bool
+}
+
+// Identifier is implemented by backends which authenticate their callers,
+// returning the identity recorded as the actor of audit log entries instead
+// of a name the caller chose.
+type Identifier interface {
+	Identity() (string, error)
+}
@@ -1,15 +1,19 @@
 package backend
 
 import (
+	"crypto"
 	"crypto/rsa"
 	"crypto/x509"
 	"math/big"
+	"time"
 
 	"github.com/ovrclk/authority/config"
 )
 
 // Interface for storing authority configuration information, as well as
-// generated certificates and keys.
+// generated certificates and keys. Storing a certificate under a name that
+// already holds a different one keeps the replaced certificate as a previous
+// version.
 type Backend interface {
 	Connect() error
 
@@ -17,12 +21,23 @@ type Backend interface {
 	CheckCertificateExists(name string) bool
 	CheckPrivateKeyExists(name string) bool
 
+	// lists
+	ListCertificates() ([]string, error)
+	ListAuditEntries() ([]*AuditEntry, error)
+
+	// tokens
+	CreateTokenForCertificate(name string, opts *TokenOptions) (string, error)
+	ListTokensForCertificate(name string) ([]TokenInfo, error)
+	RevokeTokensForCertificate(name string) error
+
 	// gets
-	CreateTokenForCertificate(name string) (string, error)
+	GetAuditHead() (*AuditHead, error)
 	GetConfig() (*config.Config, error)
 	GetCertificate(name string) (*x509.Certificate, error)
+	GetCertificateVersions(name string) ([]*x509.Certificate, error)
 	GetCRLRaw(name string) []byte
-	GetNextSerialNumber() *big.Int
+	GetMetadata(name string) (*Metadata, error)
+	GetNextSerialNumber(ca string) *big.Int
 	GetPrivateKey(name string) (*rsa.PrivateKey, error)
 
 	// puts
@@ -30,4 +45,38 @@ type Backend interface {
 	PutCertificate(name string, cert *x509.Certificate) error
 	PutPrivateKey(name string, key *rsa.PrivateKey) error
 	PutCRL(name string, crlBytes []byte) error
+	PutMetadata(name string, meta *Metadata) error
+	AppendAuditEntry(entry *AuditEntry) error
+}
+
+// KeyHolder is implemented by backends which can generate private keys that
+// never leave the backend, and sign with them on request.
+type KeyHolder interface {
+	CheckHeldKeyExists(name string) bool
+	CreateHeldKey(name string, bits int) (crypto.Signer, error)
+	GetHeldKey(name string) (crypto.Signer, error)
+}
+
+// TokenOptions controls the backend access tokens created for certificates.
+type TokenOptions struct {
+	// TTL is the token's time to live. Zero creates a token which does not
+	// expire.
+	TTL time.Duration
+
+	// NumUses limits the number of requests the token may be used for. Zero
+	// allows unlimited use.
+	NumUses int
+
+	// WrapTTL, when non-zero, response-wraps the token so that a single use
+	// wrapping token valid for WrapTTL is returned instead.
+	WrapTTL time.Duration
+}
+
+// TokenInfo describes a backend access token created for a certificate.
+type TokenInfo struct {
+	Accessor  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	NumUses   int
+	Valid     bool
 }
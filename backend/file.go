@@ -4,11 +4,15 @@ import (
 	"bufio"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"io/ioutil"
 	"math/big"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/ovrclk/authority/config"
 )
@@ -46,14 +50,88 @@ func (f *File) CheckPrivateKeyExists(name string) bool {
 	return fileExists(f.keyPath(name))
 }
 
-// gets
+// lists
+
+// List the names of all certificates stored on disk.
+func (f *File) ListCertificates() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(f.certsDir(), "*.crt"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, path := range paths {
+		names = append(names, strings.TrimSuffix(filepath.Base(path), ".crt"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// List the entries of the audit log on disk, oldest first.
+func (f *File) ListAuditEntries() ([]*AuditEntry, error) {
+	data, err := ioutil.ReadFile(f.auditPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*AuditEntry
+	for i, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := &AuditEntry{}
+		if err := json.Unmarshal([]byte(line), entry); err != nil {
+			return nil, fmt.Errorf("authority: cannot parse audit log line %d: %v", i+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// tokens
 
 // Create an access token for a specific certificate. This is not
 // applicable to this filesystem based backend.
-func (f *File) CreateTokenForCertificate(name string) (string, error) {
+func (f *File) CreateTokenForCertificate(name string, opts *TokenOptions) (string, error) {
 	return "", nil
 }
 
+// List the access tokens for a specific certificate. This is not
+// applicable to this filesystem based backend.
+func (f *File) ListTokensForCertificate(name string) ([]TokenInfo, error) {
+	return nil, nil
+}
+
+// Revoke the access tokens for a specific certificate. This is not
+// applicable to this filesystem based backend.
+func (f *File) RevokeTokensForCertificate(name string) error {
+	return nil
+}
+
+// gets
+
+// Load the head of the audit log from disk. A log written before heads were
+// recorded has its head taken from its last entry.
+func (f *File) GetAuditHead() (*AuditHead, error) {
+	data, err := ioutil.ReadFile(f.auditHeadPath())
+	if os.IsNotExist(err) {
+		entries, err := f.ListAuditEntries()
+		if err != nil {
+			return nil, err
+		}
+		return headOf(entries), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	head := &AuditHead{}
+	if err := json.Unmarshal(data, head); err != nil {
+		return nil, fmt.Errorf("authority: cannot parse audit log head: %v", err)
+	}
+	return head, nil
+}
+
 // Load authority configuration information from disk.
 func (f *File) GetConfig() (*config.Config, error) {
 	bytes, err := f.readFile(f.configPath())
@@ -69,13 +147,32 @@ func (f *File) GetConfig() (*config.Config, error) {
 
 // Load a certificate from the filesystem.
 func (f *File) GetCertificate(name string) (*x509.Certificate, error) {
-	bytes, err := f.readFile(f.certPath(name))
-	if err != nil {
-		return nil, err
+	return f.readCertificate(f.certPath(name))
+}
+
+// Load every version of a certificate from the filesystem, oldest first and
+// ending with the current certificate.
+func (f *File) GetCertificateVersions(name string) ([]*x509.Certificate, error) {
+	var versions []*x509.Certificate
+	for i := 1; ; i++ {
+		path := f.versionPath(name, i)
+		if !fileExists(path) {
+			break
+		}
+		cert, err := f.readCertificate(path)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, cert)
 	}
-	data, _ := pem.Decode([]byte(bytes))
-	cert, _ := x509.ParseCertificate(data.Bytes)
-	return cert, nil
+	if f.CheckCertificateExists(name) {
+		cert, err := f.GetCertificate(name)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, cert)
+	}
+	return versions, nil
 }
 
 // Load the root certificate revocation list from the filesystem.
@@ -87,10 +184,28 @@ func (f *File) GetCRLRaw(name string) []byte {
 	return bytes
 }
 
-// Get the next unused serial number in sequence from the filesystem.
-func (f *File) GetNextSerialNumber() *big.Int {
+// Load the metadata record of a certificate from the filesystem. A
+// certificate without a record has empty metadata.
+func (f *File) GetMetadata(name string) (*Metadata, error) {
+	meta := &Metadata{}
+	if !fileExists(f.metadataPath(name)) {
+		return meta, nil
+	}
+	bytes, err := f.readFile(f.metadataPath(name))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bytes, meta); err != nil {
+		return nil, fmt.Errorf("authority: cannot parse metadata of %s: %v", name, err)
+	}
+	return meta, nil
+}
+
+// Get the next unused serial number in the provided root CA's sequence from
+// the filesystem.
+func (f *File) GetNextSerialNumber(ca string) *big.Int {
 	curr := big.NewInt(1)
-	bytes, err := f.readFile(f.serialNumberPath())
+	bytes, err := f.readFile(f.serialNumberPath(ca))
 	if err != nil && os.IsExist(err) {
 		return curr
 	}
@@ -101,7 +216,7 @@ func (f *File) GetNextSerialNumber() *big.Int {
 	}
 
 	bytes, _ = curr.MarshalText()
-	_ = f.writeFileRaw(f.serialNumberPath(), bytes)
+	_ = f.writeFileRaw(f.serialNumberPath(ca), bytes)
 	return curr
 }
 
@@ -124,8 +239,18 @@ func (f *File) PutConfig(config string) error {
 	return f.writeFileRaw(f.configPath(), []byte(config))
 }
 
-// Store the provided certificate in PEM format on the filesystem.
+// Store the provided certificate in PEM format on the filesystem. A
+// different certificate already stored under the name is moved to the
+// name's history directory.
 func (f *File) PutCertificate(name string, cert *x509.Certificate) error {
+	if f.CheckCertificateExists(name) {
+		current, err := f.GetCertificate(name)
+		if err == nil && current != nil && !current.Equal(cert) {
+			if err := f.archiveCertificate(name, current); err != nil {
+				return err
+			}
+		}
+	}
 	return f.writeFile("CERTIFICATE", f.certPath(name), cert.Raw)
 }
 
@@ -140,14 +265,100 @@ func (f *File) PutCRL(name string, crlBytes []byte) error {
 	return f.writeFileRaw(f.crlPath(name), crlBytes)
 }
 
+// Store the metadata record of a certificate as JSON on the filesystem.
+func (f *File) PutMetadata(name string, meta *Metadata) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(f.metadataPath(name))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("Could not create %s directory %s", dir, err)
+	}
+	return f.writeFileRaw(f.metadataPath(name), data)
+}
+
+// Append the provided entry to the audit log on disk, one JSON object per
+// line, and record it as the head of the log. The entry must follow the
+// current head.
+func (f *File) AppendAuditEntry(entry *AuditEntry) error {
+	head, err := f.GetAuditHead()
+	if err != nil {
+		return err
+	}
+	if !head.Follows(entry) {
+		return ErrAuditConflict
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	fileOut, err := os.OpenFile(f.auditPath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer fileOut.Close()
+	if _, err := fileOut.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	data, err = json.Marshal(headFor(entry))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f.auditHeadPath(), data, 0600)
+}
+
 // private functionality
 
 func (f *File) crlPath(name string) string {
 	return filepath.Join(f.Path, fmt.Sprintf("%s_crl.crl", name))
 }
 
-func (f *File) serialNumberPath() string {
-	return filepath.Join(f.Path, "SERIAL")
+// The default root CA keeps the original serial file.
+func (f *File) serialNumberPath(ca string) string {
+	if ca == "ca" {
+		return filepath.Join(f.Path, "SERIAL")
+	}
+	return filepath.Join(f.Path, fmt.Sprintf("SERIAL_%s", ca))
+}
+
+func (f *File) archiveCertificate(name string, cert *x509.Certificate) error {
+	dir := filepath.Join(f.Path, "history", name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("Could not create %s directory %s", dir, err)
+	}
+	version := 1
+	for fileExists(f.versionPath(name, version)) {
+		version++
+	}
+	return f.writeFile("CERTIFICATE", f.versionPath(name, version), cert.Raw)
+}
+
+func (f *File) readCertificate(path string) (*x509.Certificate, error) {
+	bytes, err := f.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := pem.Decode([]byte(bytes))
+	cert, _ := x509.ParseCertificate(data.Bytes)
+	return cert, nil
+}
+
+// Previous versions of a certificate are numbered from 1, oldest first.
+func (f *File) versionPath(name string, version int) string {
+	return filepath.Join(f.Path, "history", name, fmt.Sprintf("%d.crt", version))
+}
+
+func (f *File) auditPath() string {
+	return filepath.Join(f.Path, "audit.log")
+}
+
+func (f *File) auditHeadPath() string {
+	return filepath.Join(f.Path, "audit.head")
+}
+
+func (f *File) metadataPath(name string) string {
+	return filepath.Join(f.Path, "meta", fmt.Sprintf("%s.json", name))
 }
 
 func (f *File) certPath(name string) string {
@@ -0,0 +1,137 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Metadata keys with a dedicated field. Any other key is kept in Labels.
+const (
+	MetaOwner     = "owner"
+	MetaTeam      = "team"
+	MetaTicket    = "ticket"
+	MetaTags      = "tags"
+	MetaNotes     = "notes"
+	MetaCreatedBy = "created-by"
+	MetaCreatedAt = "created-at"
+)
+
+// Metadata records who owns a certificate and why it exists. It is stored
+// alongside the certificate by every backend.
+type Metadata struct {
+	Owner     string            `json:"owner,omitempty"`
+	Team      string            `json:"team,omitempty"`
+	Ticket    string            `json:"ticket,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+	Notes     string            `json:"notes,omitempty"`
+	CreatedBy string            `json:"created_by,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// Set sets the value of the provided key. Tags are given as a comma
+// separated list, and an empty value clears the key. The creation keys are
+// recorded when the certificate is created and cannot be set.
+func (m *Metadata) Set(key, value string) error {
+	switch key {
+	case MetaOwner:
+		m.Owner = value
+	case MetaTeam:
+		m.Team = value
+	case MetaTicket:
+		m.Ticket = value
+	case MetaTags:
+		m.Tags = nil
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				m.Tags = append(m.Tags, tag)
+			}
+		}
+	case MetaNotes:
+		m.Notes = value
+	case MetaCreatedBy, MetaCreatedAt:
+		return fmt.Errorf("authority: %s is recorded when the certificate is created", key)
+	case "":
+		return fmt.Errorf("authority: metadata key cannot be blank")
+	default:
+		if value == "" {
+			delete(m.Labels, key)
+			return nil
+		}
+		if m.Labels == nil {
+			m.Labels = map[string]string{}
+		}
+		m.Labels[key] = value
+	}
+	return nil
+}
+
+// Get returns the value of the provided key, with tags as a comma separated
+// list.
+func (m *Metadata) Get(key string) string {
+	switch key {
+	case MetaOwner:
+		return m.Owner
+	case MetaTeam:
+		return m.Team
+	case MetaTicket:
+		return m.Ticket
+	case MetaTags:
+		return strings.Join(m.Tags, ",")
+	case MetaNotes:
+		return m.Notes
+	case MetaCreatedBy:
+		return m.CreatedBy
+	case MetaCreatedAt:
+		if m.CreatedAt.IsZero() {
+			return ""
+		}
+		return m.CreatedAt.Format(time.RFC3339)
+	}
+	return m.Labels[key]
+}
+
+// Keys returns the keys with a value, dedicated keys first and the other
+// labels sorted.
+func (m *Metadata) Keys() []string {
+	var keys []string
+	for _, key := range []string{MetaOwner, MetaTeam, MetaTicket, MetaTags, MetaNotes, MetaCreatedBy, MetaCreatedAt} {
+		if m.Get(key) != "" {
+			keys = append(keys, key)
+		}
+	}
+	var labels []string
+	for key := range m.Labels {
+		labels = append(labels, key)
+	}
+	sort.Strings(labels)
+	return append(keys, labels...)
+}
+
+// Matches returns whether every key in filter has the given value. A tags
+// filter matches if the metadata has that tag among others.
+func (m *Metadata) Matches(filter map[string]string) bool {
+	for key, value := range filter {
+		if key == MetaTags {
+			if !m.hasTag(value) {
+				return false
+			}
+			continue
+		}
+		if m.Get(key) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Metadata) hasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package backend
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Determine if a private key is held in Vault's transit backend.
+func (v *Vault) CheckHeldKeyExists(name string) bool {
+	secret, err := v.Client.Logical().Read(v.transitPath("keys", name))
+	if err != nil || secret == nil {
+		return false
+	}
+	return true
+}
+
+// Generate a non-exportable RSA key in Vault's transit backend, returning a
+// signer which signs with it inside Vault.
+func (v *Vault) CreateHeldKey(name string, bits int) (crypto.Signer, error) {
+	keyType := fmt.Sprintf("rsa-%d", bits)
+	_, err := v.Client.Logical().Write(v.transitPath("keys", name), map[string]interface{}{
+		"type":       keyType,
+		"exportable": false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("authority: cannot create transit key: %v", err)
+	}
+	return v.GetHeldKey(name)
+}
+
+// Return a signer for a private key held in Vault's transit backend.
+func (v *Vault) GetHeldKey(name string) (crypto.Signer, error) {
+	secret, err := v.Client.Logical().Read(v.transitPath("keys", name))
+	if err != nil {
+		return nil, fmt.Errorf("authority: cannot read transit key: %v", err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("authority: transit key for %s does not exist", name)
+	}
+
+	keys, _ := secret.Data["keys"].(map[string]interface{})
+	latest := fmt.Sprintf("%v", secret.Data["latest_version"])
+	version, _ := keys[latest].(map[string]interface{})
+	publicKey, _ := version["public_key"].(string)
+
+	block, _ := pem.Decode([]byte(publicKey))
+	if block == nil {
+		return nil, fmt.Errorf("authority: transit key for %s has no public key", name)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("authority: cannot parse transit public key: %v", err)
+	}
+
+	return &transitSigner{vault: v, name: name, public: pub}, nil
+}
+
+// transitSigner is a crypto.Signer which signs digests with a key held in
+// Vault's transit backend.
+type transitSigner struct {
+	vault  *Vault
+	name   string
+	public crypto.PublicKey
+}
+
+func (s *transitSigner) Public() crypto.PublicKey {
+	return s.public
+}
+
+func (s *transitSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var algorithm string
+	switch opts.HashFunc() {
+	case crypto.SHA256:
+		algorithm = "sha2-256"
+	case crypto.SHA384:
+		algorithm = "sha2-384"
+	case crypto.SHA512:
+		algorithm = "sha2-512"
+	default:
+		return nil, fmt.Errorf("authority: unsupported transit hash %v", opts.HashFunc())
+	}
+
+	secret, err := s.vault.Client.Logical().Write(s.vault.transitPath("sign", s.name)+"/"+algorithm, map[string]interface{}{
+		"input":               base64.StdEncoding.EncodeToString(digest),
+		"prehashed":           true,
+		"signature_algorithm": "pkcs1v15",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("authority: transit signing failed: %v", err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("authority: transit signing returned no signature")
+	}
+
+	// signatures are returned as "vault:v<version>:<base64 signature>"
+	signature, _ := secret.Data["signature"].(string)
+	parts := strings.SplitN(signature, ":", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("authority: unexpected transit signature %q", signature)
+	}
+	return base64.StdEncoding.DecodeString(parts[2])
+}
+
+func (v *Vault) transitPath(op, name string) string {
+	mount := v.TransitMount
+	if mount == "" {
+		mount = "transit"
+	}
+	return fmt.Sprintf("%s/%s/authority-%s", mount, op, name)
+}
@@ -1,17 +1,21 @@
 package backend
 
 import (
+	"bytes"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"math/big"
 	"net"
 	"net/http"
 	"os"
+	"sort"
 	"time"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/api"
 
 	"github.com/ovrclk/authority/config"
@@ -24,6 +28,12 @@ type Vault struct {
 	Client *api.Client
 	Server string
 	Token  string
+
+	// TransitMount is the mount path of the transit backend used for keys
+	// held in Vault. It defaults to "transit".
+	TransitMount string
+
+	httpClient *http.Client
 }
 
 // Connect to Vault server.
@@ -37,6 +47,7 @@ func (v *Vault) Connect() error {
 	}
 	v.Client = client
 	v.Client.SetToken(v.Token)
+	v.httpClient = config.HttpClient
 
 	return nil
 }
@@ -63,11 +74,89 @@ func (v *Vault) CheckPrivateKeyExists(name string) bool {
 	return true
 }
 
-// gets
+// lists
+
+// List the names of all certificates stored in Vault.
+func (v *Vault) ListCertificates() ([]string, error) {
+	r := v.Client.NewRequest("GET", "/v1/secret/authority/cert")
+	r.Params.Set("list", "true")
+	resp, err := v.Client.RawRequest(r)
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("authority: cannot list certificates: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var list struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	if err := resp.DecodeJSON(&list); err != nil {
+		return nil, err
+	}
+	sort.Strings(list.Data.Keys)
+	return list.Data.Keys, nil
+}
+
+// List the entries of the audit log in Vault, oldest first, up to its head.
+// An entry missing below the head has been removed, and is reported as an
+// error rather than ending the log early.
+func (v *Vault) ListAuditEntries() ([]*AuditEntry, error) {
+	head, err := v.GetAuditHead()
+	if err != nil {
+		return nil, err
+	}
+	var entries []*AuditEntry
+	for i := 1; i <= head.Sequence; i++ {
+		entry, err := v.getAuditEntry(i)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("authority: audit entry %d of %d is missing", i, head.Sequence)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Reads are recorded by Vault's audit devices, with the token's accessor.
+func (v *Vault) AuditsReads() bool {
+	return true
+}
+
+// Identify the caller by the display name and accessor of its Vault token,
+// or by its identity entity if it has one.
+func (v *Vault) Identity() (string, error) {
+	var self struct {
+		Data struct {
+			Accessor    string `json:"accessor"`
+			DisplayName string `json:"display_name"`
+			EntityID    string `json:"entity_id"`
+		} `json:"data"`
+	}
+	if err := v.request("GET", "auth/token/lookup-self", nil, nil, &self); err != nil {
+		return "", err
+	}
+	if self.Data.EntityID != "" {
+		return "entity:" + self.Data.EntityID, nil
+	}
+	return fmt.Sprintf("%s:%s", self.Data.DisplayName, self.Data.Accessor), nil
+}
+
+// tokens
 
 // Create a Vault access token with granular permissions to only access
-// the specified certificate, private key and root certificate.
-func (v *Vault) CreateTokenForCertificate(name string) (string, error) {
+// the specified certificate, private key and root certificate. The token's
+// accessor is recorded so that it can be listed and revoked later.
+func (v *Vault) CreateTokenForCertificate(name string, opts *TokenOptions) (string, error) {
+	if opts == nil {
+		opts = &TokenOptions{}
+	}
+
 	rules := fmt.Sprintf(`
 path "secret/authority/cert" {
   policy = "read"
@@ -83,25 +172,142 @@ path "secret/authority/key/%s" {
 }
 `, name)
 
-	policy := fmt.Sprintf("authority_%s", name)
+	policy := tokenPolicyName(name)
 
 	err := v.Client.Sys().PutPolicy(policy, rules)
 	if err != nil {
 		return "", err
 	}
 
-	request := &api.TokenCreateRequest{
-		NoParent:    true,
-		Policies:    []string{policy},
-		DisplayName: fmt.Sprintf("authority: ro token for %s", name),
+	request := map[string]interface{}{
+		"no_parent":    true,
+		"policies":     []string{policy},
+		"display_name": fmt.Sprintf("authority: ro token for %s", name),
+		"num_uses":     opts.NumUses,
+	}
+	if opts.TTL > 0 {
+		request["ttl"] = opts.TTL.String()
+	}
+
+	headers := map[string]string{}
+	if opts.WrapTTL > 0 {
+		headers["X-Vault-Wrap-TTL"] = opts.WrapTTL.String()
+	}
+
+	var resp struct {
+		Auth *struct {
+			ClientToken string `json:"client_token"`
+			Accessor    string `json:"accessor"`
+		} `json:"auth"`
+		WrapInfo *struct {
+			Token           string `json:"token"`
+			WrappedAccessor string `json:"wrapped_accessor"`
+		} `json:"wrap_info"`
+	}
+	if err := v.request("POST", "auth/token/create", request, headers, &resp); err != nil {
+		return "", err
+	}
+
+	var token, accessor string
+	switch {
+	case resp.WrapInfo != nil:
+		token, accessor = resp.WrapInfo.Token, resp.WrapInfo.WrappedAccessor
+	case resp.Auth != nil:
+		token, accessor = resp.Auth.ClientToken, resp.Auth.Accessor
+	default:
+		return "", fmt.Errorf("authority: vault returned no token")
+	}
+
+	info := TokenInfo{
+		Accessor:  accessor,
+		CreatedAt: time.Now().UTC(),
+		NumUses:   opts.NumUses,
+	}
+	if opts.TTL > 0 {
+		info.ExpiresAt = info.CreatedAt.Add(opts.TTL)
 	}
 
-	secret, err := v.Client.Auth().Token().Create(request)
+	tokens, err := v.getTokenRecords(name)
 	if err != nil {
 		return "", err
 	}
+	if err := v.putTokenRecords(name, append(tokens, info)); err != nil {
+		return "", err
+	}
 
-	return secret.Auth.ClientToken, nil
+	return token, nil
+}
+
+// List the access tokens created for the specified certificate, checking
+// with Vault whether each is still valid.
+func (v *Vault) ListTokensForCertificate(name string) ([]TokenInfo, error) {
+	tokens, err := v.getTokenRecords(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tokens {
+		body := map[string]interface{}{"accessor": tokens[i].Accessor}
+		tokens[i].Valid = v.request("POST", "auth/token/lookup-accessor", body, nil, nil) == nil
+	}
+	return tokens, nil
+}
+
+// Revoke every access token created for the specified certificate, and
+// delete the certificate's access policy.
+func (v *Vault) RevokeTokensForCertificate(name string) error {
+	tokens, err := v.getTokenRecords(name)
+	if err != nil {
+		return err
+	}
+
+	var result *multierror.Error
+	for _, token := range tokens {
+		body := map[string]interface{}{"accessor": token.Accessor}
+		if err := v.request("POST", "auth/token/revoke-accessor", body, nil, nil); err != nil {
+			result = multierror.Append(result, fmt.Errorf("revoking token %s: %v", token.Accessor, err))
+		}
+	}
+
+	if err := v.Client.Sys().DeletePolicy(tokenPolicyName(name)); err != nil {
+		result = multierror.Append(result, fmt.Errorf("deleting policy: %v", err))
+	}
+
+	if result != nil {
+		return result
+	}
+
+	_, err = v.Client.Logical().Delete(tokensPath(name))
+	return err
+}
+
+// gets
+
+// Load the head of the audit log from Vault. A log written before heads were
+// recorded has its head taken from the last of its consecutive entries.
+func (v *Vault) GetAuditHead() (*AuditHead, error) {
+	data, err := v.getBytes(auditHeadPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		head := &AuditHead{}
+		if err := json.Unmarshal(data, head); err != nil {
+			return nil, fmt.Errorf("authority: cannot parse audit log head: %v", err)
+		}
+		return head, nil
+	}
+	var entries []*AuditEntry
+	for i := 1; ; i++ {
+		entry, err := v.getAuditEntry(i)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			return headOf(entries), nil
+		}
+		entries = append(entries, entry)
+	}
 }
 
 // Load authority configuraiton information from Vault.
@@ -136,6 +342,32 @@ func (v *Vault) GetCertificate(name string) (*x509.Certificate, error) {
 	}
 }
 
+// Load every version of a certificate from Vault, oldest first and ending
+// with the current certificate.
+func (v *Vault) GetCertificateVersions(name string) ([]*x509.Certificate, error) {
+	var versions []*x509.Certificate
+	for i := 1; ; i++ {
+		data, err := v.getBytes(versionPath(name, i))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			break
+		}
+		pem, _ := pem.Decode(data)
+		cert, _ := x509.ParseCertificate(pem.Bytes)
+		versions = append(versions, cert)
+	}
+	if v.CheckCertificateExists(name) {
+		cert, err := v.GetCertificate(name)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, cert)
+	}
+	return versions, nil
+}
+
 // Load the root certificate revocation list from Vault.
 func (v *Vault) GetCRLRaw(name string) []byte {
 	path := fmt.Sprintf("secret/authority/crl/%s", name)
@@ -150,10 +382,28 @@ func (v *Vault) GetCRLRaw(name string) []byte {
 	}
 }
 
-// Get the next unused serial number in sequence from Vault.
-func (v *Vault) GetNextSerialNumber() *big.Int {
+// Load the metadata record of a certificate from Vault. A certificate
+// without a record has empty metadata.
+func (v *Vault) GetMetadata(name string) (*Metadata, error) {
+	meta := &Metadata{}
+	data, err := v.getBytes(fmt.Sprintf("secret/authority/meta/%s", name))
+	if err != nil || len(data) == 0 {
+		return meta, err
+	}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, fmt.Errorf("authority: cannot parse metadata of %s: %v", name, err)
+	}
+	return meta, nil
+}
+
+// Get the next unused serial number in the provided root CA's sequence from
+// Vault. The default root CA keeps the original serial path.
+func (v *Vault) GetNextSerialNumber(ca string) *big.Int {
 	curr := big.NewInt(1)
 	path := "secret/authority/serial"
+	if ca != "ca" {
+		path = fmt.Sprintf("secret/authority/serial/%s", ca)
+	}
 	data, err := v.getBytes(path)
 	if err != nil {
 		return curr
@@ -176,6 +426,8 @@ func (v *Vault) GetPrivateKey(name string) (*rsa.PrivateKey, error) {
 	data, err := v.getBytes(path)
 	if err != nil {
 		return nil, err
+	} else if len(data) == 0 {
+		return nil, fmt.Errorf("authority: private key %s does not exist", name)
 	} else {
 		pem, _ := pem.Decode(data)
 		key, _ := x509.ParsePKCS1PrivateKey(pem.Bytes)
@@ -192,8 +444,19 @@ func (v *Vault) PutConfig(config string) error {
 	return err
 }
 
-// Store the provided certificate in PEM format in Vault.
+// Store the provided certificate in PEM format in Vault. A different
+// certificate already stored under the name is kept as its next previous
+// version.
 func (v *Vault) PutCertificate(name string, cert *x509.Certificate) error {
+	if current, err := v.getCertificateBytes(name); err == nil && len(current) > 0 {
+		block, _ := pem.Decode(current)
+		if block != nil && !bytes.Equal(block.Bytes, cert.Raw) {
+			if err := v.archiveCertificate(name, current); err != nil {
+				return err
+			}
+		}
+	}
+
 	path := fmt.Sprintf("secret/authority/cert/%s", name)
 	err := v.putBytes(path, pem.EncodeToMemory(&pem.Block{
 		Type:  "CERTIFICATE",
@@ -225,8 +488,179 @@ func (v *Vault) PutCRL(name string, crlBytes []byte) error {
 	}))
 }
 
+// Store the metadata record of a certificate as JSON in Vault.
+func (v *Vault) PutMetadata(name string, meta *Metadata) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return v.putBytes(fmt.Sprintf("secret/authority/meta/%s", name), data)
+}
+
+// Store the provided entry in the audit log in Vault, under its sequence
+// number, and record it as the head of the log. The entry must follow the
+// current head. Vault's generic backend cannot write conditionally, so the
+// head is checked before the entry is written and the entry is read back
+// afterwards; a writer that lost a race moves the head to the winning entry
+// and returns ErrAuditConflict, as does one that finds the next entry
+// already written by a writer that has not moved the head yet.
+func (v *Vault) AppendAuditEntry(entry *AuditEntry) error {
+	head, err := v.GetAuditHead()
+	if err != nil {
+		return err
+	}
+	if !head.Follows(entry) {
+		return ErrAuditConflict
+	}
+	existing, err := v.getAuditEntry(entry.Sequence)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if head.Follows(existing) {
+			if err := v.putAuditHead(existing); err != nil {
+				return err
+			}
+		}
+		return ErrAuditConflict
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := v.putBytes(auditPath(entry.Sequence), data); err != nil {
+		return err
+	}
+	if err := v.putAuditHead(entry); err != nil {
+		return err
+	}
+	stored, err := v.getAuditEntry(entry.Sequence)
+	if err != nil {
+		return err
+	}
+	if stored == nil || stored.Hash != entry.Hash {
+		if stored != nil {
+			if err := v.putAuditHead(stored); err != nil {
+				return err
+			}
+		}
+		return ErrAuditConflict
+	}
+	return nil
+}
+
 // private functionality
 
+func (v *Vault) archiveCertificate(name string, data []byte) error {
+	version := 1
+	for {
+		existing, err := v.getBytes(versionPath(name, version))
+		if err != nil {
+			return err
+		}
+		if len(existing) == 0 {
+			break
+		}
+		version++
+	}
+	return v.putBytes(versionPath(name, version), data)
+}
+
+func (v *Vault) getAuditEntry(sequence int) (*AuditEntry, error) {
+	data, err := v.getBytes(auditPath(sequence))
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	entry := &AuditEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("authority: cannot parse audit entry %d: %v", sequence, err)
+	}
+	return entry, nil
+}
+
+func (v *Vault) putAuditHead(entry *AuditEntry) error {
+	data, err := json.Marshal(headFor(entry))
+	if err != nil {
+		return err
+	}
+	return v.putBytes(auditHeadPath, data)
+}
+
+const auditHeadPath = "secret/authority/audit-head"
+
+func auditPath(sequence int) string {
+	return fmt.Sprintf("secret/authority/audit/%d", sequence)
+}
+
+// Previous versions of a certificate are numbered from 1, oldest first.
+func versionPath(name string, version int) string {
+	return fmt.Sprintf("secret/authority/history/%s/%d", name, version)
+}
+
+func tokenPolicyName(name string) string {
+	return fmt.Sprintf("authority_%s", name)
+}
+
+func tokensPath(name string) string {
+	return fmt.Sprintf("secret/authority/tokens/%s", name)
+}
+
+func (v *Vault) getTokenRecords(name string) ([]TokenInfo, error) {
+	data, err := v.getBytes(tokensPath(name))
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	var tokens []TokenInfo
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("authority: invalid token records for %s: %v", name, err)
+	}
+	return tokens, nil
+}
+
+func (v *Vault) putTokenRecords(name string, tokens []TokenInfo) error {
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	return v.putBytes(tokensPath(name), data)
+}
+
+// request performs a raw Vault API request with additional headers, which
+// the Vault client does not support, decoding the JSON response into out if
+// it is not nil.
+func (v *Vault) request(method, path string, body interface{}, headers map[string]string, out interface{}) error {
+	r := v.Client.NewRequest(method, "/v1/"+path)
+	if body != nil {
+		if err := r.SetJSONBody(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := r.ToHTTP()
+	if err != nil {
+		return err
+	}
+	for k, value := range headers {
+		req.Header.Set(k, value)
+	}
+
+	httpResp, err := v.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	resp := &api.Response{Response: httpResp}
+	if err := resp.Error(); err != nil {
+		return err
+	}
+	if out != nil {
+		return resp.DecodeJSON(out)
+	}
+	return nil
+}
+
 func (v *Vault) getCertificateBytes(name string) ([]byte, error) {
 	path := fmt.Sprintf("secret/authority/cert/%s", name)
 	data, err := v.getBytes(path)
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ovrclk/authority/agent"
+	"github.com/ovrclk/authority/config"
+)
+
+// Renew reissues the certificate with the provided common name with a new
+// key, and displays its new serial number and expiry.
+func (c *Client) Renew(name string) error {
+	cert, err := c.api.Renew(name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("authority: renewed %s, serial %x, expires %s\n", name, cert.Certificate.SerialNumber, cert.Certificate.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// RenewExpiring renews every stored certificate with the provided labels
+// which expires within the provided window, such as "30d", and displays the
+// new serial number and expiry of each.
+func (c *Client) RenewExpiring(within string, filters []string) error {
+	window, err := config.ParseTTL(within)
+	if err != nil {
+		return fmt.Errorf("authority: %v", err)
+	}
+	filter, err := parseLabels(filters)
+	if err != nil {
+		return err
+	}
+	renewed, err := c.api.RenewExpiring(window, filter)
+	for _, cert := range renewed {
+		fmt.Printf("authority: renewed %s, serial %x, expires %s\n", cert.CommonName, cert.Certificate.SerialNumber, cert.Certificate.NotAfter.Format(time.RFC3339))
+	}
+	return err
+}
+
+// RunAgent runs the renewal agent with the configuration file at the
+// provided path until it is interrupted, or checks every certificate a single
+// time if once is true.
+func (c *Client) RunAgent(configPath string, once bool) error {
+	cfg, err := agent.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	a, err := agent.New(c.api, cfg, log.New(os.Stderr, "authority agent: ", log.LstdFlags))
+	if err != nil {
+		return err
+	}
+
+	if once {
+		return a.RunOnce()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	stop := make(chan struct{})
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	a.Run(stop)
+	return nil
+}
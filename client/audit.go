@@ -0,0 +1,35 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// AuditLog displays the entries of the audit log, oldest first.
+func (c *Client) AuditLog() error {
+	entries, err := c.api.AuditLog()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("audit log is empty")
+		return nil
+	}
+
+	fmt.Printf("%-6s  %-20s  %-16s  %-20s  %-32s  %s\n", "SEQ", "TIME", "ACTOR", "OPERATION", "TARGET", "SERIAL")
+	for _, e := range entries {
+		fmt.Printf("%-6d  %-20s  %-16s  %-20s  %-32s  %s\n", e.Sequence, e.Time.Format(time.RFC3339), e.Actor, e.Operation, e.Target, e.Serial)
+	}
+	return nil
+}
+
+// VerifyAuditLog checks the hash chain of the audit log and reports the
+// number of entries verified.
+func (c *Client) VerifyAuditLog() error {
+	n, err := c.api.VerifyAuditLog()
+	if err != nil {
+		return fmt.Errorf("%v, %d entries before it verified", err, n)
+	}
+	fmt.Println("audit log verified,", n, "entries")
+	return nil
+}
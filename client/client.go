@@ -7,12 +7,16 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/big"
 	"net"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ovrclk/authority/api"
 	"github.com/ovrclk/authority/authority"
+	"github.com/ovrclk/authority/backend"
 	"github.com/ovrclk/authority/config"
 	"github.com/ovrclk/authority/util"
 )
@@ -22,6 +26,7 @@ import (
 type Client struct {
 	api    *api.Client
 	config *config.Config
+	ca     string
 }
 
 // Create a new Client.
@@ -39,15 +44,46 @@ func NewClient(backend, server, token, path string) *Client {
 	if err != nil {
 		log.Fatal(err)
 	}
+	c.api.Actor = currentUser()
 
 	c.loadConfig()
+	c.UseCA("")
 
 	return c
 }
 
-// Generate the root certificate if it does not exist already.
-func (c *Client) GenerateCA() error {
-	_, err := c.api.GetCA()
+// UseAuditKey keys the hashes of new audit log entries with the provided
+// key, and verifies keyed entries with it.
+func (c *Client) UseAuditKey(key string) {
+	c.api.AuditKey = []byte(key)
+}
+
+// UseSigners makes the provided signers, keyed by CA name, sign on behalf of
+// those CAs instead of private keys stored in the backend.
+func (c *Client) UseSigners(signers map[string]config.SignerConfig) error {
+	for name, cfg := range signers {
+		if err := c.api.SetSignerConfig(name, cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseCA selects the root CA whose hierarchy subsequent commands work in. An
+// empty name selects the default root, "ca".
+func (c *Client) UseCA(name string) {
+	if name == "" {
+		name = authority.DefaultCA
+	}
+	c.ca = name
+	c.api.UseCA(name)
+}
+
+// Generate the root certificate if it does not exist already. If
+// keyInBackend is true, the root private key is generated and held by the
+// backend.
+func (c *Client) GenerateCA(keyInBackend bool) error {
+	_, err := c.api.CreateCA(&api.Options{KeyInBackend: keyInBackend})
 	return err
 }
 
@@ -56,54 +92,44 @@ func (c *Client) SetCertificate(name string, cert *x509.Certificate, key *rsa.Pr
 	return c.api.SetCertificate(name, cert, key)
 }
 
-// SetConfig loads and stores the provided configuration file.
-func (c *Client) SetConfig(configPath string) error {
+// SetConfig loads, validates and stores the provided configuration file. The
+// file may be TOML, HCL or JSON, as indicated by its extension. If check is
+// true the configuration is only validated, not stored.
+func (c *Client) SetConfig(configPath string, check bool) error {
 	data, err := ioutil.ReadFile(configPath)
 	if err != nil {
 		return fmt.Errorf("authority: error reading config file (%s): %v", configPath, err)
 	}
-	config, err := config.OpenConfig(string(data))
+	cfg, err := config.ParseConfig(string(data), config.FormatFromPath(configPath))
 	if err != nil {
 		return err
 	}
-	err = c.api.SetConfig(config)
-	if err != nil {
-		return fmt.Errorf("authority: cannot store configuration: %v", err)
-	}
-	fmt.Println("authority: configuration stored")
-	return nil
+	return c.storeConfig(cfg, check)
 }
 
-func (c *Client) SetConfigItem(key, value string) error {
-	if !config.KeyIsValid(key) {
-		return fmt.Errorf("authority: \"%s\" is not a valid configuration key", key)
-	}
-	cfg, err := c.api.GetConfig()
-	if err != nil && err != authority.ErrConfigMissing {
+// SetConfigItem validates and stores a single configuration value. If check
+// is true the resulting configuration is only validated, not stored.
+func (c *Client) SetConfigItem(key, value string, check bool) error {
+	cfg, err := c.existingConfig()
+	if err != nil {
 		return err
 	}
-	if cfg == nil {
-		cfg = &config.Config{}
-	}
-
-	cfg.SetItem(key, value)
 
-	err = c.api.SetConfig(cfg)
-	if err != nil {
-		return fmt.Errorf("authority: cannot store configuration: %v", err)
+	if err = cfg.SetItem(key, value); err != nil {
+		return err
 	}
-	fmt.Println("authority: configuration stored")
-	return nil
+
+	return c.storeConfig(cfg, check)
 }
 
-func (c *Client) SetAllConfig() error {
-	cfg, err := c.api.GetConfig()
-	if err != nil && err != authority.ErrConfigMissing {
+// SetAllConfig prompts for every configuration value, then validates and
+// stores the result. If check is true the resulting configuration is only
+// validated, not stored.
+func (c *Client) SetAllConfig(check bool) error {
+	cfg, err := c.existingConfig()
+	if err != nil {
 		return err
 	}
-	if cfg == nil {
-		cfg = &config.Config{}
-	}
 
 	r := bufio.NewReader(os.Stdin)
 	for _, v := range cfg.GetConfigKeys() {
@@ -112,16 +138,40 @@ func (c *Client) SetAllConfig() error {
 		if err != nil {
 			return err
 		}
-		cfg.SetItem(v, strings.TrimSpace(input))
+		if err = cfg.SetItem(v, strings.TrimSpace(input)); err != nil {
+			return err
+		}
 	}
 
-	err = c.api.SetConfig(cfg)
+	return c.storeConfig(cfg, check)
+}
+
+func (c *Client) existingConfig() (*config.Config, error) {
+	cfg, err := c.api.GetConfig()
+	if err != nil && err != authority.ErrConfigMissing {
+		return nil, err
+	}
+	if cfg == nil {
+		cfg = config.New()
+	}
+	return cfg, nil
+}
+
+func (c *Client) storeConfig(cfg *config.Config, check bool) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if check {
+		fmt.Println("authority: configuration is valid")
+		return nil
+	}
+
+	err := c.api.SetConfig(cfg)
 	if err != nil {
 		return fmt.Errorf("authority: cannot store configuration: %v", err)
 	}
 	fmt.Println("authority: configuration stored")
 	return nil
-
 }
 
 // GetConfig displays the stored config, if it exists.
@@ -131,56 +181,244 @@ func (c *Client) GetConfig() error {
 		return err
 	}
 	if cfg == nil {
-		cfg = &config.Config{}
+		cfg = config.New()
 	}
 	configStr, err := cfg.ToString()
 	if err != nil {
 		return err
 	}
 	fmt.Println(configStr)
+
+	for name := range cfg.Roles {
+		if _, err := cfg.GetRole(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetRole displays and validates the stored role with the provided name, as
+// it applies to the selected root CA.
+func (c *Client) GetRole(name string) error {
+	cfg, err := c.api.GetConfig()
+	if err != nil {
+		return err
+	}
+	role, err := cfg.ForCA(c.ca).GetRole(name)
+	if err != nil {
+		return err
+	}
+	roleStr, err := role.ToString(name)
+	if err != nil {
+		return err
+	}
+	fmt.Println(roleStr)
+	fmt.Printf("authority: role %s is valid\n", name)
 	return nil
 }
 
+// CertificateFlags holds the command line values used when creating a
+// certificate.
+type CertificateFlags struct {
+	Role        string
+	Parent      string
+	DNSNames    string
+	IPAddresses string
+
+	Country      string
+	Org          string
+	OrgUnit      string
+	City         string
+	Region       string
+	Email        string
+	SerialNumber string
+	Attributes   []string
+
+	Token TokenFlags
+
+	KeyInBackend bool
+
+	// PublicKeyFile is a PEM public key to certify, storing only the
+	// certificate, and KeyFile a PEM RSA private key to certify and store.
+	PublicKeyFile string
+	KeyFile       string
+
+	// Labels are key=value metadata, such as owner=alice.
+	Labels []string
+}
+
+// TokenFlags holds the command line values used when creating a backend
+// access token for a certificate.
+type TokenFlags struct {
+	TTL     string
+	Uses    int
+	WrapTTL string
+}
+
 // Generate creates and a certificate for the provided common name.
 // It will also generate and display a backend access token with granular
 // permissions to access the certificate.
-func (c *Client) Generate(name string, parent string, dnsNames string, ipAddresses string) error {
-	var altNames []string
-	for _, name := range strings.Split(dnsNames, ",") {
-		trimmedName := strings.TrimSpace(name)
-		if trimmedName != "" {
-			altNames = append(altNames, trimmedName)
-		}
+func (c *Client) Generate(name string, flags *CertificateFlags) error {
+	opts, err := flags.toOptions()
+	if err != nil {
+		return err
 	}
 
-	var altIPs []net.IP
-	for _, ipString := range strings.Split(ipAddresses, ",") {
-		ip := net.ParseIP(strings.TrimSpace(ipString))
-		if ip != nil {
-			altIPs = append(altIPs, ip)
-		}
+	_, token, err := c.api.GenerateFromOptions(name, opts)
+	if err != nil {
+		return err
 	}
 
-	_, token, err := c.api.GenerateWithOptions(name, parent, altNames, altIPs)
+	flags.Token.printToken(name, token)
+	return nil
+}
+
+// CreateToken creates and displays a new backend access token for the
+// certificate with the provided common name.
+func (c *Client) CreateToken(name string, flags *TokenFlags) error {
+	opts, err := flags.toOptions()
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("access token for %s: %s", name, token)
+	token, err := c.api.CreateToken(name, opts)
+	if err != nil {
+		return err
+	}
+
+	flags.printToken(name, token)
 	return nil
 }
 
+// ListTokens displays the accessors of the backend access tokens created for
+// the certificate with the provided common name.
+func (c *Client) ListTokens(name string) error {
+	tokens, err := c.api.ListTokens(name)
+	if err != nil {
+		return err
+	}
+
+	if len(tokens) == 0 {
+		fmt.Println("no tokens for", name)
+		return nil
+	}
+
+	fmt.Printf("%-36s  %-20s  %-20s  %-4s  %s\n", "ACCESSOR", "CREATED", "EXPIRES", "USES", "STATUS")
+	for _, t := range tokens {
+		expires := "never"
+		if !t.ExpiresAt.IsZero() {
+			expires = t.ExpiresAt.Format(time.RFC3339)
+		}
+		uses := "-"
+		if t.NumUses > 0 {
+			uses = strconv.Itoa(t.NumUses)
+		}
+		status := "invalid"
+		if t.Valid {
+			status = "valid"
+		}
+		fmt.Printf("%-36s  %-20s  %-20s  %-4s  %s\n", t.Accessor, t.CreatedAt.Format(time.RFC3339), expires, uses, status)
+	}
+	return nil
+}
+
+func (f *TokenFlags) toOptions() (*backend.TokenOptions, error) {
+	opts := &backend.TokenOptions{NumUses: f.Uses}
+	var err error
+	if f.TTL != "" {
+		if opts.TTL, err = config.ParseTTL(f.TTL); err != nil {
+			return nil, fmt.Errorf("authority: %v", err)
+		}
+	}
+	if f.WrapTTL != "" {
+		if opts.WrapTTL, err = config.ParseTTL(f.WrapTTL); err != nil {
+			return nil, fmt.Errorf("authority: %v", err)
+		}
+	}
+	if f.Uses < 0 {
+		return nil, fmt.Errorf("authority: token uses cannot be negative")
+	}
+	return opts, nil
+}
+
+func (f *TokenFlags) printToken(name, token string) {
+	if f.WrapTTL != "" {
+		fmt.Printf("wrapped access token for %s (unwrap within %s): %s", name, f.WrapTTL, token)
+	} else {
+		fmt.Printf("access token for %s: %s", name, token)
+	}
+}
+
+func (f *CertificateFlags) toOptions() (*api.Options, error) {
+	token, err := f.Token.toOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &api.Options{
+		Token:        *token,
+		KeyInBackend: f.KeyInBackend,
+		Role:         f.Role,
+		Parent:       f.Parent,
+		DNSNames:     splitList(f.DNSNames),
+		IPAddresses:  parseIPs(f.IPAddresses),
+		Subject: authority.Subject{
+			Country:            f.Country,
+			Organization:       f.Org,
+			OrganizationalUnit: f.OrgUnit,
+			Locality:           f.City,
+			Province:           f.Region,
+			EmailAddress:       f.Email,
+			SerialNumber:       f.SerialNumber,
+		},
+	}
+
+	if opts.Labels, err = parseLabels(f.Labels); err != nil {
+		return nil, err
+	}
+	opts.CreatedBy = currentUser()
+
+	if f.PublicKeyFile != "" {
+		if opts.PublicKey, err = util.GetPublicKeyFromPath(f.PublicKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	if f.KeyFile != "" {
+		if opts.PrivateKey, err = util.GetKeyFromPath(f.KeyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, attr := range f.Attributes {
+		rdn, err := util.ParseRDN(attr)
+		if err != nil {
+			return nil, err
+		}
+		opts.Subject.ExtraNames = append(opts.Subject.ExtraNames, rdn)
+	}
+
+	return opts, nil
+}
+
 // GetCert displays the certificate for the provided common name, assuming that
-// it exists already.
+// it exists already. A non-zero version displays that version of the
+// certificate instead of the current one.
 //
 // The certificate will be displayed in a PEM encoded format.
-func (c *Client) GetCert(name string, format string) error {
-	cert, err := c.api.Get(name)
+func (c *Client) GetCert(name string, format string, version int) error {
+	cert, err := c.api.GetCertificate(name)
 	if err != nil {
 		return err
 	}
+	if version != 0 {
+		v, err := c.api.GetVersion(name, version)
+		if err != nil {
+			return err
+		}
+		cert = v.Certificate
+	}
 
-	certCert := util.GetPEMFromCertificate(cert.Certificate)
+	certCert := util.GetPEMFromCertificate(cert)
 	if format == "base64" {
 		certCert = util.Base64String(certCert)
 	}
@@ -197,6 +435,12 @@ func (c *Client) GetKey(name string, format string) error {
 	if err != nil {
 		return err
 	}
+	if cert.KeyIsHeld {
+		return authority.ErrKeyNotExportable
+	}
+	if cert.PublicOnly {
+		return authority.ErrKeyOffline
+	}
 
 	privateKey := util.GetPEMFromKey(cert.PrivateKey)
 	if format == "base64" {
@@ -206,36 +450,89 @@ func (c *Client) GetKey(name string, format string) error {
 	return nil
 }
 
-// GetCRL outputs the certificate revocation list for the certificate
+// GetCRL outputs the certificate revocation list for the CA certificate
 // with the provided common name.
 //
-// The certificate revocation list will be output as raw bytes.
+// The certificate revocation list will be output as DER encoded bytes.
 func (c *Client) GetCRL(name string) error {
-	if name != "ca" {
-		return fmt.Errorf("authority: subcertificate revocation not implemented")
-	}
-
-	root, err := c.api.GetCA()
+	crlBytes, err := c.api.GetCRL(name)
 	if err != nil {
 		return err
 	}
 
-	crlBytes := root.CRL.TBSCertList.Raw
 	f := os.Stdout
 	f.Write(crlBytes)
 	f.Close()
 	return nil
 }
 
-// Revoke adds the certificate with the provided common name to the root
-// certificates certificate revocation list, assuming that the indicated
-// certificate exists.
-func (c *Client) Revoke(name string) error {
-	err := c.api.Revoke(name)
+// Revoke adds the certificate with the provided common name to the
+// certificate revocation list of the CA that issued it, assuming that the
+// indicated certificate exists. With cascade, every certificate issued
+// below it is revoked too. A non-zero version revokes that version of the
+// certificate instead of the current one. All revoked certificates are
+// listed.
+func (c *Client) Revoke(name string, cascade bool, version int) error {
+	revoked, err := c.api.RevokeWithOptions(name, &api.RevokeOptions{
+		Cascade: cascade,
+		Version: version,
+	})
+	for _, n := range revoked {
+		if version != 0 {
+			fmt.Println("certificate", n, "version", version, "revoked")
+			continue
+		}
+		fmt.Println("certificate", n, "revoked")
+	}
+	return err
+}
+
+// RevokeCertificate adds the certificate at the provided path to the
+// certificate revocation list of the stored CA that signed it, whether or
+// not the certificate is in the store.
+func (c *Client) RevokeCertificate(certPath string) error {
+	cert, err := util.GetCertificateFromPath(certPath)
+	if err != nil {
+		return err
+	}
+	if err := c.api.RevokeCertificate(cert, authority.ReasonUnspecified); err != nil {
+		return err
+	}
+	fmt.Println("certificate", cert.SerialNumber.Text(16), "revoked")
+	return nil
+}
+
+// RevokeSerial adds the hex encoded serial number to the certificate
+// revocation list of the issuer with the provided name, or the selected CA
+// if issuer is empty.
+func (c *Client) RevokeSerial(issuer, serial string) error {
+	n, err := parseSerial(serial)
 	if err != nil {
 		return err
 	}
-	fmt.Println("certificate", name, "revoked")
+	if err := c.api.RevokeSerial(issuer, n, authority.ReasonUnspecified); err != nil {
+		return err
+	}
+	fmt.Println("certificate", n.Text(16), "revoked")
+	return nil
+}
+
+// Hold suspends the certificate with the provided common name by putting it
+// on hold in its issuer's certificate revocation list.
+func (c *Client) Hold(name string) error {
+	if err := c.api.Hold(name); err != nil {
+		return err
+	}
+	fmt.Println("certificate", name, "on hold")
+	return nil
+}
+
+// Release lifts the hold on the certificate with the provided common name.
+func (c *Client) Release(name string) error {
+	if err := c.api.Release(name); err != nil {
+		return err
+	}
+	fmt.Println("certificate", name, "released")
 	return nil
 }
 
@@ -248,3 +545,36 @@ func (c *Client) loadConfig() error {
 
 	return nil
 }
+
+// parseSerial parses a hex serial number, allowing a 0x prefix and colon
+// separated bytes as openssl prints them.
+func parseSerial(serial string) (*big.Int, error) {
+	hex := strings.TrimPrefix(strings.ToLower(strings.Replace(serial, ":", "", -1)), "0x")
+	n, ok := new(big.Int).SetString(hex, 16)
+	if !ok {
+		return nil, fmt.Errorf("authority: invalid serial number %s, expected hex", serial)
+	}
+	return n, nil
+}
+
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		trimmed := strings.TrimSpace(item)
+		if trimmed != "" {
+			items = append(items, trimmed)
+		}
+	}
+	return items
+}
+
+func parseIPs(list string) []net.IP {
+	var ips []net.IP
+	for _, ipString := range strings.Split(list, ",") {
+		ip := net.ParseIP(strings.TrimSpace(ipString))
+		if ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
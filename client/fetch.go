@@ -0,0 +1,205 @@
+package client
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ovrclk/authority/util"
+)
+
+// Default file names written by Fetch.
+const (
+	DefaultCertFile  = "cert.pem"
+	DefaultKeyFile   = "key.pem"
+	DefaultChainFile = "chain.pem"
+	DefaultCAFile    = "ca.pem"
+)
+
+// FetchFlags holds the command line values used when writing a certificate
+// and its key to files.
+type FetchFlags struct {
+	Dir string
+
+	// CertFile, KeyFile, ChainFile and CAFile name the files written in
+	// Dir. A file with an empty name is not written.
+	CertFile  string
+	KeyFile   string
+	ChainFile string
+	CAFile    string
+
+	// Owner is the user, and optionally the group, given as user:group, to
+	// own the written files.
+	Owner string
+
+	// PassphraseFile holds the passphrase used to encrypt the key.
+	PassphraseFile string
+
+	// Force overwrites a certificate file holding a newer certificate.
+	Force bool
+}
+
+// Fetch writes the certificate with the provided common name, its private
+// key, the chain of intermediate CAs above it and the bundle of roots to
+// trust into flags.Dir. The key is written with mode 0600 and the other
+// files with mode 0644, each replaced atomically. An existing certificate
+// file holding a certificate issued later than the stored one is not
+// overwritten unless flags.Force is set.
+func (c *Client) Fetch(name string, flags *FetchFlags) error {
+	if flags.Dir == "" {
+		return fmt.Errorf("authority: output directory required")
+	}
+	uid, gid, err := parseOwner(flags.Owner)
+	if err != nil {
+		return err
+	}
+	var passphrase []byte
+	if flags.PassphraseFile != "" {
+		if passphrase, err = readPassphrase(flags.PassphraseFile); err != nil {
+			return err
+		}
+	}
+
+	var files []outputFile
+	cert, err := c.api.GetCertificate(name)
+	if err != nil {
+		return err
+	}
+	if flags.KeyFile != "" {
+		stored, err := c.api.Get(name)
+		if err != nil {
+			return err
+		}
+		if stored.PrivateKey == nil {
+			return fmt.Errorf("authority: private key of %s cannot be exported, omit it with --key-file \"\"", name)
+		}
+		key := util.GetPEMBytesFromKey(stored.PrivateKey)
+		if passphrase != nil {
+			if key, err = util.GetEncryptedPEMBytesFromKey(stored.PrivateKey, passphrase); err != nil {
+				return err
+			}
+		}
+		cert = stored.Certificate
+		files = append(files, outputFile{flags.KeyFile, 0600, key})
+	}
+	if flags.CertFile != "" {
+		if !flags.Force {
+			if err := checkNotNewer(filepath.Join(flags.Dir, flags.CertFile), cert); err != nil {
+				return err
+			}
+		}
+		files = append(files, outputFile{flags.CertFile, 0644, util.GetPEMBytesFromCertificate(cert)})
+	}
+	if flags.ChainFile != "" {
+		chain, err := c.api.Chain(name)
+		if err != nil {
+			return err
+		}
+		files = append(files, outputFile{flags.ChainFile, 0644, pemBundle(chain)})
+	}
+	if flags.CAFile != "" {
+		bundle, err := c.api.TrustBundle()
+		if err != nil {
+			return err
+		}
+		files = append(files, outputFile{flags.CAFile, 0644, pemBundle(bundle)})
+	}
+
+	if err := os.MkdirAll(flags.Dir, 0755); err != nil {
+		return fmt.Errorf("authority: unable to create %s: %v", flags.Dir, err)
+	}
+	for _, f := range files {
+		path := filepath.Join(flags.Dir, f.name)
+		if err := util.WriteFileAtomic(path, f.data, f.mode, uid, gid); err != nil {
+			return err
+		}
+		fmt.Printf("authority: wrote %s\n", path)
+	}
+	return nil
+}
+
+type outputFile struct {
+	name string
+	mode os.FileMode
+	data []byte
+}
+
+// checkNotNewer returns an error if the certificate file at path holds a
+// certificate issued after cert.
+func checkNotNewer(path string, cert *x509.Certificate) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("authority: unable to read %s: %v", path, err)
+	}
+	existing, err := util.GetCertificateFromPEMBytes(data)
+	if err != nil {
+		return fmt.Errorf("authority: %s does not hold a certificate, use --force to overwrite it", path)
+	}
+	if existing.NotBefore.After(cert.NotBefore) {
+		return fmt.Errorf("authority: %s holds a newer certificate issued %s, use --force to overwrite it", path, existing.NotBefore.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// parseOwner resolves an owner given as user, user:group or :group, by name
+// or numeric id, returning -1 for ids to leave unchanged. A user without a
+// group selects the user's primary group.
+func parseOwner(owner string) (int, int, error) {
+	uid, gid := -1, -1
+	if owner == "" {
+		return uid, gid, nil
+	}
+
+	parts := strings.SplitN(owner, ":", 2)
+	if parts[0] != "" {
+		u, err := user.Lookup(parts[0])
+		if err != nil {
+			if u, err = user.LookupId(parts[0]); err != nil {
+				return 0, 0, fmt.Errorf("authority: unknown user %s", parts[0])
+			}
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+		gid, _ = strconv.Atoi(u.Gid)
+	}
+	if len(parts) == 2 && parts[1] != "" {
+		g, err := user.LookupGroup(parts[1])
+		if err != nil {
+			if g, err = user.LookupGroupId(parts[1]); err != nil {
+				return 0, 0, fmt.Errorf("authority: unknown group %s", parts[1])
+			}
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+	return uid, gid, nil
+}
+
+// readPassphrase reads a passphrase from the first line of the file at path.
+func readPassphrase(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("authority: unable to read passphrase file %v", err)
+	}
+	passphrase := bytes.TrimRight(bytes.SplitN(data, []byte("\n"), 2)[0], "\r")
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("authority: passphrase file %s is empty", path)
+	}
+	return passphrase, nil
+}
+
+func pemBundle(certs []*x509.Certificate) []byte {
+	var bundle []byte
+	for _, cert := range certs {
+		bundle = append(bundle, util.GetPEMBytesFromCertificate(cert)...)
+	}
+	return bundle
+}
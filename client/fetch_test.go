@@ -0,0 +1,126 @@
+package client
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ovrclk/authority/api"
+	"github.com/ovrclk/authority/config"
+	"github.com/ovrclk/authority/util"
+)
+
+// testClient returns a Client for a new file store at path holding a root.
+func testClient(t *testing.T, path string) *Client {
+	c := NewClient("file", "", "", path)
+	err := c.api.SetConfig(&config.Config{
+		Defaults: config.DefaultsConfig{
+			RootDomain: "ovrclk.com",
+			Org:        "Ovrclk",
+			Country:    "USA",
+			CrlDays:    "365",
+			Digest:     "sha256",
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := c.api.CreateCA(&api.Options{}); err != nil {
+		t.Fatalf("error creating ca: %v", err)
+	}
+	return c
+}
+
+func TestFetch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authority")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := testClient(t, filepath.Join(dir, "store"))
+	intermediate, _, err := c.api.Generate("intermediate")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, _, err := c.api.GenerateWithParent("web", "intermediate"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	passphraseFile := filepath.Join(dir, "passphrase")
+	if err := ioutil.WriteFile(passphraseFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	out := filepath.Join(dir, "tls")
+	flags := &FetchFlags{
+		Dir:            out,
+		CertFile:       DefaultCertFile,
+		KeyFile:        DefaultKeyFile,
+		ChainFile:      DefaultChainFile,
+		CAFile:         DefaultCAFile,
+		PassphraseFile: passphraseFile,
+	}
+	if err := c.Fetch("web", flags); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for file, mode := range map[string]os.FileMode{DefaultCertFile: 0644, DefaultKeyFile: 0600, DefaultChainFile: 0644, DefaultCAFile: 0644} {
+		info, err := os.Stat(filepath.Join(out, file))
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Fatalf("expected %s with mode %o, got %o", file, mode, info.Mode().Perm())
+		}
+	}
+	chain, err := util.GetCertificateFromPath(filepath.Join(out, DefaultChainFile))
+	if err != nil || !chain.Equal(intermediate.Certificate) {
+		t.Fatal("expected the intermediate in the chain file")
+	}
+	data, err := ioutil.ReadFile(filepath.Join(out, DefaultKeyFile))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "ENCRYPTED PRIVATE KEY" {
+		t.Fatal("expected an encrypted PKCS#8 key")
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		t.Fatal("expected the key not to parse unencrypted")
+	}
+
+	// a certificate issued later than the stored one is kept
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "web"},
+		NotBefore:    time.Now().Add(time.Hour),
+		NotAfter:     time.Now().Add(48 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	newer := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := ioutil.WriteFile(filepath.Join(out, DefaultCertFile), newer, 0644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.Fetch("web", flags); err == nil {
+		t.Fatal("expected error overwriting a newer certificate")
+	}
+	flags.Force = true
+	if err := c.Fetch("web", flags); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
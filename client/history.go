@@ -0,0 +1,26 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// History displays every version of the certificate with the provided
+// common name, with its serial number, validity and status.
+func (c *Client) History(name string) error {
+	versions, err := c.api.History(name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-7s  %-20s  %-20s  %-20s  %s\n", "VERSION", "SERIAL", "NOT BEFORE", "NOT AFTER", "STATUS")
+	for _, v := range versions {
+		status := v.Status
+		if v.Current {
+			status += " (current)"
+		}
+		fmt.Printf("%-7d  %-20s  %-20s  %-20s  %s\n", v.Number, v.Certificate.SerialNumber.Text(16),
+			v.Certificate.NotBefore.Format(time.RFC3339), v.Certificate.NotAfter.Format(time.RFC3339), status)
+	}
+	return nil
+}
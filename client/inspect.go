@@ -0,0 +1,167 @@
+package client
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/ovrclk/authority/api"
+)
+
+// FormatText is the default, human readable output format.
+const FormatText = "text"
+
+// Inspect displays the decoded certificate with the provided common name,
+// as text or, if format is "json", as a JSON object.
+func (c *Client) Inspect(name, format string) error {
+	inspection, err := c.api.Inspect(name)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatText:
+		printInspection(inspection)
+		return nil
+	case FormatJSON:
+		return printJSON(inspection)
+	}
+	return fmt.Errorf("authority: unknown inspect format %s, expected text or json", format)
+}
+
+// InspectFile displays every certificate in the PEM or DER file at path,
+// decoded, as text or, if format is "json", as a JSON array. Certificates
+// issued by a stored CA show their chain and revocation status.
+func (c *Client) InspectFile(path, format string) error {
+	certs, err := readCertificates(path)
+	if err != nil {
+		return err
+	}
+
+	var inspections []*api.Inspection
+	for _, cert := range certs {
+		inspection, err := c.api.InspectCertificate(cert)
+		if err != nil {
+			return err
+		}
+		inspections = append(inspections, inspection)
+	}
+
+	switch format {
+	case FormatText:
+		for i, inspection := range inspections {
+			if i > 0 {
+				fmt.Println()
+			}
+			printInspection(inspection)
+		}
+		return nil
+	case FormatJSON:
+		return printJSON(inspections)
+	}
+	return fmt.Errorf("authority: unknown inspect format %s, expected text or json", format)
+}
+
+func printInspection(i *api.Inspection) {
+	field := func(label, value string) {
+		if value != "" {
+			fmt.Printf("%-20s %s\n", label+":", value)
+		}
+	}
+
+	field("Name", i.Name)
+	field("Subject", i.Subject)
+	field("Issuer", i.Issuer)
+	field("Serial", i.Serial)
+	field("Not Before", i.NotBefore.Format(time.RFC3339))
+	field("Not After", fmt.Sprintf("%s (%s)", i.NotAfter.Format(time.RFC3339), remaining(i.NotAfter)))
+	field("Status", i.Status)
+	if len(i.Chain) > 0 {
+		field("Chain", strings.Join(i.Chain, " -> "))
+	}
+	field("DNS Names", strings.Join(i.DNSNames, ", "))
+	field("IP Addresses", strings.Join(i.IPAddresses, ", "))
+	field("Email Addresses", strings.Join(i.EmailAddresses, ", "))
+	field("URIs", strings.Join(i.URIs, ", "))
+	key := i.KeyType
+	if i.KeySize > 0 {
+		key = fmt.Sprintf("%s %d bits", i.KeyType, i.KeySize)
+	}
+	field("Public Key", key)
+	field("Signature", i.SignatureAlgorithm)
+	field("CA", fmt.Sprintf("%t", i.IsCA))
+	field("Key Usage", strings.Join(i.KeyUsage, ", "))
+	field("Ext Key Usage", strings.Join(i.ExtKeyUsage, ", "))
+	var extensions []string
+	for _, ext := range i.Extensions {
+		name := ext.Name
+		if name == "" {
+			name = ext.OID
+		}
+		if ext.Critical {
+			name += " (critical)"
+		}
+		extensions = append(extensions, name)
+	}
+	field("Extensions", strings.Join(extensions, ", "))
+	field("SHA-1 Fingerprint", i.SHA1Fingerprint)
+	field("SHA-256 Fingerprint", i.SHA256Fingerprint)
+	field("SPKI Pin", "sha256/"+i.SPKIPin)
+}
+
+func remaining(notAfter time.Time) string {
+	days := int(notAfter.Sub(time.Now()).Hours() / 24)
+	if days < 0 {
+		return fmt.Sprintf("expired %d days ago", -days)
+	}
+	return fmt.Sprintf("expires in %d days", days)
+}
+
+func printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// readCertificates reads every PEM encoded certificate in the file at path,
+// or a single DER encoded certificate.
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("authority: unable to read file %v", err)
+	}
+
+	var certs []*x509.Certificate
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("authority: unable to parse certificate %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) > 0 {
+		return certs, nil
+	}
+
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("authority: no certificate found in %s", path)
+	}
+	return []*x509.Certificate{cert}, nil
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/ovrclk/authority/authority"
+	"github.com/ovrclk/authority/util"
+)
+
+// Keystore output formats accepted by GetKeystore and GetTrustStore.
+const (
+	FormatPKCS12 = "pkcs12"
+	FormatJKS    = "jks"
+)
+
+// KeystoreFlags holds the command line values used when exporting a
+// certificate as a PKCS#12 file or Java keystore.
+type KeystoreFlags struct {
+	// PassphraseFile holds the keystore passphrase on its first line.
+	PassphraseFile string
+
+	// Alias names the key entry, by default the certificate's name.
+	Alias string
+
+	// Chain adds the intermediate and root CA certificates to the key
+	// entry.
+	Chain bool
+
+	// File is written with mode 0600 instead of writing to standard output.
+	File string
+}
+
+// IsKeystoreFormat returns whether format is a keystore format rather than
+// a PEM format.
+func IsKeystoreFormat(format string) bool {
+	return format == FormatPKCS12 || format == FormatJKS
+}
+
+// GetKeystore outputs the certificate with the provided common name and its
+// private key as a PKCS#12 file or Java keystore, as selected by format.
+func (c *Client) GetKeystore(name, format string, flags *KeystoreFlags) error {
+	passphrase, err := flags.passphrase()
+	if err != nil {
+		return err
+	}
+
+	cert, err := c.api.Get(name)
+	if err != nil {
+		return err
+	}
+	if cert.KeyIsHeld {
+		return authority.ErrKeyNotExportable
+	}
+	if cert.PublicOnly {
+		return authority.ErrKeyOffline
+	}
+
+	var chain []*x509.Certificate
+	if flags.Chain {
+		if chain, err = c.api.Chain(name); err != nil {
+			return err
+		}
+		roots, err := c.api.TrustBundle()
+		if err != nil {
+			return err
+		}
+		last := cert.Certificate
+		if len(chain) > 0 {
+			last = chain[len(chain)-1]
+		}
+		for _, root := range roots {
+			if !root.Equal(last) && last.CheckSignatureFrom(root) == nil {
+				chain = append(chain, root)
+				break
+			}
+		}
+	}
+
+	alias := flags.Alias
+	if alias == "" {
+		alias = name
+	}
+	var data []byte
+	if format == FormatJKS {
+		data, err = util.EncodeJKS(cert.PrivateKey, cert.Certificate, chain, alias, passphrase)
+	} else {
+		data, err = util.EncodePKCS12(cert.PrivateKey, cert.Certificate, chain, alias, passphrase)
+	}
+	if err != nil {
+		return err
+	}
+	return writeOutput(flags.File, data)
+}
+
+// GetTrustStore outputs the root certificates to trust for the selected
+// hierarchy, as listed by GetTrustBundle, as a PKCS#12 file or Java
+// keystore of trusted entries named after the stored certificates.
+func (c *Client) GetTrustStore(format string, flags *KeystoreFlags) error {
+	passphrase, err := flags.passphrase()
+	if err != nil {
+		return err
+	}
+
+	certs, err := c.api.TrustStore()
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if format == FormatJKS {
+		data, err = util.EncodeJKSTrustStore(certs, passphrase)
+	} else {
+		data, err = util.EncodePKCS12TrustStore(certs, passphrase)
+	}
+	if err != nil {
+		return err
+	}
+	return writeOutput(flags.File, data)
+}
+
+func (f *KeystoreFlags) passphrase() (string, error) {
+	if f.PassphraseFile == "" {
+		return "", fmt.Errorf("authority: a keystore passphrase is required, use --passphrase-file")
+	}
+	passphrase, err := readPassphrase(f.PassphraseFile)
+	if err != nil {
+		return "", err
+	}
+	return string(passphrase), nil
+}
+
+// writeOutput writes data to file with mode 0600, or to standard output if
+// file is empty.
+func writeOutput(file string, data []byte) error {
+	if file != "" {
+		return util.WriteFileAtomic(file, data, 0600, -1, -1)
+	}
+	_, err := os.Stdout.Write(data)
+	return err
+}
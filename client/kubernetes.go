@@ -0,0 +1,177 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ovrclk/authority/authority"
+	"github.com/ovrclk/authority/util"
+)
+
+// FormatConfigMap is the output format of GetTrustBundle producing a
+// Kubernetes ConfigMap manifest.
+const FormatConfigMap = "k8s-configmap"
+
+var (
+	// k8sName matches a Kubernetes DNS subdomain name, as required for
+	// Secret and ConfigMap names, and, when short enough, namespaces.
+	k8sName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+	k8sLabelName  = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	k8sLabelValue = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?)?$`)
+)
+
+// KubernetesFlags holds the command line values used when producing a
+// Kubernetes manifest.
+type KubernetesFlags struct {
+	// Name of the Secret or ConfigMap.
+	Name string
+
+	// Namespace of the Secret or ConfigMap, left out if empty.
+	Namespace string
+
+	// Labels are key=value pairs added to the manifest's metadata.
+	Labels []string
+}
+
+// GetKubernetesSecret displays a kubernetes.io/tls Secret manifest holding
+// the certificate with the provided common name followed by its chain of
+// intermediates as tls.crt, its private key as tls.key and the roots to
+// trust as ca.crt. The Secret is named after the certificate unless
+// flags.Name is set.
+func (c *Client) GetKubernetesSecret(name string, flags *KubernetesFlags) error {
+	metadata, err := flags.metadata(name)
+	if err != nil {
+		return err
+	}
+
+	cert, err := c.api.Get(name)
+	if err != nil {
+		return err
+	}
+	if cert.KeyIsHeld {
+		return authority.ErrKeyNotExportable
+	}
+	if cert.PublicOnly {
+		return authority.ErrKeyOffline
+	}
+	chain, err := c.api.Chain(name)
+	if err != nil {
+		return err
+	}
+	bundle, err := c.api.TrustBundle()
+	if err != nil {
+		return err
+	}
+
+	crt := util.GetPEMBytesFromCertificate(cert.Certificate)
+	crt = append(crt, pemBundle(chain)...)
+
+	var out bytes.Buffer
+	out.WriteString("apiVersion: v1\nkind: Secret\n")
+	out.WriteString(metadata)
+	out.WriteString("type: kubernetes.io/tls\ndata:\n")
+	fmt.Fprintf(&out, "  tls.crt: %s\n", base64.StdEncoding.EncodeToString(crt))
+	fmt.Fprintf(&out, "  tls.key: %s\n", base64.StdEncoding.EncodeToString(util.GetPEMBytesFromKey(cert.PrivateKey)))
+	fmt.Fprintf(&out, "  ca.crt: %s\n", base64.StdEncoding.EncodeToString(pemBundle(bundle)))
+	fmt.Print(out.String())
+	return nil
+}
+
+// GetTrustBundleConfigMap displays a ConfigMap manifest holding the root
+// certificates to trust for the selected hierarchy as ca.crt. The ConfigMap
+// is named after the root with a "-bundle" suffix unless flags.Name is set.
+func (c *Client) GetTrustBundleConfigMap(flags *KubernetesFlags) error {
+	metadata, err := flags.metadata(c.ca + "-bundle")
+	if err != nil {
+		return err
+	}
+
+	bundle, err := c.api.TrustBundle()
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	out.WriteString("apiVersion: v1\nkind: ConfigMap\n")
+	out.WriteString(metadata)
+	out.WriteString("data:\n  ca.crt: |\n")
+	for _, line := range strings.Split(strings.TrimSpace(string(pemBundle(bundle))), "\n") {
+		fmt.Fprintf(&out, "    %s\n", line)
+	}
+	fmt.Print(out.String())
+	return nil
+}
+
+// metadata returns the manifest's metadata section, named defaultName
+// unless a name was provided, after checking the values are accepted by
+// Kubernetes.
+func (f *KubernetesFlags) metadata(defaultName string) (string, error) {
+	name := f.Name
+	if name == "" {
+		name = defaultName
+	}
+	if len(name) > 253 || !k8sName.MatchString(name) {
+		return "", fmt.Errorf("authority: %s is not a valid Kubernetes name, set one with --name", name)
+	}
+	if f.Namespace != "" && (len(f.Namespace) > 63 || strings.Contains(f.Namespace, ".") || !k8sName.MatchString(f.Namespace)) {
+		return "", fmt.Errorf("authority: %s is not a valid Kubernetes namespace", f.Namespace)
+	}
+	labels, err := parseLabels(f.Labels)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	out.WriteString("metadata:\n")
+	fmt.Fprintf(&out, "  name: %s\n", name)
+	if f.Namespace != "" {
+		fmt.Fprintf(&out, "  namespace: %s\n", f.Namespace)
+	}
+	if len(labels) == 0 {
+		return out.String(), nil
+	}
+
+	var keys []string
+	for key := range labels {
+		if !validLabelKey(key) {
+			return "", fmt.Errorf("authority: %s is not a valid Kubernetes label key", key)
+		}
+		if len(labels[key]) > 63 || !k8sLabelValue.MatchString(labels[key]) {
+			return "", fmt.Errorf("authority: %q is not a valid Kubernetes label value", labels[key])
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out.WriteString("  labels:\n")
+	for _, key := range keys {
+		fmt.Fprintf(&out, "    %s: %s\n", key, yamlQuote(labels[key]))
+	}
+	return out.String(), nil
+}
+
+// yamlQuote returns s as a YAML double quoted scalar, which a JSON string
+// always is.
+func yamlQuote(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+// validLabelKey returns whether key is a Kubernetes label key: a name,
+// optionally prefixed by a DNS subdomain and a slash.
+func validLabelKey(key string) bool {
+	name := key
+	if i := strings.LastIndex(key, "/"); i >= 0 {
+		prefix := key[:i]
+		if len(prefix) > 253 || !k8sName.MatchString(prefix) {
+			return false
+		}
+		name = key[i+1:]
+	}
+	return len(name) <= 63 && k8sLabelName.MatchString(name)
+}
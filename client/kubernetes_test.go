@@ -0,0 +1,39 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKubernetesMetadata(t *testing.T) {
+	flags := &KubernetesFlags{
+		Namespace: "prod",
+		Labels:    []string{"app=web", "app.kubernetes.io/part-of=shop"},
+	}
+	metadata, err := flags.metadata("web.example.com")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := `metadata:
+  name: web.example.com
+  namespace: prod
+  labels:
+    app: "web"
+    app.kubernetes.io/part-of: "shop"
+`
+	if metadata != expected {
+		t.Fatalf("unexpected metadata:\n%s", metadata)
+	}
+
+	for _, bad := range []*KubernetesFlags{
+		&KubernetesFlags{Name: "My_Secret"},
+		&KubernetesFlags{Namespace: "a.b"},
+		&KubernetesFlags{Labels: []string{"app=a b"}},
+		&KubernetesFlags{Labels: []string{"-app=web"}},
+		&KubernetesFlags{Labels: []string{"app=" + strings.Repeat("a", 64)}},
+	} {
+		if _, err := bad.metadata("web"); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/ovrclk/authority/api"
+	"github.com/ovrclk/authority/backend"
+)
+
+// Label sets the provided key=value labels in the metadata record of the
+// certificate with the provided common name, then displays the record. With
+// no labels, the record is only displayed.
+func (c *Client) Label(name string, labels []string) error {
+	values, err := parseLabels(labels)
+	if err != nil {
+		return err
+	}
+
+	var meta *backend.Metadata
+	if len(values) == 0 {
+		meta, err = c.api.GetMetadata(name)
+	} else {
+		meta, err = c.api.SetLabels(name, values)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, key := range meta.Keys() {
+		fmt.Printf("%-12s  %s\n", key, meta.Get(key))
+	}
+	return nil
+}
+
+// List displays the stored certificates whose metadata matches every
+// key=value filter.
+func (c *Client) List(filters []string) error {
+	filter, err := parseLabels(filters)
+	if err != nil {
+		return err
+	}
+	certs, err := c.api.List(filter)
+	if err != nil {
+		return err
+	}
+	if len(certs) == 0 {
+		fmt.Println("no matching certificates")
+		return nil
+	}
+
+	fmt.Printf("%-32s  %-20s  %-20s  %-16s  %-16s  %s\n", "NAME", "SERIAL", "EXPIRES", "OWNER", "TEAM", "TAGS")
+	for _, cert := range certs {
+		meta := cert.Metadata
+		fmt.Printf("%-32s  %-20s  %-20s  %-16s  %-16s  %s\n", cert.CommonName, cert.Certificate.SerialNumber.Text(16),
+			cert.Certificate.NotAfter.Format(time.RFC3339), meta.Owner, meta.Team, meta.Get(backend.MetaTags))
+	}
+	return nil
+}
+
+// matching returns the certificates whose metadata matches filter.
+func (c *Client) matching(certs []*api.Certificate, filter map[string]string) ([]*api.Certificate, error) {
+	if len(filter) == 0 {
+		return certs, nil
+	}
+	var matched []*api.Certificate
+	for _, cert := range certs {
+		meta, err := c.api.GetMetadata(cert.CommonName)
+		if err != nil {
+			return nil, err
+		}
+		if meta.Matches(filter) {
+			matched = append(matched, cert)
+		}
+	}
+	return matched, nil
+}
+
+// parseLabels parses key=value pairs, such as owner=alice or tags=db,prod.
+func parseLabels(labels []string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, label := range labels {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("authority: invalid label %q, expected key=value", label)
+		}
+		values[strings.TrimSpace(parts[0])] = parts[1]
+	}
+	return values, nil
+}
+
+// currentUser returns the name of the user running the command, recorded
+// as the creator of new certificates.
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
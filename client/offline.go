@@ -0,0 +1,103 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/ovrclk/authority/config"
+	"github.com/ovrclk/authority/util"
+)
+
+// ImportCA stores the root certificate at the provided path without its
+// private key, so that the root key can be kept offline.
+func (c *Client) ImportCA(certPath string) error {
+	cert, err := util.GetCertificateFromPath(certPath)
+	if err != nil {
+		return err
+	}
+	if err := c.api.ImportCA(cert); err != nil {
+		return err
+	}
+	fmt.Println("authority: root certificate imported, root key is offline")
+	return nil
+}
+
+// CreateRequest generates the key for an intermediate with the provided
+// name and displays a PEM encoded certificate signing request for it.
+func (c *Client) CreateRequest(name string, flags *CertificateFlags) error {
+	opts, err := flags.toOptions()
+	if err != nil {
+		return err
+	}
+	csr, err := c.api.CreateRequest(name, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Print(util.GetPEMFromCertificateRequest(csr))
+	return nil
+}
+
+// SignIntermediate signs the certificate signing request at the provided
+// path with the root key and displays the PEM encoded intermediate
+// certificate. An empty ttl uses the default intermediate lifetime.
+func (c *Client) SignIntermediate(csrPath, ttl string) error {
+	csr, err := util.GetCertificateRequestFromPath(csrPath)
+	if err != nil {
+		return err
+	}
+
+	var duration time.Duration
+	if ttl != "" {
+		if duration, err = config.ParseTTL(ttl); err != nil {
+			return fmt.Errorf("authority: %v", err)
+		}
+	}
+
+	cert, err := c.api.SignIntermediate(csr, duration)
+	if err != nil {
+		return err
+	}
+	fmt.Print(util.GetPEMFromCertificate(cert))
+	return nil
+}
+
+// ImportIntermediate stores the signed intermediate certificate at the
+// provided path for the intermediate with the provided name.
+func (c *Client) ImportIntermediate(name, certPath string) error {
+	cert, err := util.GetCertificateFromPath(certPath)
+	if err != nil {
+		return err
+	}
+	if err := c.api.ImportIntermediate(name, cert); err != nil {
+		return err
+	}
+	fmt.Println("authority: intermediate", name, "imported")
+	return nil
+}
+
+// SignCRL re-signs the root certificate revocation list and outputs it as
+// raw DER bytes.
+func (c *Client) SignCRL() error {
+	crl, err := c.api.SignCRL()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(crl)
+	return err
+}
+
+// ImportCRL stores the DER encoded root certificate revocation list at the
+// provided path.
+func (c *Client) ImportCRL(crlPath string) error {
+	crl, err := ioutil.ReadFile(crlPath)
+	if err != nil {
+		return fmt.Errorf("authority: unable to read file %v", err)
+	}
+	if err := c.api.ImportCRL(crl); err != nil {
+		return err
+	}
+	fmt.Println("authority: root CRL imported")
+	return nil
+}
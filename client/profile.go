@@ -0,0 +1,188 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/ovrclk/authority/config"
+)
+
+// Profile holds the backend connection settings for one named environment.
+type Profile struct {
+	Backend string `toml:"backend"`
+	Path    string `toml:"path"`
+	Server  string `toml:"server"`
+	Token   string `toml:"token"`
+	CA      string `toml:"ca"`
+
+	// AuditKey keys the audit log's hashes. It is kept here, outside the
+	// backend, so that write access to the backend is not enough to rewrite
+	// the log.
+	AuditKey string `toml:"audit_key"`
+}
+
+// Profiles is the client-side settings file, holding named profiles, the
+// name of the profile used when none is selected and the external signers
+// for CA keys, keyed by CA name. Signers are only read from this file, as
+// opening one runs its command or module.
+type Profiles struct {
+	Current  string                         `toml:"current"`
+	Profiles map[string]Profile             `toml:"profiles"`
+	Signers  map[string]config.SignerConfig `toml:"signers"`
+
+	path string
+}
+
+// DefaultProfilesPath returns the location of the profiles file, under
+// $XDG_CONFIG_HOME or ~/.config.
+func DefaultProfilesPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(dir, "authority", "profiles.toml")
+}
+
+// LoadProfiles reads the profiles file at the provided path. A missing file
+// is treated as an empty set of profiles.
+func LoadProfiles(path string) (*Profiles, error) {
+	p := &Profiles{
+		Profiles: map[string]Profile{},
+		path:     path,
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return p, nil
+		}
+		return nil, fmt.Errorf("authority: error reading profiles (%s): %v", path, err)
+	}
+
+	if _, err := toml.Decode(string(data), p); err != nil {
+		return nil, fmt.Errorf("authority: invalid profiles file (%s): %v", path, err)
+	}
+	if p.Profiles == nil {
+		p.Profiles = map[string]Profile{}
+	}
+	return p, nil
+}
+
+// Get returns the profile with the provided name.
+func (p *Profiles) Get(name string) (*Profile, error) {
+	profile, ok := p.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("authority: profile %s does not exist", name)
+	}
+	return &profile, nil
+}
+
+// Save writes the profiles file. The file is only readable by its owner, as
+// profiles may hold Vault tokens.
+func (p *Profiles) Save() error {
+	buf := new(bytes.Buffer)
+	if err := toml.NewEncoder(buf).Encode(p); err != nil {
+		return fmt.Errorf("authority: cannot encode profiles: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0700); err != nil {
+		return fmt.Errorf("authority: cannot create profiles directory: %v", err)
+	}
+	return ioutil.WriteFile(p.path, buf.Bytes(), 0600)
+}
+
+// Names returns the sorted profile names.
+func (p *Profiles) Names() []string {
+	var names []string
+	for name := range p.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ListProfiles displays the profiles in the provided profiles file, marking
+// the current profile.
+func ListProfiles(path string) error {
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		return err
+	}
+	if len(profiles.Profiles) == 0 {
+		fmt.Println("no profiles defined in", path)
+		return nil
+	}
+	for _, name := range profiles.Names() {
+		marker := " "
+		if name == profiles.Current {
+			marker = "*"
+		}
+		profile := profiles.Profiles[name]
+		fmt.Printf("%s %-16s %-6s %s\n", marker, name, profile.Backend, profile.location())
+	}
+	return nil
+}
+
+// UseProfile makes the named profile the current profile.
+func UseProfile(path, name string) error {
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		return err
+	}
+	if _, err := profiles.Get(name); err != nil {
+		return err
+	}
+	profiles.Current = name
+	if err := profiles.Save(); err != nil {
+		return err
+	}
+	fmt.Println("authority: using profile", name)
+	return nil
+}
+
+// ShowProfile displays the settings of the named profile, or the current
+// profile if name is empty. Tokens are masked.
+func ShowProfile(path, name string) error {
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = profiles.Current
+	}
+	if name == "" {
+		return fmt.Errorf("authority: no current profile, use profile:use to select one")
+	}
+	profile, err := profiles.Get(name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%8s: %s\n", "name", name)
+	fmt.Printf("%8s: %s\n", "backend", profile.Backend)
+	fmt.Printf("%8s: %s\n", "path", profile.Path)
+	fmt.Printf("%8s: %s\n", "server", profile.Server)
+	fmt.Printf("%8s: %s\n", "token", maskToken(profile.Token))
+	fmt.Printf("%8s: %s\n", "ca", profile.CA)
+	fmt.Printf("%8s: %s\n", "auditkey", maskToken(profile.AuditKey))
+	return nil
+}
+
+func (p *Profile) location() string {
+	if p.Backend == "file" {
+		return p.Path
+	}
+	return p.Server
+}
+
+func maskToken(token string) string {
+	if len(token) <= 4 {
+		return strings.Repeat("*", len(token))
+	}
+	return strings.Repeat("*", len(token)-4) + token[len(token)-4:]
+}
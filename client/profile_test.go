@@ -0,0 +1,72 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ovrclk/authority/config"
+)
+
+func TestProfilesRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authority")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "authority", "profiles.toml")
+
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		t.Fatalf("error loading missing profiles: %v", err)
+	}
+	if len(profiles.Profiles) != 0 {
+		t.Fatal("expected no profiles")
+	}
+
+	profiles.Profiles["dev"] = Profile{Backend: "file", Path: "/tmp/authority"}
+	profiles.Profiles["prod"] = Profile{Backend: "vault", Server: "https://vault:8200", Token: "secret"}
+	profiles.Current = "prod"
+	profiles.Signers = map[string]config.SignerConfig{
+		"ca": config.SignerConfig{Type: "external", Socket: "/run/signer.sock"},
+	}
+	if err := profiles.Save(); err != nil {
+		t.Fatalf("error saving profiles: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected profiles file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	profiles, err = LoadProfiles(path)
+	if err != nil {
+		t.Fatalf("error loading profiles: %v", err)
+	}
+	if profiles.Current != "prod" {
+		t.Fatal("got unexpected current profile")
+	}
+	prod, err := profiles.Get("prod")
+	if err != nil || prod.Token != "secret" {
+		t.Fatal("got unexpected prod profile")
+	}
+	if profiles.Signers["ca"].Socket != "/run/signer.sock" {
+		t.Fatal("expected the signers to be kept")
+	}
+	if _, err := profiles.Get("staging"); err == nil {
+		t.Fatal("expected error for missing profile")
+	}
+}
+
+func TestMaskToken(t *testing.T) {
+	if maskToken("abcdef-123456") != "*********3456" {
+		t.Fatal("got unexpected masked token")
+	}
+	if maskToken("abc") != "***" {
+		t.Fatal("got unexpected masked short token")
+	}
+}
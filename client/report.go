@@ -0,0 +1,164 @@
+package client
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ovrclk/authority/api"
+	"github.com/ovrclk/authority/config"
+)
+
+// Output formats of ExpiryReport.
+const (
+	FormatTable      = "table"
+	FormatJSON       = "json"
+	FormatCSV        = "csv"
+	FormatPrometheus = "prometheus"
+)
+
+// ExpiryReport displays the certificates whose metadata matches every
+// key=value filter and which expire within the provided window, such as 30d,
+// grouped by issuer. The format is table, json or csv, or prometheus for a
+// text exposition of the days until expiry of every matching certificate,
+// whatever the window. An error is returned when more than threshold
+// certificates expire within the window, unless threshold is negative.
+func (c *Client) ExpiryReport(within, format string, threshold int, filters []string) error {
+	window, err := config.ParseTTL(within)
+	if err != nil {
+		return fmt.Errorf("authority: %v", err)
+	}
+	filter, err := parseLabels(filters)
+	if err != nil {
+		return err
+	}
+	report, err := c.api.ExpiryReport(filter)
+	if err != nil {
+		return err
+	}
+
+	var expiring []*api.Expiry
+	for _, e := range report {
+		if e.Remaining() <= window {
+			expiring = append(expiring, e)
+		}
+	}
+
+	switch format {
+	case FormatTable:
+		printExpiryTable(expiring, within)
+	case FormatJSON:
+		err = printExpiryJSON(expiring)
+	case FormatCSV:
+		err = printExpiryCSV(expiring)
+	case FormatPrometheus:
+		printExpiryPrometheus(report, expiring, within)
+	default:
+		err = fmt.Errorf("authority: unknown report format %s, expected table, json, csv or prometheus", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if threshold >= 0 && len(expiring) > threshold {
+		return fmt.Errorf("authority: %d certificates expire within %s, more than %d", len(expiring), within, threshold)
+	}
+	return nil
+}
+
+func printExpiryTable(expiring []*api.Expiry, within string) {
+	if len(expiring) == 0 {
+		fmt.Println("no certificates expire within", within)
+		return
+	}
+
+	fmt.Printf("%-24s  %-32s  %-20s  %-20s  %s\n", "ISSUER", "NAME", "SERIAL", "EXPIRES", "DAYS")
+	for i, e := range expiring {
+		if i > 0 && e.Issuer != expiring[i-1].Issuer {
+			fmt.Println()
+		}
+		fmt.Printf("%-24s  %-32s  %-20s  %-20s  %s\n", issuerLabel(e), e.Name, e.Certificate.SerialNumber.Text(16),
+			e.Certificate.NotAfter.Format(time.RFC3339), formatDays(e))
+	}
+}
+
+type expiryRecord struct {
+	Name          string    `json:"name"`
+	Issuer        string    `json:"issuer"`
+	Serial        string    `json:"serial"`
+	NotAfter      time.Time `json:"not_after"`
+	DaysRemaining float64   `json:"days_remaining"`
+	IsCA          bool      `json:"ca"`
+}
+
+func printExpiryJSON(expiring []*api.Expiry) error {
+	records := []expiryRecord{}
+	for _, e := range expiring {
+		records = append(records, expiryRecord{
+			Name:          e.Name,
+			Issuer:        e.Issuer,
+			Serial:        e.Certificate.SerialNumber.Text(16),
+			NotAfter:      e.Certificate.NotAfter,
+			DaysRemaining: days(e),
+			IsCA:          e.Certificate.IsCA,
+		})
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func printExpiryCSV(expiring []*api.Expiry) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"name", "issuer", "serial", "not_after", "days_remaining", "ca"})
+	for _, e := range expiring {
+		w.Write([]string{
+			e.Name,
+			e.Issuer,
+			e.Certificate.SerialNumber.Text(16),
+			e.Certificate.NotAfter.Format(time.RFC3339),
+			formatDays(e),
+			strconv.FormatBool(e.Certificate.IsCA),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func printExpiryPrometheus(report, expiring []*api.Expiry, within string) {
+	fmt.Println("# HELP authority_certificate_expiry_days Days until the certificate expires, negative once expired.")
+	fmt.Println("# TYPE authority_certificate_expiry_days gauge")
+	for _, e := range report {
+		fmt.Printf("authority_certificate_expiry_days{name=\"%s\",issuer=\"%s\",serial=\"%s\"} %s\n",
+			promEscape(e.Name), promEscape(e.Issuer), e.Certificate.SerialNumber.Text(16), formatDays(e))
+	}
+	fmt.Println("# HELP authority_certificates_expiring Number of certificates expiring within the report window.")
+	fmt.Println("# TYPE authority_certificates_expiring gauge")
+	fmt.Printf("authority_certificates_expiring{within=\"%s\"} %d\n", promEscape(within), len(expiring))
+}
+
+func issuerLabel(e *api.Expiry) string {
+	if e.Issuer == "" {
+		return "-"
+	}
+	return e.Issuer
+}
+
+func days(e *api.Expiry) float64 {
+	return e.Remaining().Hours() / 24
+}
+
+func formatDays(e *api.Expiry) string {
+	return strconv.FormatFloat(days(e), 'f', 2, 64)
+}
+
+func promEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ovrclk/authority/config"
+	"github.com/ovrclk/authority/util"
+)
+
+// Rollover replaces the key of the CA with the provided name. The new key
+// takes over issuance at the date given by at, in RFC 3339 or YYYY-MM-DD
+// form, or immediately if at is empty.
+func (c *Client) Rollover(name, at, ttl string) error {
+	switchAt := time.Now()
+	if at != "" {
+		var err error
+		if switchAt, err = parseDate(at); err != nil {
+			return err
+		}
+	}
+
+	var duration time.Duration
+	if ttl != "" {
+		var err error
+		if duration, err = config.ParseTTL(ttl); err != nil {
+			return fmt.Errorf("authority: %v", err)
+		}
+	}
+
+	r, err := c.api.Rollover(name, switchAt, duration)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("authority: new key for %s created as %s-next, issuing from %s\n", name, name, r.Next.NotBefore.Format(time.RFC3339))
+	if r.CrossNew != nil {
+		fmt.Printf("authority: cross-signed certificates stored as %s-cross-new and %s-cross-old\n", name, name)
+		fmt.Println("authority: publish the trust bundle from ca:bundle before the switch")
+	}
+	return nil
+}
+
+// GetTrustBundle displays the PEM encoded root certificates to trust for the
+// selected hierarchy, including both roots during a rollover.
+func (c *Client) GetTrustBundle(format string) error {
+	bundle, err := c.api.TrustBundle()
+	if err != nil {
+		return err
+	}
+
+	var pems string
+	for _, cert := range bundle {
+		pems += util.GetPEMFromCertificate(cert)
+	}
+	if format == "base64" {
+		pems = util.Base64String(pems)
+	}
+	fmt.Println(pems)
+	return nil
+}
+
+// RolloverReport displays the active certificates which still chain only to
+// the root key replaced by a rollover, limited to those whose metadata
+// matches every key=value filter.
+func (c *Client) RolloverReport(filters []string) error {
+	filter, err := parseLabels(filters)
+	if err != nil {
+		return err
+	}
+	report, err := c.api.RolloverReport()
+	if err != nil {
+		return err
+	}
+	if report, err = c.matching(report, filter); err != nil {
+		return err
+	}
+	if len(report) == 0 {
+		fmt.Println("no active certificates chain only to the old root")
+		return nil
+	}
+
+	fmt.Printf("%-32s  %-20s  %s\n", "NAME", "SERIAL", "EXPIRES")
+	for _, cert := range report {
+		fmt.Printf("%-32s  %-20s  %s\n", cert.CommonName, cert.Certificate.SerialNumber, cert.Certificate.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("authority: invalid date %q, use YYYY-MM-DD or RFC 3339", value)
+	}
+	return t, nil
+}
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ovrclk/authority/api"
+	"github.com/ovrclk/authority/authority"
+	"github.com/ovrclk/authority/util"
+)
+
+// builtinTemplates are the templates selected by name rather than by path.
+var builtinTemplates = map[string]string{
+	// certificate followed by its intermediates, for ssl_certificate
+	"nginx": `{{.FullChain}}`,
+
+	// certificate, intermediates and key in a single file, for crt
+	"haproxy": `{{.FullChain}}{{.Key}}`,
+
+	// an SDS discovery response holding the certificate and the roots to
+	// trust as two secrets, for a path based SDS config source
+	"envoy-sds": `resources:
+- "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.Secret
+  name: {{quote .Name}}
+  tls_certificate:
+    certificate_chain:
+      inline_string: |
+{{indent 8 .FullChain}}
+    private_key:
+      inline_string: |
+{{indent 8 .Key}}
+- "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.Secret
+  name: {{quote (print .Name "-ca")}}
+  validation_context:
+    trusted_ca:
+      inline_string: |
+{{indent 8 .CA}}
+`,
+
+	// shell variable exports, to be sourced
+	"env": `export TLS_NAME={{shellquote .Name}}
+export TLS_SERIAL={{shellquote .Serial}}
+export TLS_NOT_AFTER={{shellquote (.NotAfter.Format "2006-01-02T15:04:05Z07:00")}}
+export TLS_CERT={{shellquote .FullChain}}
+export TLS_KEY={{shellquote .Key}}
+export TLS_CA={{shellquote .CA}}
+`,
+}
+
+// TemplateData is the certificate information available to output
+// templates. PEM values end with a newline.
+type TemplateData struct {
+	Name string
+
+	// Certificate is the PEM encoded certificate, Chain the intermediates
+	// above it, FullChain both, and CA the roots to trust.
+	Certificate string
+	Chain       string
+	FullChain   string
+	CA          string
+
+	CommonName     string
+	DNSNames       []string
+	IPAddresses    []string
+	EmailAddresses []string
+
+	// Serial is the hex serial number, and the fingerprints are colon
+	// separated hex, as openssl prints them.
+	Serial            string
+	SHA1Fingerprint   string
+	SHA256Fingerprint string
+
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	api     *api.Client
+	key     string
+	keyErr  error
+	keyRead bool
+}
+
+// Key returns the PEM encoded private key. It is only read from the store,
+// and recorded in the audit log, by templates which use it, and only once
+// however often they use it.
+func (d *TemplateData) Key() (string, error) {
+	if !d.keyRead {
+		d.key, d.keyErr = d.readKey()
+		d.keyRead = true
+	}
+	return d.key, d.keyErr
+}
+
+func (d *TemplateData) readKey() (string, error) {
+	cert, err := d.api.Get(d.Name)
+	if err != nil {
+		return "", err
+	}
+	if cert.KeyIsHeld {
+		return "", authority.ErrKeyNotExportable
+	}
+	if cert.PublicOnly {
+		return "", authority.ErrKeyOffline
+	}
+	return util.GetPEMFromKey(cert.PrivateKey), nil
+}
+
+// TemplateNames returns the names of the built-in templates.
+func TemplateNames() []string {
+	var names []string
+	for name := range builtinTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RenderTemplate displays the certificate with the provided common name
+// through a Go text/template, given either as the name of a built-in
+// template or as a path, with TemplateData as its data. Built-in names take
+// precedence, so files named like one are given as ./name. The output is
+// written to file with mode 0600 if file is not empty.
+func (c *Client) RenderTemplate(name, tmpl, file string) error {
+	text, ok := builtinTemplates[tmpl]
+	if !ok {
+		data, err := ioutil.ReadFile(tmpl)
+		if err != nil {
+			return fmt.Errorf("authority: unable to read template %s, built-in templates are %s: %v", tmpl, strings.Join(TemplateNames(), ", "), err)
+		}
+		text = string(data)
+	}
+	t, err := template.New(tmpl).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return fmt.Errorf("authority: invalid template %s: %v", tmpl, err)
+	}
+
+	data, err := c.templateData(name)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return fmt.Errorf("authority: unable to render template %s: %v", tmpl, err)
+	}
+	return writeOutput(file, out.Bytes())
+}
+
+func (c *Client) templateData(name string) (*TemplateData, error) {
+	cert, err := c.api.GetCertificate(name)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := c.api.Chain(name)
+	if err != nil {
+		return nil, err
+	}
+	bundle, err := c.api.TrustBundle()
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []string
+	for _, ip := range cert.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	pem := util.GetPEMFromCertificate(cert)
+	return &TemplateData{
+		Name:              name,
+		Certificate:       pem,
+		Chain:             string(pemBundle(chain)),
+		FullChain:         pem + string(pemBundle(chain)),
+		CA:                string(pemBundle(bundle)),
+		CommonName:        cert.Subject.CommonName,
+		DNSNames:          cert.DNSNames,
+		IPAddresses:       ips,
+		EmailAddresses:    cert.EmailAddresses,
+		Serial:            fmt.Sprintf("%x", cert.SerialNumber),
+		SHA1Fingerprint:   util.SHA1Fingerprint(cert),
+		SHA256Fingerprint: util.SHA256Fingerprint(cert),
+		NotBefore:         cert.NotBefore,
+		NotAfter:          cert.NotAfter,
+		api:               c.api,
+	}, nil
+}
+
+var templateFuncs = template.FuncMap{
+	"base64": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"indent": func(n int, s string) string {
+		pad := strings.Repeat(" ", n)
+		return pad + strings.Replace(strings.TrimRight(s, "\n"), "\n", "\n"+pad, -1)
+	},
+	"join": func(sep string, values []string) string {
+		return strings.Join(values, sep)
+	},
+	"quote": yamlQuote,
+	"shellquote": func(s string) string {
+		return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+	},
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ovrclk/authority/api"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authority")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := testClient(t, filepath.Join(dir, "store"))
+	if _, _, err := c.api.GenerateWithOptions("web", "", []string{"web.example.com", "www.example.com"}, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	out := filepath.Join(dir, "out")
+	if err := c.RenderTemplate("web", "haproxy", out); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.Contains(string(data), "BEGIN CERTIFICATE") || !strings.Contains(string(data), "BEGIN RSA PRIVATE KEY") {
+		t.Fatalf("expected certificate and key in haproxy output:\n%s", data)
+	}
+
+	tmpl := filepath.Join(dir, "names.tmpl")
+	if err := ioutil.WriteFile(tmpl, []byte(`{{.CommonName}} {{join "," .DNSNames}} {{len .SHA256Fingerprint}}`), 0644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.RenderTemplate("web", tmpl, out); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if data, _ = ioutil.ReadFile(out); string(data) != "web web.example.com,www.example.com 95" {
+		t.Fatalf("unexpected template output %q", data)
+	}
+
+	// the key is read, and the read audited, once however often it is used
+	if err := ioutil.WriteFile(tmpl, []byte(`{{.Key}}{{.Key}}`), 0644); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.RenderTemplate("web", tmpl, out); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	entries, err := c.api.AuditLog()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var reads int
+	for _, entry := range entries {
+		if entry.Operation == api.OpReadKey {
+			reads++
+		}
+	}
+	if reads != 2 {
+		t.Fatalf("expected one key read for each template using the key, got %d", reads)
+	}
+
+	if err := c.RenderTemplate("web", filepath.Join(dir, "missing.tmpl"), out); err == nil {
+		t.Fatal("expected error for a missing template")
+	}
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ovrclk/authority/api"
+)
+
+// Verify checks the certificate in the PEM or DER file at path against the
+// stored hierarchy and CRLs, displaying the result as text or, if format is
+// "json", as a JSON object. Only the first certificate of a bundle is
+// checked, its chain is built from the stored CAs. It returns an error if
+// the certificate is not valid.
+func (c *Client) Verify(path string, opts *api.VerifyOptions, format string) error {
+	if format != FormatText && format != FormatJSON {
+		return fmt.Errorf("authority: unknown verify format %s, expected text or json", format)
+	}
+	certs, err := readCertificates(path)
+	if err != nil {
+		return err
+	}
+	v, err := c.api.VerifyCertificate(certs[0], opts)
+	if err != nil {
+		return err
+	}
+
+	if format == FormatJSON {
+		if err := printJSON(v); err != nil {
+			return err
+		}
+	} else {
+		if len(v.Chain) > 0 {
+			fmt.Printf("chain: %s\n", strings.Join(v.Chain, " -> "))
+		}
+		for _, problem := range v.Problems {
+			fmt.Printf("- %s\n", problem)
+		}
+	}
+	if !v.Valid {
+		return fmt.Errorf("authority: %s is not valid", path)
+	}
+	if format == FormatText {
+		fmt.Printf("%s is valid\n", path)
+	}
+	return nil
+}
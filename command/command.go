@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/ovrclk/cli"
 	"github.com/spf13/cobra"
 
+	"github.com/ovrclk/authority/api"
 	"github.com/ovrclk/authority/client"
+	"github.com/ovrclk/authority/config"
 	"github.com/ovrclk/authority/util"
 	"github.com/ovrclk/authority/version"
 )
@@ -24,9 +27,15 @@ type CommandFactory struct {
 	Path     string
 	Server   string
 	Token    string
+	Profile  string
+	CA       string
 	CertName string
 	RootName string
 	Output   string
+
+	signers     map[string]config.SignerConfig
+	auditKey    string
+	profilePath bool
 }
 
 func New() *cli.CLI {
@@ -47,6 +56,12 @@ func New() *cli.CLI {
 	cf.caCommands()
 	cf.certCommands()
 	cf.configCommands()
+	cf.profileCommands()
+	cf.auditCommands()
+	cf.reportCommands()
+	cf.agentCommands()
+	cf.inspectCommands()
+	cf.verifyCommands()
 
 	return cf.Cli
 }
@@ -103,16 +118,23 @@ func (c *CommandFactory) caCommands() {
 		Use:   "ca:add CERT_PATH KEY_PATH",
 		Short: "Store a previously generated root certificate from PEM formatted files",
 		Run: func(cmd *cobra.Command, args []string) {
-			c.addCertificate("ca", args)
+			c.addCertificate(c.CA, args)
 		},
 	}
 
+	var transit bool
+	var caName string
+
 	caCreateCommand := &cobra.Command{
 		Use:   "ca:create",
 		Short: "Create root certificate",
 		Run: func(cmd *cobra.Command, args []string) {
 			c.initClient()
-			err := c.Client.GenerateCA()
+			if caName != "" {
+				c.CA = caName
+				c.Client.UseCA(caName)
+			}
+			err := c.Client.GenerateCA(transit)
 			if err != nil {
 				fmt.Printf("%v", err)
 				os.Exit(1)
@@ -122,12 +144,15 @@ func (c *CommandFactory) caCommands() {
 		},
 	}
 
+	caCreateCommand.Flags().BoolVar(&transit, "transit", false, "generate and keep the private key in vault transit")
+	caCreateCommand.Flags().StringVar(&caName, "name", "", "name of the root CA to create, same as --ca")
+
 	caKeyCommand := &cobra.Command{
 		Use:   "ca:key",
 		Short: "Get root certificate private key",
 		Run: func(cmd *cobra.Command, args []string) {
 			c.initClient()
-			err := c.Client.GetKey("ca", c.Output)
+			err := c.Client.GetKey(c.CA, c.Output)
 			if err != nil {
 				fmt.Printf("%v", err)
 				os.Exit(1)
@@ -136,12 +161,22 @@ func (c *CommandFactory) caCommands() {
 	}
 	c.bindOutputFlag(caKeyCommand)
 
+	var caTemplate string
+	caConfigMap := &client.KubernetesFlags{}
 	caCertCommand := &cobra.Command{
 		Use:   "ca:cert",
 		Short: "Get root certificate",
 		Run: func(cmd *cobra.Command, args []string) {
 			c.initClient()
-			err := c.Client.GetCert("ca", c.Output)
+			var err error
+			switch {
+			case caTemplate != "":
+				err = c.Client.RenderTemplate(c.CA, caTemplate, "")
+			case c.Output == client.FormatConfigMap:
+				err = c.Client.GetTrustBundleConfigMap(caConfigMap)
+			default:
+				err = c.Client.GetCert(c.CA, c.Output, 0)
+			}
 			if err != nil {
 				fmt.Printf("%v", err)
 				os.Exit(1)
@@ -149,13 +184,44 @@ func (c *CommandFactory) caCommands() {
 		},
 	}
 	c.bindOutputFlag(caCertCommand)
+	c.bindKubernetesFlags(caCertCommand, caConfigMap)
+	c.bindTemplateFlag(caCertCommand, &caTemplate)
+	caCertCommand.Flags().Lookup("output").Usage = "output format. allowed: text, base64, k8s-configmap (the trust bundle)"
 
 	caCRLCommand := &cobra.Command{
 		Use:   "ca:crl",
 		Short: "Get root certificate revocation list",
 		Run: func(cmd *cobra.Command, args []string) {
 			c.initClient()
-			err := c.Client.GetCRL("ca")
+			err := c.Client.GetCRL(c.CA)
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	caImportCommand := &cobra.Command{
+		Use:   "ca:import CERT_PATH",
+		Short: "Store a root certificate without its private key, keeping the root offline",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.ImportCA(getPath(args))
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	var intermediateTTL string
+
+	caSignIntermediateCommand := &cobra.Command{
+		Use:   "ca:sign-intermediate CSR_PATH",
+		Short: "Sign an intermediate certificate request with the root key",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.SignIntermediate(getPath(args), intermediateTTL)
 			if err != nil {
 				fmt.Printf("%v", err)
 				os.Exit(1)
@@ -163,13 +229,106 @@ func (c *CommandFactory) caCommands() {
 		},
 	}
 
+	caSignIntermediateCommand.Flags().StringVar(&intermediateTTL, "ttl", "", "intermediate certificate lifetime, e.g. 1825d (default 5 years)")
+
+	caSignCRLCommand := &cobra.Command{
+		Use:   "ca:sign-crl",
+		Short: "Re-sign the root certificate revocation list with the root key",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.SignCRL()
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	caImportCRLCommand := &cobra.Command{
+		Use:   "ca:import-crl CRL_PATH",
+		Short: "Store a root certificate revocation list signed offline",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.ImportCRL(getPath(args))
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	var rolloverAt, rolloverTTL string
+
+	caRolloverCommand := &cobra.Command{
+		Use:   "ca:rollover [<intermediate>]",
+		Short: "Replace the root or an intermediate key, cross-signing a new root with the old",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			name := c.CA
+			if len(args) > 0 {
+				name = getCertificateName(args)
+			}
+			err := c.Client.Rollover(name, rolloverAt, rolloverTTL)
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	caRolloverCommand.Flags().StringVar(&rolloverAt, "at", "", "date the new key takes over issuance, YYYY-MM-DD or RFC 3339 (default now)")
+	caRolloverCommand.Flags().StringVar(&rolloverTTL, "ttl", "", "lifetime of the new certificate, e.g. 3650d (default that of the current one)")
+
+	var reportFilter labels
+	caRolloverReportCommand := &cobra.Command{
+		Use:   "ca:rollover-report",
+		Short: "List active certificates that still chain only to the old root",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.RolloverReport(reportFilter)
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	caRolloverReportCommand.Flags().Var(&reportFilter, "label", "only list certificates with this key=value metadata, repeatable")
+
+	bundleKeystore := &client.KeystoreFlags{}
+	caBundleCommand := &cobra.Command{
+		Use:   "ca:bundle",
+		Short: "Get the root certificates to trust, including both roots during a rollover",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			var err error
+			if client.IsKeystoreFormat(c.Output) {
+				err = c.Client.GetTrustStore(c.Output, bundleKeystore)
+			} else {
+				err = c.Client.GetTrustBundle(c.Output)
+			}
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	c.bindOutputFlag(caBundleCommand)
+	c.bindKeystoreFlags(caBundleCommand, bundleKeystore)
+
 	c.Cli.AddTopic("ca", "manage root certificate", true).
 		AddCommand(caCommand).
 		AddCommand(caAddCommand).
+		AddCommand(caImportCommand).
 		AddCommand(caCreateCommand).
 		AddCommand(caCertCommand).
 		AddCommand(caKeyCommand).
-		AddCommand(caCRLCommand)
+		AddCommand(caCRLCommand).
+		AddCommand(caSignIntermediateCommand).
+		AddCommand(caSignCRLCommand).
+		AddCommand(caImportCRLCommand).
+		AddCommand(caRolloverCommand).
+		AddCommand(caRolloverReportCommand).
+		AddCommand(caBundleCommand)
 }
 
 func (c *CommandFactory) certCommands() {
@@ -180,9 +339,7 @@ func (c *CommandFactory) certCommands() {
 		},
 	}
 
-	var rootName string
-	var dnsNames string
-	var ipAddresses string
+	certFlags := &client.CertificateFlags{}
 
 	certAddCommand := &cobra.Command{
 		Use:   "cert:add <name> CERT_PATH KEY_PATH",
@@ -199,17 +356,125 @@ func (c *CommandFactory) certCommands() {
 		Run: func(cmd *cobra.Command, args []string) {
 			c.initClient()
 			name := getCertificateName(args)
-			err := c.Client.Generate(name, rootName, dnsNames, ipAddresses)
+			err := c.Client.Generate(name, certFlags)
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	certCreateCommand.Flags().StringVar(&certFlags.Role, "role", "", "name of configured role to issue with")
+	certCreateCommand.Flags().StringVarP(&certFlags.Parent, "root", "r", "", "name of signing certificate (default the selected --ca)")
+	certCreateCommand.Flags().StringVarP(&certFlags.DNSNames, "dnsnames", "d", "", "comma separated subject alt dns names")
+	certCreateCommand.Flags().StringVarP(&certFlags.IPAddresses, "ips", "i", "", "comma separated subject alt ip names")
+	bindSubjectFlags(certCreateCommand, certFlags)
+	certCreateCommand.Flags().BoolVar(&certFlags.KeyInBackend, "transit", false, "generate and keep the private key in vault transit, e.g. for intermediates")
+	certCreateCommand.Flags().StringVar(&certFlags.PublicKeyFile, "public-key", "", "PEM public key to certify instead of generating a key, only the certificate is stored")
+	certCreateCommand.Flags().StringVar(&certFlags.KeyFile, "key", "", "PEM RSA private key to certify and store instead of generating a key")
+	bindTokenFlags(certCreateCommand, &certFlags.Token)
+	certCreateCommand.Flags().Var((*labels)(&certFlags.Labels), "label", "key=value metadata such as owner, team, ticket, tags or notes, repeatable")
+
+	var listFilter labels
+	certListCommand := &cobra.Command{
+		Use:   "cert:list",
+		Short: "List certificates with their owner, team and tags",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.List(listFilter)
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	certListCommand.Flags().Var(&listFilter, "label", "only list certificates with this key=value metadata, repeatable")
+
+	certLabelCommand := &cobra.Command{
+		Use:   "cert:label <name> [<key>=<value>..]",
+		Short: "Show or edit certificate metadata, an empty value clears a key",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			if len(args) == 0 {
+				fmt.Println("You must provide a certificate name")
+				os.Exit(1)
+			}
+			err := c.Client.Label(args[0], args[1:])
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	csrFlags := &client.CertificateFlags{}
+
+	certCSRCommand := &cobra.Command{
+		Use:   "cert:csr <name>",
+		Short: "Create an intermediate key and certificate request for an offline root to sign",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			name := getCertificateName(args)
+			err := c.Client.CreateRequest(name, csrFlags)
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	certCSRCommand.Flags().StringVarP(&csrFlags.DNSNames, "dnsnames", "d", "", "comma separated subject alt dns names")
+	certCSRCommand.Flags().StringVarP(&csrFlags.IPAddresses, "ips", "i", "", "comma separated subject alt ip names")
+	bindSubjectFlags(certCSRCommand, csrFlags)
+	certCSRCommand.Flags().BoolVar(&csrFlags.KeyInBackend, "transit", false, "generate and keep the private key in vault transit")
+
+	certImportCommand := &cobra.Command{
+		Use:   "cert:import <name> CERT_PATH",
+		Short: "Store the signed certificate for a certificate request created with cert:csr",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			if len(args) != 2 {
+				fmt.Println("You must provide a certificate name and path")
+				os.Exit(1)
+			}
+			err := c.Client.ImportIntermediate(args[0], args[1])
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	tokenFlags := &client.TokenFlags{}
+
+	certTokenCommand := &cobra.Command{
+		Use:   "cert:token <name>",
+		Short: "Create a new access token for a certificate",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			name := getCertificateName(args)
+			err := c.Client.CreateToken(name, tokenFlags)
 			if err != nil {
 				fmt.Printf("%v", err)
 				os.Exit(1)
 			}
 		},
 	}
+	bindTokenFlags(certTokenCommand, tokenFlags)
 
-	certCreateCommand.Flags().StringVarP(&rootName, "root", "r", "ca", "name of root certificate")
-	certCreateCommand.Flags().StringVarP(&dnsNames, "dnsnames", "d", "", "comma separated subject alt dns names")
-	certCreateCommand.Flags().StringVarP(&ipAddresses, "ips", "i", "", "comma separated subject alt ip names")
+	certTokensCommand := &cobra.Command{
+		Use:   "cert:tokens <name>",
+		Short: "List access tokens created for a certificate",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			name := getCertificateName(args)
+			err := c.Client.ListTokens(name)
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
 
 	certKeyCommand := &cobra.Command{
 		Use:   "cert:key <name>",
@@ -226,13 +491,26 @@ func (c *CommandFactory) certCommands() {
 	}
 	c.bindOutputFlag(certKeyCommand)
 
+	var certVersion int
+	var certTemplate string
+	certKeystore := &client.KeystoreFlags{}
 	certCertCommand := &cobra.Command{
 		Use:   "cert:cert <name>",
 		Short: "Get certificate",
 		Run: func(cmd *cobra.Command, args []string) {
 			c.initClient()
 			name := getCertificateName(args)
-			err := c.Client.GetCert(name, c.Output)
+			var err error
+			switch {
+			case certTemplate != "" && certVersion != 0:
+				err = fmt.Errorf("authority: --template renders the current version only")
+			case certTemplate != "":
+				err = c.Client.RenderTemplate(name, certTemplate, certKeystore.File)
+			case client.IsKeystoreFormat(c.Output):
+				err = c.Client.GetKeystore(name, c.Output, certKeystore)
+			default:
+				err = c.Client.GetCert(name, c.Output, certVersion)
+			}
 			if err != nil {
 				fmt.Printf("%v", err)
 				os.Exit(1)
@@ -240,14 +518,147 @@ func (c *CommandFactory) certCommands() {
 		},
 	}
 	c.bindOutputFlag(certCertCommand)
+	certCertCommand.Flags().IntVar(&certVersion, "version", 0, "version of the certificate, as listed by cert:history (default the current one)")
+	c.bindKeystoreFlags(certCertCommand, certKeystore)
+	certCertCommand.Flags().StringVar(&certKeystore.Alias, "alias", "", "keystore alias of the key entry (default the certificate name)")
+	certCertCommand.Flags().BoolVar(&certKeystore.Chain, "chain", true, "include the CA chain in the keystore key entry")
+	c.bindTemplateFlag(certCertCommand, &certTemplate)
 
+	fetchFlags := &client.FetchFlags{}
+	certFetchCommand := &cobra.Command{
+		Use:   "cert:fetch <name>",
+		Short: "Write certificate, key, chain and CA bundle to files in a directory",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.Fetch(getCertificateName(args), fetchFlags)
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	certFetchCommand.Flags().StringVar(&fetchFlags.Dir, "dir", "", "directory to write the files to, created if missing")
+	certFetchCommand.Flags().StringVar(&fetchFlags.CertFile, "cert-file", client.DefaultCertFile, "certificate file name, empty to skip")
+	certFetchCommand.Flags().StringVar(&fetchFlags.KeyFile, "key-file", client.DefaultKeyFile, "private key file name, written with mode 0600, empty to skip")
+	certFetchCommand.Flags().StringVar(&fetchFlags.ChainFile, "chain-file", client.DefaultChainFile, "intermediate CA chain file name, empty to skip")
+	certFetchCommand.Flags().StringVar(&fetchFlags.CAFile, "ca-file", client.DefaultCAFile, "root CA bundle file name, empty to skip")
+	certFetchCommand.Flags().StringVar(&fetchFlags.Owner, "owner", "", "owner of the written files, as user[:group]")
+	certFetchCommand.Flags().StringVar(&fetchFlags.PassphraseFile, "passphrase-file", "", "encrypt the private key with the passphrase on the first line of this file")
+	certFetchCommand.Flags().BoolVar(&fetchFlags.Force, "force", false, "overwrite a certificate file holding a newer certificate")
+
+	secretFlags := &client.KubernetesFlags{}
+	certSecretCommand := &cobra.Command{
+		Use:   "cert:k8s-secret <name>",
+		Short: "Get a kubernetes.io/tls Secret manifest holding certificate, key and CA bundle",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.GetKubernetesSecret(getCertificateName(args), secretFlags)
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	c.bindKubernetesFlags(certSecretCommand, secretFlags)
+
+	certInspectCommand := &cobra.Command{
+		Use:   "cert:inspect <name>",
+		Short: "Decode certificate, showing its names, key, usages, fingerprints, chain and revocation status",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.Inspect(getCertificateName(args), c.Output)
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	c.bindOutputFlag(certInspectCommand)
+	certInspectCommand.Flags().Lookup("output").Usage = "output format. allowed: text, json"
+
+	certHistoryCommand := &cobra.Command{
+		Use:   "cert:history <name>",
+		Short: "List every version of a certificate with its serial, validity and status",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.History(getCertificateName(args))
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	var cascade bool
+	var revokeVersion int
+	var revokeSerial, revokeCert, revokeIssuer string
 	certRevokeCommand := &cobra.Command{
 		Use:   "cert:revoke <name>",
 		Short: "Revoke certificate",
 		Run: func(cmd *cobra.Command, args []string) {
 			c.initClient()
-			name := getCertificateName(args)
-			err := c.Client.Revoke(name)
+			var err error
+			switch {
+			case revokeCert != "":
+				err = c.Client.RevokeCertificate(revokeCert)
+			case revokeSerial != "":
+				err = c.Client.RevokeSerial(revokeIssuer, revokeSerial)
+			default:
+				err = c.Client.Revoke(getCertificateName(args), cascade, revokeVersion)
+			}
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	certRevokeCommand.Flags().BoolVar(&cascade, "cascade", false, "also revoke every certificate issued below it, with reason cACompromise")
+	certRevokeCommand.Flags().IntVar(&revokeVersion, "version", 0, "revoke this version of the certificate, as listed by cert:history (default the current one)")
+	certRevokeCommand.Flags().StringVar(&revokeSerial, "serial", "", "revoke the certificate with this hex serial number, without needing it in the store")
+	certRevokeCommand.Flags().StringVar(&revokeIssuer, "issuer", "", "name of the CA that issued --serial (default the selected --ca)")
+	certRevokeCommand.Flags().StringVar(&revokeCert, "cert", "", "revoke the certificate in this PEM file, on the CRL of the stored CA that signed it")
+
+	var renewExpiring string
+	var renewFilter labels
+	certRenewCommand := &cobra.Command{
+		Use:   "cert:renew <name>",
+		Short: "Reissue certificate with a new key, keeping its subject, SANs and lifetime",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			var err error
+			if renewExpiring != "" {
+				err = c.Client.RenewExpiring(renewExpiring, renewFilter)
+			} else {
+				err = c.Client.Renew(getCertificateName(args))
+			}
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	certRenewCommand.Flags().StringVar(&renewExpiring, "expiring", "", "instead of one certificate, renew every certificate expiring within this window, such as 30d, capped at two thirds of its lifetime")
+	certRenewCommand.Flags().Var(&renewFilter, "label", "with --expiring, only renew certificates with this key=value metadata, repeatable")
+
+	certHoldCommand := &cobra.Command{
+		Use:   "cert:hold <name>",
+		Short: "Suspend certificate, listing it on its issuer's CRL with reason certificateHold",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.Hold(getCertificateName(args))
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	certReleaseCommand := &cobra.Command{
+		Use:   "cert:release <name>",
+		Short: "Lift a certificate hold, removing it from its issuer's CRL",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.Release(getCertificateName(args))
 			if err != nil {
 				fmt.Printf("%v", err)
 				os.Exit(1)
@@ -257,10 +668,14 @@ func (c *CommandFactory) certCommands() {
 
 	certCRLCommand := &cobra.Command{
 		Use:   "cert:crl <name>",
-		Short: "Get certificate revocation list",
+		Short: "Get the certificate revocation list of a CA certificate",
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("Not implemented")
-			os.Exit(1)
+			c.initClient()
+			err := c.Client.GetCRL(getCertificateName(args))
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
 		},
 	}
 
@@ -268,14 +683,29 @@ func (c *CommandFactory) certCommands() {
 		AddCommand(certCommand).
 		AddCommand(certAddCommand).
 		AddCommand(certCreateCommand).
+		AddCommand(certListCommand).
+		AddCommand(certLabelCommand).
+		AddCommand(certCSRCommand).
+		AddCommand(certImportCommand).
 		AddCommand(certCertCommand).
+		AddCommand(certFetchCommand).
+		AddCommand(certSecretCommand).
+		AddCommand(certInspectCommand).
+		AddCommand(certHistoryCommand).
 		AddCommand(certKeyCommand).
+		AddCommand(certRenewCommand).
 		AddCommand(certRevokeCommand).
+		AddCommand(certHoldCommand).
+		AddCommand(certReleaseCommand).
+		AddCommand(certTokenCommand).
+		AddCommand(certTokensCommand).
 		AddCommand(certCRLCommand)
 }
 
 func (c *CommandFactory) configCommands() {
 	var filePath string
+	var roleName string
+	var check bool
 
 	configCommand := &cobra.Command{
 		Use: "config",
@@ -289,7 +719,12 @@ func (c *CommandFactory) configCommands() {
 		Short: "Get authority configuration",
 		Run: func(cmd *cobra.Command, args []string) {
 			c.initClient()
-			err := c.Client.GetConfig()
+			var err error
+			if roleName != "" {
+				err = c.Client.GetRole(roleName)
+			} else {
+				err = c.Client.GetConfig()
+			}
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
@@ -297,6 +732,8 @@ func (c *CommandFactory) configCommands() {
 		},
 	}
 
+	configGetCommand.Flags().StringVar(&roleName, "role", "", "show and validate a single role")
+
 	configSetCommand := &cobra.Command{
 		Use:   "config:set [<key> <value> | -f <file>]",
 		Short: "Set authority configuration, either a single value or a file with multiple values",
@@ -306,12 +743,12 @@ func (c *CommandFactory) configCommands() {
 			if len(args) == 2 {
 				key := args[0]
 				val := args[1]
-				err = c.Client.SetConfigItem(key, val)
+				err = c.Client.SetConfigItem(key, val, check)
 			} else if len(args) == 0 {
 				if filePath != "" {
-					err = c.Client.SetConfig(filePath)
+					err = c.Client.SetConfig(filePath, check)
 				} else {
-					err = c.Client.SetAllConfig()
+					err = c.Client.SetAllConfig(check)
 				}
 			} else {
 				fmt.Println("You must provide a key value pair or file name")
@@ -325,7 +762,8 @@ func (c *CommandFactory) configCommands() {
 		},
 	}
 
-	configSetCommand.Flags().StringVarP(&filePath, "file", "f", "", "configuration file")
+	configSetCommand.Flags().StringVarP(&filePath, "file", "f", "", "configuration file (.toml, .hcl or .json)")
+	configSetCommand.Flags().BoolVar(&check, "check", false, "validate the configuration without storing it")
 
 	c.Cli.AddTopic("config", "edit certificate configuration settings", false).
 		AddCommand(configCommand).
@@ -333,39 +771,331 @@ func (c *CommandFactory) configCommands() {
 		AddCommand(configSetCommand)
 }
 
+func (c *CommandFactory) profileCommands() {
+	profileCommand := &cobra.Command{
+		Use: "profile",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	profileListCommand := &cobra.Command{
+		Use:   "profile:list",
+		Short: "List connection profiles",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := client.ListProfiles(client.DefaultProfilesPath())
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	profileUseCommand := &cobra.Command{
+		Use:   "profile:use <name>",
+		Short: "Set the current connection profile",
+		Run: func(cmd *cobra.Command, args []string) {
+			name := getCertificateName(args)
+			err := client.UseProfile(client.DefaultProfilesPath(), name)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	profileShowCommand := &cobra.Command{
+		Use:   "profile:show [<name>]",
+		Short: "Show a connection profile, or the current profile",
+		Run: func(cmd *cobra.Command, args []string) {
+			name := c.Profile
+			if name == "" {
+				name = os.Getenv("AUTHORITY_PROFILE")
+			}
+			if len(args) > 0 {
+				name = getCertificateName(args)
+			}
+			err := client.ShowProfile(client.DefaultProfilesPath(), name)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	c.Cli.AddTopic("profile", "manage backend connection profiles", false).
+		AddCommand(profileCommand).
+		AddCommand(profileListCommand).
+		AddCommand(profileUseCommand).
+		AddCommand(profileShowCommand)
+}
+
+func (c *CommandFactory) auditCommands() {
+	auditCommand := &cobra.Command{
+		Use: "audit",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	auditListCommand := &cobra.Command{
+		Use:   "audit:list",
+		Short: "List the audit log of operations and private key reads",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.AuditLog()
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	auditVerifyCommand := &cobra.Command{
+		Use:   "audit:verify",
+		Short: "Check the audit log's hash chain for changed or removed entries",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.VerifyAuditLog()
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	c.Cli.AddTopic("audit", "inspect the tamper-evident audit log", false).
+		AddCommand(auditCommand).
+		AddCommand(auditListCommand).
+		AddCommand(auditVerifyCommand)
+}
+
+func (c *CommandFactory) reportCommands() {
+	reportCommand := &cobra.Command{
+		Use: "report",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	var within, format string
+	var threshold int
+	var filter labels
+	reportExpiringCommand := &cobra.Command{
+		Use:   "report:expiring",
+		Short: "List certificates expiring soon, grouped by issuer, failing above a threshold",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.ExpiryReport(within, format, threshold, filter)
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	reportExpiringCommand.Flags().StringVar(&within, "within", "30d", "report certificates expiring within this window, e.g. 30d or 72h")
+	reportExpiringCommand.Flags().StringVarP(&format, "output", "o", client.FormatTable, "output format. allowed: table, json, csv, prometheus")
+	reportExpiringCommand.Flags().IntVar(&threshold, "threshold", 0, "exit non-zero when more certificates than this expire within the window, negative to never fail")
+	reportExpiringCommand.Flags().Var(&filter, "label", "only report certificates with this key=value metadata, repeatable")
+
+	c.Cli.AddTopic("report", "report on stored certificates", false).
+		AddCommand(reportCommand).
+		AddCommand(reportExpiringCommand)
+}
+
+func (c *CommandFactory) agentCommands() {
+	var configPath string
+	var once bool
+	agentCommand := &cobra.Command{
+		Use:   "agent",
+		Short: "Keep certificates on this host current, writing their files and running reload commands",
+		Run: func(cmd *cobra.Command, args []string) {
+			if configPath == "" {
+				fmt.Println("agent config file required, use --config")
+				os.Exit(1)
+			}
+			c.initClient()
+			err := c.Client.RunAgent(configPath, once)
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	agentCommand.Flags().StringVarP(&configPath, "config", "c", "", "agent config file, in TOML")
+	agentCommand.Flags().BoolVar(&once, "once", false, "check every certificate once and exit, e.g. from cron")
+
+	c.Cli.AddTopic("agent", "run the certificate agent", false).
+		AddCommand(agentCommand)
+}
+
+func (c *CommandFactory) inspectCommands() {
+	inspectCommand := &cobra.Command{
+		Use:   "inspect <file>",
+		Short: "Decode the certificates in a PEM or DER file, with chain and revocation status from the store",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.InspectFile(getPath(args), c.Output)
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	c.bindOutputFlag(inspectCommand)
+	inspectCommand.Flags().Lookup("output").Usage = "output format. allowed: text, json"
+
+	c.Cli.AddTopic("inspect", "decode certificate files", false).
+		AddCommand(inspectCommand)
+}
+
+func (c *CommandFactory) verifyCommands() {
+	opts := &api.VerifyOptions{}
+	verifyCommand := &cobra.Command{
+		Use:   "verify <file>",
+		Short: "Verify a PEM or DER certificate against the stored CAs and their CRLs, explaining any failure",
+		Run: func(cmd *cobra.Command, args []string) {
+			c.initClient()
+			err := c.Client.Verify(getPath(args), opts, c.Output)
+			if err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(1)
+			}
+		},
+	}
+	c.bindOutputFlag(verifyCommand)
+	verifyCommand.Flags().Lookup("output").Usage = "output format. allowed: text, json"
+	verifyCommand.Flags().StringVar(&opts.Name, "name", "", "require the certificate to be the one currently stored under this name")
+	verifyCommand.Flags().StringVar(&opts.Purpose, "purpose", "", "require the certificate to be usable for this purpose. allowed: server, client")
+	verifyCommand.Flags().StringVar(&opts.Host, "host", "", "require the certificate to be valid for this DNS name or IP address")
+
+	c.Cli.AddTopic("verify", "verify certificate files", false).
+		AddCommand(verifyCommand)
+}
+
 func (c *CommandFactory) initClient() {
+	c.applyProfile()
+
 	env_server := os.Getenv("AUTHORITY_VAULT_SERVER")
 	env_token := os.Getenv("AUTHORITY_VAULT_TOKEN")
 
+	// the environment only fills in what neither a flag nor the profile set
 	if c.Server == "" {
-		if env_server != "" {
-			c.Server = env_server
-		} else {
-			c.Server = DEFAULT_VAULT_SERVER
-		}
+		c.Server = env_server
+	}
+	if c.Server == "" {
+		c.Server = DEFAULT_VAULT_SERVER
 	}
 
-	if c.Token == "" && env_token != "" {
+	if c.Token == "" {
 		c.Token = env_token
 	}
 
+	if c.Backend == "" {
+		if c.flagChanged("path") || c.profilePath {
+			c.Backend = "file"
+		} else {
+			c.Backend = "vault"
+		}
+	}
+
 	if c.Backend != "vault" && c.Backend != "file" {
 		fmt.Println("unrecognized backend:", c.Backend)
 		os.Exit(1)
 	}
 
-	if c.Path == "~/.authority" {
-		c.Path = filepath.Join(os.Getenv("HOME"), ".authority")
+	if strings.HasPrefix(c.Path, "~/") {
+		c.Path = filepath.Join(os.Getenv("HOME"), c.Path[2:])
+	}
+
+	if c.CA == "" {
+		c.CA = os.Getenv("AUTHORITY_CA")
+	}
+	if c.CA == "" {
+		c.CA = "ca"
 	}
 
 	c.Client = client.NewClient(c.Backend, c.Server, c.Token, c.Path)
+	c.Client.UseCA(c.CA)
+	if c.auditKey == "" {
+		c.auditKey = os.Getenv("AUTHORITY_AUDIT_KEY")
+	}
+	c.Client.UseAuditKey(c.auditKey)
+	if err := c.Client.UseSigners(c.signers); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// applyProfile fills in connection settings that were not given as flags
+// from the selected profile, if any, and reads the signers from the profiles
+// file. The profile is chosen by --profile, then AUTHORITY_PROFILE, then the
+// profiles file's current profile. A profile chosen by --profile or
+// AUTHORITY_PROFILE overrides the environment, while the current profile
+// only fills in what the environment does not set.
+func (c *CommandFactory) applyProfile() {
+	profiles, err := client.LoadProfiles(client.DefaultProfilesPath())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	c.signers = profiles.Signers
+
+	name := c.Profile
+	if name == "" {
+		name = os.Getenv("AUTHORITY_PROFILE")
+	}
+	explicit := name != ""
+	if name == "" {
+		name = profiles.Current
+	}
+	if name == "" {
+		return
+	}
+
+	profile, err := profiles.Get(name)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	settings := []struct {
+		flag  string
+		env   string
+		value string
+		dest  *string
+	}{
+		{"backend", "", profile.Backend, &c.Backend},
+		{"path", "", profile.Path, &c.Path},
+		{"server", "AUTHORITY_VAULT_SERVER", profile.Server, &c.Server},
+		{"token", "AUTHORITY_VAULT_TOKEN", profile.Token, &c.Token},
+		{"ca", "AUTHORITY_CA", profile.CA, &c.CA},
+		{"", "AUTHORITY_AUDIT_KEY", profile.AuditKey, &c.auditKey},
+	}
+	for _, s := range settings {
+		if s.value == "" || (s.flag != "" && c.flagChanged(s.flag)) {
+			continue
+		}
+		if !explicit && s.env != "" && os.Getenv(s.env) != "" {
+			continue
+		}
+		*s.dest = s.value
+	}
+	c.profilePath = profile.Path != "" && !c.flagChanged("path")
+}
+
+func (c *CommandFactory) flagChanged(name string) bool {
+	flag := c.Cli.Flags().Lookup(name)
+	return flag != nil && flag.Changed
 }
 
 func (c *CommandFactory) globalFlags() {
-	c.Cli.Flags().StringVarP(&c.Backend, "backend", "b", "vault", "backend type: vault or file")
+	c.Cli.Flags().StringVarP(&c.Backend, "backend", "b", "", "backend type: vault or file (default \"vault\")")
 	c.Cli.Flags().StringVarP(&c.Path, "path", "p", "~/.authority", "file backend path")
 	c.Cli.Flags().StringVarP(&c.Server, "server", "s", "", "address of vault server (AUTHORITY_VAULT_SERVER)")
 	c.Cli.Flags().StringVarP(&c.Token, "token", "t", "", "vault access token (AUTHORITY_VAULT_TOKEN)")
+	c.Cli.Flags().StringVar(&c.Profile, "profile", "", "connection profile to use (AUTHORITY_PROFILE)")
+	c.Cli.Flags().StringVar(&c.CA, "ca", "", "name of the root CA hierarchy to use (AUTHORITY_CA) (default \"ca\")")
 }
 
 func getCertificateName(args []string) string {
@@ -382,6 +1112,82 @@ func getCertificateName(args []string) string {
 	return args[0]
 }
 
+// labels is a repeatable flag collecting key=value pairs.
+type labels []string
+
+func (l *labels) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *labels) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func (l *labels) Type() string {
+	return "key=value"
+}
+
+// attributes is a repeatable flag of subject attributes. Values are kept
+// whole, so that they may contain commas.
+type attributes []string
+
+func (a *attributes) String() string {
+	return strings.Join(*a, " ")
+}
+
+func (a *attributes) Set(value string) error {
+	*a = append(*a, value)
+	return nil
+}
+
+func (a *attributes) Type() string {
+	return "OID=value"
+}
+
+func getPath(args []string) string {
+	if len(args) != 1 {
+		fmt.Println("You must provide a single file path")
+		os.Exit(1)
+	}
+	return args[0]
+}
+
+func bindSubjectFlags(cmd *cobra.Command, flags *client.CertificateFlags) {
+	cmd.Flags().StringVar(&flags.Country, "country", "", "subject country (C)")
+	cmd.Flags().StringVar(&flags.Org, "org", "", "subject organization (O)")
+	cmd.Flags().StringVar(&flags.OrgUnit, "org-unit", "", "subject organizational unit (OU)")
+	cmd.Flags().StringVar(&flags.City, "city", "", "subject locality (L)")
+	cmd.Flags().StringVar(&flags.Region, "region", "", "subject state or province (ST)")
+	cmd.Flags().StringVar(&flags.Email, "email", "", "subject email address")
+	cmd.Flags().StringVar(&flags.SerialNumber, "subject-serial", "", "subject serial number")
+	cmd.Flags().Var((*attributes)(&flags.Attributes), "rdn", "extra subject attribute in OID=value form, repeatable")
+}
+
+func bindTokenFlags(cmd *cobra.Command, flags *client.TokenFlags) {
+	cmd.Flags().StringVar(&flags.TTL, "token-ttl", "", "access token time to live, e.g. 720h or 30d (default no expiry)")
+	cmd.Flags().IntVar(&flags.Uses, "token-uses", 0, "number of uses allowed for the access token (default unlimited)")
+	cmd.Flags().StringVar(&flags.WrapTTL, "wrap-ttl", "", "response-wrap the access token, valid for the given time, e.g. 5m")
+}
+
 func (c *CommandFactory) bindOutputFlag(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&c.Output, "output", "o", "text", "output format. allowed: text, base64")
 }
+
+func (c *CommandFactory) bindKubernetesFlags(cmd *cobra.Command, flags *client.KubernetesFlags) {
+	cmd.Flags().StringVar(&flags.Name, "name", "", "name of the Kubernetes object (default derived from the certificate name)")
+	cmd.Flags().StringVar(&flags.Namespace, "namespace", "", "namespace of the Kubernetes object")
+	cmd.Flags().Var((*labels)(&flags.Labels), "label", "key=value Kubernetes label, repeatable")
+}
+
+func (c *CommandFactory) bindTemplateFlag(cmd *cobra.Command, tmpl *string) {
+	cmd.Flags().StringVar(tmpl, "template", "", "render with this Go text/template file, or a built-in one: "+strings.Join(client.TemplateNames(), ", "))
+}
+
+// bindKeystoreFlags adds the pkcs12 and jks output formats to a command
+// bound with bindOutputFlag.
+func (c *CommandFactory) bindKeystoreFlags(cmd *cobra.Command, flags *client.KeystoreFlags) {
+	cmd.Flags().Lookup("output").Usage = "output format. allowed: text, base64, pkcs12, jks"
+	cmd.Flags().StringVar(&flags.PassphraseFile, "passphrase-file", "", "keystore passphrase, read from the first line of this file")
+	cmd.Flags().StringVar(&flags.File, "file", "", "write the keystore or template output to this file with mode 0600 instead of standard output")
+}
@@ -3,8 +3,15 @@ package config
 import (
 	"bytes"
 	"fmt"
+	"net"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/hashicorp/hcl"
 )
 
 var configKeys = []string{"root_domain",
@@ -20,43 +27,333 @@ var configKeys = []string{"root_domain",
 
 // Returns whether or not the provided key is a valid configuration item.
 func KeyIsValid(key string) bool {
-	for _, v := range configKeys {
-		if v == key {
+	return contains(configKeys, key)
+}
+
+// Config provides a structure to read x509 certificate configuration
+// information from TOML, HCL or JSON.
+type Config struct {
+	Version  int                   `toml:"version" hcl:"version"`
+	Defaults DefaultsConfig        `toml:"defaults" hcl:"defaults"`
+	Policy   PolicyConfig          `toml:"policy" hcl:"policy"`
+	Roles    map[string]RoleConfig `toml:"roles" hcl:"roles"`
+	CAs      map[string]CAConfig   `toml:"cas" hcl:"cas"`
+
+	// Signers is only read so that Validate can reject it. Opening a signer
+	// runs its command or module, so signers are configured in each
+	// client's profiles file, never in the configuration stored in the
+	// backend.
+	Signers map[string]SignerConfig `toml:"signers" hcl:"signers"`
+}
+
+// Returns an empty configuration at the current schema version.
+func New() *Config {
+	return &Config{Version: CurrentVersion}
+}
+
+type DefaultsConfig struct {
+	RootDomain string `toml:"root_domain" hcl:"root_domain"`
+	Email      string `toml:"email" hcl:"email"`
+	Org        string `toml:"org" hcl:"org"`
+	OrgUnit    string `toml:"org_unit" hcl:"org_unit"`
+	City       string `toml:"city" hcl:"city"`
+	Region     string `toml:"region" hcl:"region"`
+	Country    string `toml:"country" hcl:"country"`
+	CrlDays    string `toml:"crl_days" hcl:"crl_days"`
+	Digest     string `toml:"digest" hcl:"digest"`
+	CertExpiry string `toml:"cert_expiry" hcl:"cert_expiry"`
+}
+
+// PolicyConfig holds restrictions the CA places on issued certificates.
+type PolicyConfig struct {
+	// LockedSubject lists subject fields, by configuration key, that must
+	// always use the configured default value.
+	LockedSubject []string `toml:"locked_subject" hcl:"locked_subject"`
+
+	// OfflineRoot forbids generating the root key in this store. The root
+	// certificate must be imported without its key, and certificates are
+	// issued by intermediates signed offline.
+	OfflineRoot bool `toml:"offline_root" hcl:"offline_root"`
+}
+
+// Returns whether or not the provided subject field is locked by policy.
+func (p *PolicyConfig) SubjectIsLocked(key string) bool {
+	return contains(p.LockedSubject, key)
+}
+
+// CAConfig holds the settings of one named root CA, for stores holding
+// several independent hierarchies. Defaults set here override the global
+// defaults, the policy adds to the global policy, and roles replace global
+// roles of the same name.
+type CAConfig struct {
+	Defaults DefaultsConfig        `toml:"defaults" hcl:"defaults"`
+	Policy   PolicyConfig          `toml:"policy" hcl:"policy"`
+	Roles    map[string]RoleConfig `toml:"roles" hcl:"roles"`
+
+	// Signers is only read so that Validate can reject it, as for Config.
+	Signers map[string]SignerConfig `toml:"signers" hcl:"signers"`
+}
+
+// ForCA returns the configuration in effect for the root CA with the
+// provided name, with that CA's section applied over the global settings.
+func (c *Config) ForCA(name string) *Config {
+	section, ok := c.CAs[name]
+	if !ok {
+		return c
+	}
+
+	merged := *c
+	overrides := &Config{Defaults: section.Defaults}
+	for _, key := range configKeys {
+		if value := overrides.GetItem(key); value != "" {
+			merged.SetItem(key, value)
+		}
+	}
+
+	merged.Policy.LockedSubject = append(append([]string{}, c.Policy.LockedSubject...), section.Policy.LockedSubject...)
+	merged.Policy.OfflineRoot = c.Policy.OfflineRoot || section.Policy.OfflineRoot
+
+	if len(section.Roles) > 0 {
+		merged.Roles = map[string]RoleConfig{}
+		for name, role := range c.Roles {
+			merged.Roles[name] = role
+		}
+		for name, role := range section.Roles {
+			merged.Roles[name] = role
+		}
+	}
+	return &merged
+}
+
+// RoleConfig provides a named issuance template. Certificates created with a
+// role are signed by the role's parent, use its profile, key and TTL, and may
+// only use names matching the role's allowed name patterns and IP addresses
+// within its allowed ranges. The subject may only be overridden if the role
+// allows it.
+type RoleConfig struct {
+	Parent       string   `toml:"parent" hcl:"parent"`
+	Profile      string   `toml:"profile" hcl:"profile"`
+	KeyType      string   `toml:"key_type" hcl:"key_type"`
+	KeyBits      int      `toml:"key_bits" hcl:"key_bits"`
+	TTL          string   `toml:"ttl" hcl:"ttl"`
+	AllowedNames []string `toml:"allowed_names" hcl:"allowed_names"`
+	AllowedIPs   []string `toml:"allowed_ips" hcl:"allowed_ips"`
+	AllowSubject bool     `toml:"allow_subject" hcl:"allow_subject"`
+	DNSNames     []string `toml:"dns_names" hcl:"dns_names"`
+	IPAddresses  []string `toml:"ip_addresses" hcl:"ip_addresses"`
+}
+
+// SignerConfig configures an external signer for a CA's private key, keyed by
+// the CA's name, so that the key never needs to be stored in the backend.
+// Signers are read from the client-local profiles file.
+type SignerConfig struct {
+	// Type is either "pkcs11" or "external".
+	Type string `toml:"type" hcl:"type"`
+
+	// Command runs an external signer process speaking the signer protocol
+	// on stdin and stdout. Socket instead connects to an external signer
+	// listening on a Unix socket.
+	Command []string `toml:"command" hcl:"command"`
+	Socket  string   `toml:"socket" hcl:"socket"`
+
+	// Module is the path of the PKCS#11 module, such as SoftHSM's
+	// libsofthsm2.so. The key is found by ID or label on the token with the
+	// given label, logging in with the PIN held in the PinEnv environment
+	// variable.
+	Module     string `toml:"module" hcl:"module"`
+	TokenLabel string `toml:"token_label" hcl:"token_label"`
+	KeyID      string `toml:"key_id" hcl:"key_id"`
+	KeyLabel   string `toml:"key_label" hcl:"key_label"`
+	PinEnv     string `toml:"pin_env" hcl:"pin_env"`
+}
+
+// Validate checks that the signer's settings are complete.
+func (s *SignerConfig) Validate() error {
+	switch s.Type {
+	case "external":
+		if (len(s.Command) == 0) == (s.Socket == "") {
+			return fmt.Errorf("external signer needs either a command or a socket")
+		}
+	case "pkcs11":
+		if s.Module == "" {
+			return fmt.Errorf("pkcs11 signer needs a module")
+		}
+		if s.KeyID == "" && s.KeyLabel == "" {
+			return fmt.Errorf("pkcs11 signer needs a key_id or key_label")
+		}
+	default:
+		return fmt.Errorf("unsupported signer type %q", s.Type)
+	}
+	return nil
+}
+
+// Profiles lists the supported certificate profiles. The empty profile
+// issues certificates usable as CA, server and client certificates.
+var Profiles = []string{"", "ca", "server", "client", "peer"}
+
+// KeyTypes lists the supported private key types.
+var KeyTypes = []string{"", "rsa"}
+
+// Returns the role with the provided name, or an error if it does not exist
+// or is invalid.
+func (c *Config) GetRole(name string) (*RoleConfig, error) {
+	role, ok := c.Roles[name]
+	if !ok {
+		return nil, fmt.Errorf("authority: role %s does not exist", name)
+	}
+	if err := role.Validate(); err != nil {
+		return nil, fmt.Errorf("authority: role %s is invalid: %v", name, err)
+	}
+	return &role, nil
+}
+
+// Validate checks that the role's settings are supported.
+func (r *RoleConfig) Validate() error {
+	if !contains(Profiles, r.Profile) {
+		return fmt.Errorf("unsupported profile %q", r.Profile)
+	}
+	if !contains(KeyTypes, r.KeyType) {
+		return fmt.Errorf("unsupported key type %q", r.KeyType)
+	}
+	if r.KeyBits != 0 && r.KeyBits != 2048 && r.KeyBits != 3072 && r.KeyBits != 4096 {
+		return fmt.Errorf("unsupported key size %d", r.KeyBits)
+	}
+	if r.TTL != "" {
+		if _, err := ParseTTL(r.TTL); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range r.AllowedNames {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid name pattern %q", pattern)
+		}
+	}
+	for _, ip := range r.IPAddresses {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid ip address %q", ip)
+		}
+	}
+	for _, ip := range r.AllowedIPs {
+		if _, _, err := net.ParseCIDR(ip); err != nil && net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid ip address or range %q", ip)
+		}
+	}
+	return nil
+}
+
+// NameIsAllowed returns whether the provided name matches one of the role's
+// allowed name patterns. A role without patterns allows any name. Patterns
+// are matched label by label, so a wildcard never spans a dot:
+// "*.example.com" allows "www.example.com" but not "a.b.example.com".
+func (r *RoleConfig) NameIsAllowed(name string) bool {
+	if len(r.AllowedNames) == 0 {
+		return true
+	}
+	labels := strings.Split(strings.ToLower(name), ".")
+	for _, pattern := range r.AllowedNames {
+		if labelsMatch(strings.Split(pattern, "."), labels) {
 			return true
 		}
 	}
 	return false
 }
 
-// Config provides a structure to read x509 certificate configuration
-// information from TOML.
-type Config struct {
-	Defaults DefaultsConfig `toml:"defaults"`
+func labelsMatch(patterns, labels []string) bool {
+	if len(patterns) != len(labels) {
+		return false
+	}
+	for i, pattern := range patterns {
+		if ok, _ := path.Match(pattern, labels[i]); !ok {
+			return false
+		}
+	}
+	return true
 }
 
-type DefaultsConfig struct {
-	RootDomain string `toml:"root_domain"`
-	Email      string `toml:"email"`
-	Org        string `toml:"org"`
-	OrgUnit    string `toml:"org_unit"`
-	City       string `toml:"city"`
-	Region     string `toml:"region"`
-	Country    string `toml:"country"`
-	CrlDays    string `toml:"crl_days"`
-	Digest     string `toml:"digest"`
-	CertExpiry string `toml:"cert_expiry"`
-}
-
-// Load the provided TOML configuration into a Config struct.
+// IPIsAllowed returns whether the provided IP address is one of the role's
+// own IP addresses or lies within one of its allowed addresses or ranges. A
+// role without allowed_ips only allows its own IP addresses.
+func (r *RoleConfig) IPIsAllowed(ip net.IP) bool {
+	for _, allowed := range r.IPAddresses {
+		if ip.Equal(net.ParseIP(allowed)) {
+			return true
+		}
+	}
+	for _, allowed := range r.AllowedIPs {
+		if _, ipNet, err := net.ParseCIDR(allowed); err == nil {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		} else if ip.Equal(net.ParseIP(allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTTL parses a duration such as "720h", or a number of days such as
+// "90d".
+func ParseTTL(ttl string) (time.Duration, error) {
+	ttl = strings.TrimSpace(ttl)
+	if strings.HasSuffix(ttl, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(ttl, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid ttl %q", ttl)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(ttl)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid ttl %q", ttl)
+	}
+	return d, nil
+}
+
+// Load the provided TOML configuration into a Config struct, migrating it to
+// the current schema version if necessary.
 func OpenConfig(config string) (*Config, error) {
+	return ParseConfig(config, "toml")
+}
+
+// Load the provided configuration in the given format ("toml", "hcl" or
+// "json") into a Config struct, migrating it to the current schema version if
+// necessary.
+func ParseConfig(config string, format string) (*Config, error) {
 	c := &Config{}
-	if _, err := toml.Decode(config, c); err != nil {
-		return nil, fmt.Errorf("authority: invalid config %v", err)
+	switch format {
+	case "toml":
+		if _, err := toml.Decode(config, c); err != nil {
+			return nil, fmt.Errorf("authority: invalid config %v", err)
+		}
+	case "hcl", "json":
+		if err := hcl.Decode(c, config); err != nil {
+			return nil, fmt.Errorf("authority: invalid config %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("authority: unsupported config format %q", format)
+	}
+	if err := c.Migrate(); err != nil {
+		return nil, err
 	}
 	return c, nil
 }
 
-func (c *Config) SetItem(item, value string) {
+// Returns the configuration format implied by the provided file name's
+// extension, defaulting to TOML.
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".hcl":
+		return "hcl"
+	case ".json":
+		return "json"
+	default:
+		return "toml"
+	}
+}
+
+// Sets the configuration item with the provided key, returning an error if
+// the key is not a valid configuration item.
+func (c *Config) SetItem(item, value string) error {
 	switch item {
 	case "root_domain":
 		c.Defaults.RootDomain = value
@@ -78,7 +375,10 @@ func (c *Config) SetItem(item, value string) {
 		c.Defaults.Digest = value
 	case "cert_expiry":
 		c.Defaults.CertExpiry = value
+	default:
+		return fmt.Errorf("authority: \"%s\" is not a valid configuration key", item)
 	}
+	return nil
 }
 
 func (c *Config) GetItem(item string) string {
@@ -116,7 +416,26 @@ func (c *Config) ToString() (string, error) {
 	return buf.String(), nil
 }
 
+// Dump a role to a TOML string, as it would appear in the configuration.
+func (r *RoleConfig) ToString(name string) (string, error) {
+	buf := new(bytes.Buffer)
+	roles := map[string]map[string]RoleConfig{"roles": {name: *r}}
+	if err := toml.NewEncoder(buf).Encode(roles); err != nil {
+		return "", fmt.Errorf("authority: cannot encode role: %v", err)
+	}
+	return buf.String(), nil
+}
+
 // Returns a list of valid configuration keys.
 func (c *Config) GetConfigKeys() []string {
 	return configKeys
 }
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
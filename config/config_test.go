@@ -1,8 +1,10 @@
 package config
 
 import (
+	"net"
 	"strings"
 	"testing"
+	"time"
 )
 
 var cfgStr = `
@@ -22,7 +24,7 @@ var cfgStr = `
 func TestParseConfig(t *testing.T) {
 	config, err := OpenConfig(cfgStr)
 	if err != nil {
-		t.Fatal("problem parsing config: %v", err)
+		t.Fatalf("problem parsing config: %v", err)
 	}
 
 	if config.Defaults.RootDomain != "ovrclk.com" {
@@ -39,10 +41,267 @@ func TestDumpConfig(t *testing.T) {
 
 	str, err := config.ToString()
 	if err != nil {
-		t.Fatal("problem encoding config: %v", err)
+		t.Fatalf("problem encoding config: %v", err)
 	}
 
 	if !strings.Contains(str, `root_domain = "ovrclk.com"`) {
 		t.Fatal("got unexpected config values")
 	}
 }
+
+var roleCfgStr = `
+[roles.web]
+  parent = "intermediate"
+  profile = "server"
+  ttl = "90d"
+  allowed_names = ["*.ovrclk.com"]
+  dns_names = ["www.ovrclk.com"]
+
+[roles.broken]
+  profile = "bogus"
+`
+
+func TestParseRoles(t *testing.T) {
+	config, err := OpenConfig(roleCfgStr)
+	if err != nil {
+		t.Fatalf("problem parsing config: %v", err)
+	}
+
+	role, err := config.GetRole("web")
+	if err != nil {
+		t.Fatalf("problem getting role: %v", err)
+	}
+	if role.Parent != "intermediate" || role.Profile != "server" {
+		t.Fatal("got unexpected role values")
+	}
+	if !role.NameIsAllowed("api.ovrclk.com") || role.NameIsAllowed("api.example.com") {
+		t.Fatal("got unexpected allowed names")
+	}
+	if role.NameIsAllowed("a.b.ovrclk.com") || role.NameIsAllowed("ovrclk.com") {
+		t.Fatal("expected a wildcard to match exactly one label")
+	}
+	role.AllowedIPs = []string{"10.0.0.0/8", "192.168.1.1"}
+	for ip, allowed := range map[string]bool{"10.1.2.3": true, "192.168.1.1": true, "192.168.1.2": false} {
+		if role.IPIsAllowed(net.ParseIP(ip)) != allowed {
+			t.Fatalf("expected ip %s allowed to be %v", ip, allowed)
+		}
+	}
+
+	if _, err := config.GetRole("broken"); err == nil {
+		t.Fatal("expected error for invalid role")
+	}
+	if _, err := config.GetRole("missing"); err == nil {
+		t.Fatal("expected error for missing role")
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	ttl, err := ParseTTL("90d")
+	if err != nil || ttl != 90*24*time.Hour {
+		t.Fatalf("got unexpected ttl %v: %v", ttl, err)
+	}
+	ttl, err = ParseTTL("12h")
+	if err != nil || ttl != 12*time.Hour {
+		t.Fatalf("got unexpected ttl %v: %v", ttl, err)
+	}
+	for _, bad := range []string{"", "d", "-1d", "soon"} {
+		if _, err := ParseTTL(bad); err == nil {
+			t.Fatalf("expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestRolesRoundTrip(t *testing.T) {
+	config, err := OpenConfig(cfgStr + roleCfgStr)
+	if err != nil {
+		t.Fatalf("problem parsing config: %v", err)
+	}
+
+	str, err := config.ToString()
+	if err != nil {
+		t.Fatalf("problem encoding config: %v", err)
+	}
+
+	config, err = OpenConfig(str)
+	if err != nil {
+		t.Fatalf("problem parsing encoded config: %v\n%s", err, str)
+	}
+
+	role, err := config.GetRole("web")
+	if err != nil || role.TTL != "90d" || len(role.AllowedNames) != 1 {
+		t.Fatalf("got unexpected role after round trip: %v\n%s", err, str)
+	}
+}
+
+var hclCfgStr = `
+defaults {
+  root_domain = "ovrclk.com"
+  country = "US"
+}
+
+roles "web" {
+  profile = "server"
+  allowed_names = ["*.ovrclk.com"]
+}
+`
+
+var jsonCfgStr = `{
+  "defaults": {
+    "root_domain": "ovrclk.com",
+    "country": "US"
+  },
+  "roles": {
+    "web": {
+      "profile": "server"
+    }
+  }
+}`
+
+func TestParseConfigFormats(t *testing.T) {
+	for format, str := range map[string]string{"hcl": hclCfgStr, "json": jsonCfgStr} {
+		config, err := ParseConfig(str, format)
+		if err != nil {
+			t.Fatalf("problem parsing %s config: %v", format, err)
+		}
+		if config.Defaults.RootDomain != "ovrclk.com" || config.Defaults.Country != "US" {
+			t.Fatalf("got unexpected %s config values", format)
+		}
+		if role, err := config.GetRole("web"); err != nil || role.Profile != "server" {
+			t.Fatalf("got unexpected %s role: %v", format, err)
+		}
+	}
+
+	if FormatFromPath("authority.hcl") != "hcl" || FormatFromPath("authority.json") != "json" || FormatFromPath("authority.conf") != "toml" {
+		t.Fatal("got unexpected format from path")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	config, err := OpenConfig(cfgStr)
+	if err != nil {
+		t.Fatalf("problem parsing config: %v", err)
+	}
+	if err := config.Validate(); err == nil {
+		t.Fatal("expected error for three letter country")
+	}
+
+	config.Defaults.Country = "US"
+	if err := config.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+
+	bad := map[string]string{
+		"cert_expiry": "forever",
+		"crl_days":    "-1",
+		"digest":      "md5",
+		"root_domain": "not a domain",
+	}
+	for key, value := range bad {
+		c := *config
+		if err := c.SetItem(key, value); err != nil {
+			t.Fatalf("problem setting %s: %v", key, err)
+		}
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected error for %s = %q", key, value)
+		}
+	}
+
+	if err := config.SetItem("bogus", "value"); err == nil {
+		t.Fatal("expected error setting unknown key")
+	}
+}
+
+func TestMigrateConfig(t *testing.T) {
+	config, err := OpenConfig(`
+[defaults]
+  country = " us "
+  digest = "SHA256"
+`)
+	if err != nil {
+		t.Fatalf("problem parsing config: %v", err)
+	}
+	if config.Version != CurrentVersion {
+		t.Fatalf("expected config version %d, got %d", CurrentVersion, config.Version)
+	}
+	if config.Defaults.Country != "US" || config.Defaults.Digest != "sha256" {
+		t.Fatal("expected migrated config values")
+	}
+
+	if _, err := OpenConfig("version = 99"); err == nil {
+		t.Fatal("expected error for newer config version")
+	}
+}
+
+func TestConfigForCA(t *testing.T) {
+	config, err := OpenConfig(`
+[defaults]
+  org = "Example"
+  country = "US"
+
+[policy]
+  locked_subject = ["country"]
+
+[cas.staging.defaults]
+  org = "Example Staging"
+
+[cas.staging.policy]
+  locked_subject = ["org"]
+  offline_root = true
+
+[roles.web]
+  ttl = "720h"
+
+[roles.db]
+  ttl = "24h"
+
+[cas.staging.roles.web]
+  ttl = "24h"
+`)
+	if err != nil {
+		t.Fatalf("problem parsing config: %v", err)
+	}
+
+	staging := config.ForCA("staging")
+	if staging.Defaults.Org != "Example Staging" || staging.Defaults.Country != "US" {
+		t.Fatal("expected ca defaults over global defaults")
+	}
+	if !staging.Policy.SubjectIsLocked("org") || !staging.Policy.SubjectIsLocked("country") || !staging.Policy.OfflineRoot {
+		t.Fatal("expected ca policy added to global policy")
+	}
+	if staging.Roles["web"].TTL != "24h" || staging.Roles["db"].TTL != "24h" {
+		t.Fatal("expected ca roles over global roles")
+	}
+	if config.Defaults.Org != "Example" || config.Policy.SubjectIsLocked("org") || config.Roles["web"].TTL != "720h" {
+		t.Fatal("expected global config to be unchanged")
+	}
+	if config.ForCA("prod") != config {
+		t.Fatal("expected global config for ca without a section")
+	}
+
+	config.CAs["staging"] = CAConfig{Defaults: DefaultsConfig{Digest: "md5"}}
+	if err := config.Validate(); err == nil {
+		t.Fatal("expected error for invalid ca defaults")
+	}
+
+	config.CAs["staging"] = CAConfig{Signers: map[string]SignerConfig{"staging": {Type: "external", Command: []string{"id"}}}}
+	if err := config.Validate(); err == nil {
+		t.Fatal("expected error for signers in a ca section")
+	}
+}
+
+func TestStoredSignersRejected(t *testing.T) {
+	config, err := OpenConfig(`
+[defaults]
+  country = "US"
+
+[signers.ca]
+  type = "external"
+  command = ["/bin/sh", "-c", "id"]
+`)
+	if err != nil {
+		t.Fatalf("problem parsing config: %v", err)
+	}
+	if err := config.Validate(); err == nil {
+		t.Fatal("expected error for signers in the stored configuration")
+	}
+}
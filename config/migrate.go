@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CurrentVersion is the configuration schema version written by this
+// release. Configurations without a version predate versioning.
+const CurrentVersion = 1
+
+// migrations upgrade a configuration from the schema version at their index
+// to the next version.
+var migrations = []func(*Config){
+	// 0 -> 1: normalize free-form defaults that are now validated.
+	func(c *Config) {
+		d := &c.Defaults
+		d.Country = strings.ToUpper(strings.TrimSpace(d.Country))
+		d.Digest = strings.ToLower(strings.TrimSpace(d.Digest))
+		d.RootDomain = strings.ToLower(strings.TrimSpace(d.RootDomain))
+		d.CertExpiry = strings.TrimSpace(d.CertExpiry)
+		d.CrlDays = strings.TrimSpace(d.CrlDays)
+	},
+}
+
+// Migrate upgrades the configuration to the current schema version. It
+// returns an error if the configuration is from a newer release.
+func (c *Config) Migrate() error {
+	if c.Version > CurrentVersion {
+		return fmt.Errorf("authority: config version %d is newer than supported version %d", c.Version, CurrentVersion)
+	}
+	for c.Version < CurrentVersion {
+		migrations[c.Version](c)
+		c.Version++
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Digests lists the supported signature digest algorithms.
+var Digests = []string{"sha256", "sha384", "sha512"}
+
+// Validate checks the configuration for values that cannot be used to issue
+// certificates. Empty values are allowed, as they may be set later. All
+// problems found are returned together.
+func (c *Config) Validate() error {
+	var result *multierror.Error
+
+	for _, err := range validateDefaults(&c.Defaults) {
+		result = multierror.Append(result, err)
+	}
+	for _, err := range validatePolicy(&c.Policy) {
+		result = multierror.Append(result, err)
+	}
+
+	for name, role := range c.Roles {
+		if err := role.Validate(); err != nil {
+			result = multierror.Append(result, fmt.Errorf("role %s: %v", name, err))
+		}
+	}
+
+	if len(c.Signers) > 0 {
+		result = multierror.Append(result, fmt.Errorf("signers must be configured in the profiles file, not the stored configuration"))
+	}
+
+	for name, ca := range c.CAs {
+		errs := append(validateDefaults(&ca.Defaults), validatePolicy(&ca.Policy)...)
+		for _, err := range errs {
+			result = multierror.Append(result, fmt.Errorf("ca %s: %v", name, err))
+		}
+		for roleName, role := range ca.Roles {
+			if err := role.Validate(); err != nil {
+				result = multierror.Append(result, fmt.Errorf("ca %s: role %s: %v", name, roleName, err))
+			}
+		}
+		if len(ca.Signers) > 0 {
+			result = multierror.Append(result, fmt.Errorf("ca %s: signers must be configured in the profiles file, not the stored configuration", name))
+		}
+	}
+
+	if result != nil {
+		return fmt.Errorf("authority: invalid configuration: %v", result)
+	}
+	return nil
+}
+
+func validateDefaults(d *DefaultsConfig) []error {
+	var errs []error
+	if d.Country != "" && !isCountryCode(d.Country) {
+		errs = append(errs, fmt.Errorf("country %q must be a two letter country code", d.Country))
+	}
+	if d.CertExpiry != "" && !isPositiveInt(d.CertExpiry) {
+		errs = append(errs, fmt.Errorf("cert_expiry %q must be a number of days", d.CertExpiry))
+	}
+	if d.CrlDays != "" && !isPositiveInt(d.CrlDays) {
+		errs = append(errs, fmt.Errorf("crl_days %q must be a number of days", d.CrlDays))
+	}
+	if d.Digest != "" && !contains(Digests, d.Digest) {
+		errs = append(errs, fmt.Errorf("digest %q is not supported, use one of %s", d.Digest, strings.Join(Digests, ", ")))
+	}
+	if d.RootDomain != "" && !isDomainName(d.RootDomain) {
+		errs = append(errs, fmt.Errorf("root_domain %q is not a valid domain name", d.RootDomain))
+	}
+	return errs
+}
+
+func validatePolicy(p *PolicyConfig) []error {
+	var errs []error
+	for _, key := range p.LockedSubject {
+		if !KeyIsValid(key) {
+			errs = append(errs, fmt.Errorf("locked_subject %q is not a valid configuration key", key))
+		}
+	}
+	return errs
+}
+
+func isCountryCode(s string) bool {
+	if len(s) != 2 {
+		return false
+	}
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isPositiveInt(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0
+}
+
+func isDomainName(s string) bool {
+	if len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,4 @@
+// Package signer provides crypto.Signer implementations for CA private keys
+// which are kept outside of authority's backend, in a PKCS#11 token or an
+// external signer process.
+package signer
@@ -0,0 +1,187 @@
+package signer
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+)
+
+// Request is a message sent to an external signer. Each request and response
+// is a single line of JSON. Byte slices are base64 encoded.
+type Request struct {
+	// Op is either "public", to fetch the signer's public key, or "sign".
+	Op string `json:"op"`
+
+	// Hash names the hash function used to compute Digest, such as
+	// "SHA-256". PSS requests an RSA-PSS rather than PKCS #1 v1.5
+	// signature.
+	Hash   string `json:"hash,omitempty"`
+	PSS    bool   `json:"pss,omitempty"`
+	Digest []byte `json:"digest,omitempty"`
+}
+
+// Response is a message returned by an external signer. PublicKey is a DER
+// encoded SubjectPublicKeyInfo, and Signature is in the format produced by
+// the key's crypto.Signer.
+type Response struct {
+	PublicKey []byte `json:"public_key,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// External is a crypto.Signer which asks an external signer to sign, either
+// by running Command once per request with the request on its stdin and the
+// response on its stdout, or by connecting to the Unix socket Socket.
+type External struct {
+	Command []string
+	Socket  string
+
+	public crypto.PublicKey
+}
+
+// Open fetches the external signer's public key.
+func (e *External) Open() error {
+	resp, err := e.call(&Request{Op: "public"})
+	if err != nil {
+		return err
+	}
+	e.public, err = x509.ParsePKIXPublicKey(resp.PublicKey)
+	if err != nil {
+		return fmt.Errorf("authority: external signer returned invalid public key: %v", err)
+	}
+	return nil
+}
+
+func (e *External) Public() crypto.PublicKey {
+	return e.public
+}
+
+func (e *External) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	_, pss := opts.(*rsa.PSSOptions)
+	resp, err := e.call(&Request{
+		Op:     "sign",
+		Hash:   opts.HashFunc().String(),
+		PSS:    pss,
+		Digest: digest,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Signature, nil
+}
+
+func (e *External) call(req *Request) (*Response, error) {
+	var rw io.ReadWriter
+	var done func() error
+
+	if e.Socket != "" {
+		conn, err := net.Dial("unix", e.Socket)
+		if err != nil {
+			return nil, fmt.Errorf("authority: cannot connect to external signer: %v", err)
+		}
+		defer conn.Close()
+		rw = conn
+		done = func() error { return nil }
+	} else {
+		cmd := exec.Command(e.Command[0], e.Command[1:]...)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("authority: cannot run external signer: %v", err)
+		}
+		rw = struct {
+			io.Reader
+			io.Writer
+		}{stdout, stdin}
+		done = func() error {
+			stdin.Close()
+			return cmd.Wait()
+		}
+	}
+
+	if err := json.NewEncoder(rw).Encode(req); err != nil {
+		done()
+		return nil, fmt.Errorf("authority: cannot write to external signer: %v", err)
+	}
+
+	resp := &Response{}
+	line, err := bufio.NewReader(rw).ReadBytes('\n')
+	if err == nil {
+		err = json.Unmarshal(line, resp)
+	}
+	if waitErr := done(); err == nil && waitErr != nil {
+		err = waitErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("authority: bad response from external signer: %v", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("authority: external signer: %s", resp.Error)
+	}
+	return resp, nil
+}
+
+// Serve answers signer protocol requests read from r with the provided
+// signer, writing responses to w, until r is exhausted. It can be used to
+// build external signer processes and socket servers.
+func Serve(r io.Reader, w io.Writer, s crypto.Signer) error {
+	scanner := bufio.NewScanner(r)
+	enc := json.NewEncoder(w)
+	for scanner.Scan() {
+		req := &Request{}
+		if err := json.Unmarshal(scanner.Bytes(), req); err != nil {
+			return err
+		}
+		if err := enc.Encode(handle(req, s)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func handle(req *Request, s crypto.Signer) *Response {
+	switch req.Op {
+	case "public":
+		der, err := x509.MarshalPKIXPublicKey(s.Public())
+		if err != nil {
+			return &Response{Error: err.Error()}
+		}
+		return &Response{PublicKey: der}
+	case "sign":
+		hash, ok := hashes[req.Hash]
+		if !ok {
+			return &Response{Error: fmt.Sprintf("unsupported hash %q", req.Hash)}
+		}
+		var opts crypto.SignerOpts = hash
+		if req.PSS {
+			opts = &rsa.PSSOptions{Hash: hash, SaltLength: rsa.PSSSaltLengthEqualsHash}
+		}
+		sig, err := s.Sign(rand.Reader, req.Digest, opts)
+		if err != nil {
+			return &Response{Error: err.Error()}
+		}
+		return &Response{Signature: sig}
+	default:
+		return &Response{Error: fmt.Sprintf("unsupported op %q", req.Op)}
+	}
+}
+
+var hashes = map[string]crypto.Hash{
+	crypto.SHA1.String():   crypto.SHA1,
+	crypto.SHA256.String(): crypto.SHA256,
+	crypto.SHA384.String(): crypto.SHA384,
+	crypto.SHA512.String(): crypto.SHA512,
+}
@@ -0,0 +1,106 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testKey *rsa.PrivateKey
+
+func init() {
+	var err error
+	if testKey, err = rsa.GenerateKey(rand.Reader, 1024); err != nil {
+		panic(err)
+	}
+}
+
+// TestHelperSigner is run as the external signer process by
+// TestExternalCommand, serving the key PEM encoded in its environment.
+func TestHelperSigner(t *testing.T) {
+	keyPEM := os.Getenv("AUTHORITY_HELPER_SIGNER_KEY")
+	if keyPEM == "" {
+		return
+	}
+	block, _ := pem.Decode([]byte(keyPEM))
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		os.Exit(1)
+	}
+	if err := Serve(os.Stdin, os.Stdout, key); err != nil {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestExternalCommand(t *testing.T) {
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(testKey),
+	})
+	os.Setenv("AUTHORITY_HELPER_SIGNER_KEY", string(keyPEM))
+	defer os.Unsetenv("AUTHORITY_HELPER_SIGNER_KEY")
+
+	e := &External{Command: []string{os.Args[0], "-test.run=TestHelperSigner"}}
+	if err := e.Open(); err != nil {
+		t.Fatalf("error opening external signer: %v", err)
+	}
+	testSign(t, e)
+}
+
+func testSign(t *testing.T, s crypto.Signer) {
+	if s.Public().(*rsa.PublicKey).N.Cmp(testKey.N) != 0 {
+		t.Fatal("got unexpected public key")
+	}
+
+	digest := sha256.Sum256([]byte("authority"))
+	sig, err := s.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("error signing: %v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(&testKey.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Fatalf("bad signature: %v", err)
+	}
+}
+
+func TestExternalSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authority")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "signer.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				Serve(conn, conn, testKey)
+			}()
+		}
+	}()
+
+	e := &External{Socket: socket}
+	if err := e.Open(); err != nil {
+		t.Fatalf("error opening external signer: %v", err)
+	}
+	testSign(t, e)
+}
@@ -0,0 +1,160 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// digestInfoPrefixes are the DER encoded DigestInfo headers which PKCS #1
+// v1.5 signatures prepend to the digest, as required by the RSA-PKCS
+// mechanism.
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// pinEnv is the environment variable the PIN is passed to pkcs11-tool in,
+// so that it does not appear on the command line, where other local users
+// could read it.
+const pinEnv = "AUTHORITY_PKCS11_TOOL_PIN"
+
+// PKCS11 is a crypto.Signer for an RSA or ECDSA key held in a PKCS#11 token,
+// such as an HSM or SoftHSM. It drives the token through OpenSC's
+// pkcs11-tool, which must be OpenSC 0.17 or later to read the PIN from the
+// environment, so that no cgo PKCS#11 binding is required.
+type PKCS11 struct {
+	Module     string
+	TokenLabel string
+	KeyID      string
+	KeyLabel   string
+	Pin        string
+
+	// Tool is the pkcs11-tool executable, found on $PATH by default.
+	Tool string
+
+	public crypto.PublicKey
+}
+
+// Open reads the key's public key from the token.
+func (p *PKCS11) Open() error {
+	dir, err := ioutil.TempDir("", "authority-pkcs11")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "public.der")
+	if err := p.run("--read-object", "--type", "pubkey", "--output-file", out); err != nil {
+		return err
+	}
+
+	der, err := ioutil.ReadFile(out)
+	if err != nil {
+		return err
+	}
+	if p.public, err = x509.ParsePKIXPublicKey(der); err != nil {
+		if p.public, err = x509.ParsePKCS1PublicKey(der); err != nil {
+			return fmt.Errorf("authority: cannot parse pkcs11 public key: %v", err)
+		}
+	}
+	return nil
+}
+
+func (p *PKCS11) Public() crypto.PublicKey {
+	return p.public
+}
+
+func (p *PKCS11) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var mechanism []string
+	input := digest
+
+	switch p.public.(type) {
+	case *rsa.PublicKey:
+		if _, pss := opts.(*rsa.PSSOptions); pss {
+			return nil, fmt.Errorf("authority: pkcs11 signer does not support RSA-PSS")
+		}
+		prefix, ok := digestInfoPrefixes[opts.HashFunc()]
+		if !ok {
+			return nil, fmt.Errorf("authority: unsupported pkcs11 hash %v", opts.HashFunc())
+		}
+		input = append(append([]byte{}, prefix...), digest...)
+		mechanism = []string{"--mechanism", "RSA-PKCS"}
+	case *ecdsa.PublicKey:
+		mechanism = []string{"--mechanism", "ECDSA", "--signature-format", "openssl"}
+	default:
+		return nil, fmt.Errorf("authority: unsupported pkcs11 key type %T", p.public)
+	}
+
+	dir, err := ioutil.TempDir("", "authority-pkcs11")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "digest")
+	out := filepath.Join(dir, "signature")
+	if err := ioutil.WriteFile(in, input, 0600); err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"--sign", "--input-file", in, "--output-file", out}, mechanism...)
+	if err := p.run(args...); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(out)
+}
+
+func (p *PKCS11) run(args ...string) error {
+	tool := p.Tool
+	if tool == "" {
+		tool = "pkcs11-tool"
+	}
+
+	base := []string{"--module", p.Module}
+	if p.TokenLabel != "" {
+		base = append(base, "--token-label", p.TokenLabel)
+	}
+	if p.KeyID != "" {
+		base = append(base, "--id", p.KeyID)
+	}
+	if p.KeyLabel != "" {
+		base = append(base, "--label", p.KeyLabel)
+	}
+	if p.Pin != "" {
+		base = append(base, "--login", "--pin", "env:"+pinEnv)
+	}
+
+	cmd := exec.Command(tool, append(base, args...)...)
+	cmd.Env = p.env()
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("authority: pkcs11-tool failed: %v: %s", err, output)
+	}
+	return nil
+}
+
+// env returns the environment for pkcs11-tool: this process's environment
+// without any earlier value of pinEnv, and with the PIN in pinEnv.
+func (p *PKCS11) env() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, pinEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	if p.Pin != "" {
+		env = append(env, pinEnv+"="+p.Pin)
+	}
+	return env
+}
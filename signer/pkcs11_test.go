@@ -0,0 +1,103 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var softHSMModules = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+}
+
+// TestPKCS11SoftHSM signs with a key generated in a fresh SoftHSM token. It
+// is skipped unless SoftHSM and OpenSC's pkcs11-tool are installed.
+func TestPKCS11SoftHSM(t *testing.T) {
+	var module string
+	for _, m := range softHSMModules {
+		if _, err := os.Stat(m); err == nil {
+			module = m
+		}
+	}
+	if _, err := exec.LookPath("pkcs11-tool"); err != nil || module == "" {
+		t.Skip("softhsm and pkcs11-tool are required")
+	}
+
+	dir, err := ioutil.TempDir("", "authority")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := filepath.Join(dir, "softhsm2.conf")
+	tokens := filepath.Join(dir, "tokens")
+	os.Mkdir(tokens, 0700)
+	ioutil.WriteFile(conf, []byte("directories.tokendir = "+tokens+"\n"), 0600)
+	os.Setenv("SOFTHSM2_CONF", conf)
+	defer os.Unsetenv("SOFTHSM2_CONF")
+
+	run := func(name string, args ...string) {
+		if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+			t.Fatalf("%s failed: %v: %s", name, err, out)
+		}
+	}
+	run("softhsm2-util", "--init-token", "--free", "--label", "authority", "--pin", "1234", "--so-pin", "1234")
+	run("pkcs11-tool", "--module", module, "--token-label", "authority", "--login", "--pin", "1234",
+		"--keypairgen", "--key-type", "rsa:2048", "--id", "01", "--label", "ca")
+
+	p := &PKCS11{Module: module, TokenLabel: "authority", KeyID: "01", Pin: "1234"}
+	if err := p.Open(); err != nil {
+		t.Fatalf("error opening pkcs11 signer: %v", err)
+	}
+
+	digest := sha256.Sum256([]byte("authority"))
+	sig, err := p.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("error signing: %v", err)
+	}
+	if err := rsa.VerifyPKCS1v15(p.Public().(*rsa.PublicKey), crypto.SHA256, digest[:], sig); err != nil {
+		t.Fatalf("bad signature: %v", err)
+	}
+}
+
+// TestPKCS11Pin checks that the PIN is passed in the environment rather than
+// on the command line, using a stand-in for pkcs11-tool.
+func TestPKCS11Pin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authority")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out")
+	tool := filepath.Join(dir, "pkcs11-tool")
+	script := "#!/bin/sh\necho \"$@\" > " + out + "\necho \"$" + pinEnv + "\" >> " + out + "\n"
+	if err := ioutil.WriteFile(tool, []byte(script), 0700); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	p := &PKCS11{Module: "module.so", KeyID: "01", Pin: "secret-pin", Tool: tool}
+	if err := p.run("--list-objects"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || strings.Contains(lines[0], "secret-pin") || !strings.Contains(lines[0], "--pin env:"+pinEnv) {
+		t.Fatalf("expected the PIN to be left off the command line, got %q", lines)
+	}
+	if lines[1] != "secret-pin" {
+		t.Fatalf("expected the PIN in the environment, got %q", lines[1])
+	}
+}
@@ -0,0 +1,42 @@
+package signer
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+
+	"github.com/ovrclk/authority/config"
+)
+
+// New returns a crypto.Signer for the provided signer configuration.
+func New(cfg *config.SignerConfig) (crypto.Signer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("authority: %v", err)
+	}
+
+	switch cfg.Type {
+	case "pkcs11":
+		p := &PKCS11{
+			Module:     cfg.Module,
+			TokenLabel: cfg.TokenLabel,
+			KeyID:      cfg.KeyID,
+			KeyLabel:   cfg.KeyLabel,
+		}
+		if cfg.PinEnv != "" {
+			p.Pin = os.Getenv(cfg.PinEnv)
+		}
+		if err := p.Open(); err != nil {
+			return nil, err
+		}
+		return p, nil
+	default:
+		e := &External{
+			Command: cfg.Command,
+			Socket:  cfg.Socket,
+		}
+		if err := e.Open(); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+}
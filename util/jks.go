@@ -0,0 +1,152 @@
+package util
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	jksMagic   = 0xfeedfeed
+	jksVersion = 2
+
+	jksPrivateKeyEntry  = 1
+	jksTrustedCertEntry = 2
+)
+
+// oidJavaKeyProtector identifies the key protection algorithm of Sun's JKS
+// keystore.
+var oidJavaKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+
+// EncodeJKS returns a Java keystore holding key and cert, followed by the
+// certificates in chain, as a private key entry under the provided alias.
+// The key and the keystore are both protected by password.
+func EncodeJKS(key *rsa.PrivateKey, cert *x509.Certificate, chain []*x509.Certificate, alias, password string) ([]byte, error) {
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("authority: unable to encode private key %v", err)
+	}
+	protected, err := jksProtectKey(pkcs8, password)
+	if err != nil {
+		return nil, err
+	}
+
+	w := newJKSWriter(1)
+	w.int32(jksPrivateKeyEntry)
+	w.utf(strings.ToLower(alias))
+	w.timestamp()
+	w.bytes(protected)
+	w.int32(int32(1 + len(chain)))
+	for _, c := range append([]*x509.Certificate{cert}, chain...) {
+		w.certificate(c)
+	}
+	return w.finish(password), nil
+}
+
+// EncodeJKSTrustStore returns a Java keystore holding the provided
+// certificates as trusted entries under their aliases, protected by
+// password.
+func EncodeJKSTrustStore(certs map[string]*x509.Certificate, password string) ([]byte, error) {
+	w := newJKSWriter(len(certs))
+	for _, alias := range sortedAliases(certs) {
+		w.int32(jksTrustedCertEntry)
+		w.utf(strings.ToLower(alias))
+		w.timestamp()
+		w.certificate(certs[alias])
+	}
+	return w.finish(password), nil
+}
+
+// jksProtectKey encrypts a PKCS#8 encoded key as Sun's KeyProtector does,
+// by XORing it with a SHA-1 based keystream, and wraps it in an
+// EncryptedPrivateKeyInfo.
+func jksProtectKey(pkcs8 []byte, password string) ([]byte, error) {
+	passwordBytes := utf16BE(password)
+	salt := make([]byte, sha1.Size)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	encrypted := make([]byte, len(pkcs8))
+	digest := salt
+	for i := 0; i < len(pkcs8); i += sha1.Size {
+		h := sha1.New()
+		h.Write(passwordBytes)
+		h.Write(digest)
+		digest = h.Sum(nil)
+		for j := 0; j < sha1.Size && i+j < len(pkcs8); j++ {
+			encrypted[i+j] = pkcs8[i+j] ^ digest[j]
+		}
+	}
+
+	h := sha1.New()
+	h.Write(passwordBytes)
+	h.Write(pkcs8)
+	data := append(append(salt, encrypted...), h.Sum(nil)...)
+
+	der, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidJavaKeyProtector, Parameters: asn1.NullRawValue},
+		EncryptedData: data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("authority: unable to encode private key %v", err)
+	}
+	return der, nil
+}
+
+type jksWriter struct {
+	buf bytes.Buffer
+	now int64
+}
+
+func newJKSWriter(entries int) *jksWriter {
+	w := &jksWriter{now: time.Now().UnixNano() / int64(time.Millisecond)}
+	binary.Write(&w.buf, binary.BigEndian, uint32(jksMagic))
+	w.int32(jksVersion)
+	w.int32(int32(entries))
+	return w
+}
+
+func (w *jksWriter) int32(n int32) {
+	binary.Write(&w.buf, binary.BigEndian, n)
+}
+
+// utf writes s as Java's DataOutput.writeUTF does, prefixed by its length.
+// Aliases are expected to be plain text, for which this matches UTF-8.
+func (w *jksWriter) utf(s string) {
+	binary.Write(&w.buf, binary.BigEndian, uint16(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *jksWriter) timestamp() {
+	binary.Write(&w.buf, binary.BigEndian, w.now)
+}
+
+func (w *jksWriter) bytes(b []byte) {
+	w.int32(int32(len(b)))
+	w.buf.Write(b)
+}
+
+func (w *jksWriter) certificate(cert *x509.Certificate) {
+	w.utf("X.509")
+	w.bytes(cert.Raw)
+}
+
+// finish appends the keystore's integrity digest, computed over the password,
+// a fixed string chosen by Sun, and the keystore contents.
+func (w *jksWriter) finish(password string) []byte {
+	h := sha1.New()
+	h.Write(utf16BE(password))
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(w.buf.Bytes())
+	w.buf.Write(h.Sum(nil))
+	return w.buf.Bytes()
+}
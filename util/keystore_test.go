@@ -0,0 +1,204 @@
+package util
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testCertAndKey(t *testing.T) (*x509.Certificate, []byte) {
+	cert, err := GetCertificateFromPEM(certString)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	key, err := GetKeyFromPEM(keyString)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return cert, pkcs8
+}
+
+func TestPKCS12KDF(t *testing.T) {
+	salt, _ := hex.DecodeString("0a58cf64530d823f")
+	key := pkcs12KDF(bmpPassword("smeg"), salt, 1, 1, 24)
+	if hex.EncodeToString(key) != "8aaae6297b6cb04642ab5b077851284eb7128f1a2a7fbca3" {
+		t.Fatalf("unexpected derived key %x", key)
+	}
+}
+
+func TestEncodePKCS12(t *testing.T) {
+	cert, pkcs8 := testCertAndKey(t)
+	key, _ := GetKeyFromPEM(keyString)
+	der, err := EncodePKCS12(key, cert, []*x509.Certificate{cert}, "web", "changeit")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var pfx struct {
+		Version  int
+		AuthSafe struct {
+			ContentType asn1.ObjectIdentifier
+			Content     asn1.RawValue `asn1:"tag:0,explicit"`
+		}
+		MacData macData
+	}
+	if rest, err := asn1.Unmarshal(der, &pfx); err != nil || len(rest) != 0 {
+		t.Fatalf("error decoding PKCS#12 file: %v", err)
+	}
+	var authSafe []byte
+	if _, err := asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	macKey := pkcs12KDF(bmpPassword("changeit"), pfx.MacData.MacSalt, 3, pfx.MacData.Iterations, sha1.Size)
+	mac := hmac.New(sha1.New, macKey)
+	mac.Write(authSafe)
+	if !hmac.Equal(mac.Sum(nil), pfx.MacData.Mac.Digest) {
+		t.Fatal("expected the MAC to verify with the password")
+	}
+	if !bytes.Contains(authSafe, cert.Raw) {
+		t.Fatal("expected the certificate in the PKCS#12 file")
+	}
+
+	var contents []contentInfo
+	if _, err := asn1.Unmarshal(authSafe, &contents); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var keyBags int
+	for _, content := range contents {
+		var data []byte
+		var bags []safeBag
+		if _, err := asn1.Unmarshal(content.Content.Bytes, &data); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if _, err := asn1.Unmarshal(data, &bags); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		for _, bag := range bags {
+			if !bag.ID.Equal(oidPKCS8ShroudedKeyBag) {
+				continue
+			}
+			keyBags++
+			if !bytes.Equal(decryptPKCS8(t, bag.Value.Bytes, []byte("changeit")), pkcs8) {
+				t.Fatal("expected the key bag to hold the key")
+			}
+		}
+	}
+	if keyBags != 1 {
+		t.Fatalf("expected one key bag, got %d", keyBags)
+	}
+}
+
+// TestPKCS12Interop reads a PKCS#12 file with openssl and keytool, where
+// they are installed.
+func TestPKCS12Interop(t *testing.T) {
+	cert, _ := testCertAndKey(t)
+	key, _ := GetKeyFromPEM(keyString)
+	der, err := EncodePKCS12(key, cert, nil, "web", "changeit")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "authority")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "web.p12")
+	if err := ioutil.WriteFile(path, der, 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	commands := map[string][]string{
+		"openssl": {"pkcs12", "-in", path, "-passin", "pass:changeit", "-nodes"},
+		"keytool": {"-list", "-keystore", path, "-storetype", "PKCS12", "-storepass", "changeit"},
+	}
+	for name, args := range commands {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Logf("%s not found, skipping", name)
+			continue
+		}
+		out, err := exec.Command(name, args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s cannot read the PKCS#12 file: %v\n%s", name, err, out)
+		}
+		if name == "openssl" && !strings.Contains(string(out), "PRIVATE KEY") {
+			t.Fatalf("expected openssl to decrypt the key, got\n%s", out)
+		}
+		if name == "keytool" && !strings.Contains(string(out), "PrivateKeyEntry") {
+			t.Fatalf("expected keytool to list the key entry, got\n%s", out)
+		}
+	}
+}
+
+func TestEncodeJKS(t *testing.T) {
+	cert, pkcs8 := testCertAndKey(t)
+	key, _ := GetKeyFromPEM(keyString)
+	data, err := EncodeJKS(key, cert, nil, "Web", "changeit")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if binary.BigEndian.Uint32(data) != jksMagic || binary.BigEndian.Uint32(data[8:]) != 1 {
+		t.Fatal("unexpected JKS header")
+	}
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	h := sha1.New()
+	h.Write(utf16BE("changeit"))
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(body)
+	if !bytes.Equal(h.Sum(nil), digest) {
+		t.Fatal("expected the keystore digest to verify with the password")
+	}
+
+	// entry tag, lowercased alias, timestamp, then the protected key
+	r := bytes.NewReader(body[12:])
+	var tag int32
+	var aliasLen uint16
+	binary.Read(r, binary.BigEndian, &tag)
+	binary.Read(r, binary.BigEndian, &aliasLen)
+	alias := make([]byte, aliasLen)
+	r.Read(alias)
+	if tag != jksPrivateKeyEntry || string(alias) != "web" {
+		t.Fatalf("unexpected entry %d %q", tag, alias)
+	}
+	var timestamp int64
+	var keyLen int32
+	binary.Read(r, binary.BigEndian, &timestamp)
+	binary.Read(r, binary.BigEndian, &keyLen)
+	protected := make([]byte, keyLen)
+	r.Read(protected)
+
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(protected, &info); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	salt, encrypted := info.EncryptedData[:sha1.Size], info.EncryptedData[sha1.Size:len(info.EncryptedData)-sha1.Size]
+	plain := make([]byte, len(encrypted))
+	stream := salt
+	for i := 0; i < len(encrypted); i += sha1.Size {
+		h := sha1.New()
+		h.Write(utf16BE("changeit"))
+		h.Write(stream)
+		stream = h.Sum(nil)
+		for j := 0; j < sha1.Size && i+j < len(encrypted); j++ {
+			plain[i+j] = encrypted[i+j] ^ stream[j]
+		}
+	}
+	if !bytes.Equal(plain, pkcs8) {
+		t.Fatal("expected the private key to decrypt with the password")
+	}
+}
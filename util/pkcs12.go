@@ -0,0 +1,319 @@
+package util
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"sort"
+	"unicode/utf16"
+)
+
+// pkcs12MacIterations is the key derivation iteration count of the
+// integrity MAC, as keytool uses. The key is encrypted with pkcs8Iterations.
+const pkcs12MacIterations = 10000
+
+var (
+	oidDataContentType     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS8ShroudedKeyBag = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidCertTypeX509        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidSHA1                = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidFriendlyName        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+
+	// Java only loads certificates without a key from a PKCS#12 file as
+	// trusted entries if they carry this attribute.
+	oidJavaTrustedKeyUsage = asn1.ObjectIdentifier{2, 16, 840, 1, 113894, 746875, 1, 1}
+	oidAnyExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
+)
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  macData
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type macData struct {
+	Mac        digestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data asn1.RawValue
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// EncodePKCS12 returns a PKCS#12 file holding key and cert under the
+// provided alias, followed by the certificates in chain, protected by
+// password. The key is encrypted with PBES2 and AES-256, as openssl 3 and
+// keytool since Java 8u301 do by default, and the file is integrity
+// protected with an HMAC-SHA1, which every PKCS#12 reader supports.
+func EncodePKCS12(key *rsa.PrivateKey, cert *x509.Certificate, chain []*x509.Certificate, alias, password string) ([]byte, error) {
+	keyID := sha1.Sum(cert.Raw)
+	attributes, err := pkcs12Attributes(alias, keyID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	certBags := []safeBag{}
+	bag, err := newCertBag(cert, attributes)
+	if err != nil {
+		return nil, err
+	}
+	certBags = append(certBags, bag)
+	for _, c := range chain {
+		if bag, err = newCertBag(c, nil); err != nil {
+			return nil, err
+		}
+		certBags = append(certBags, bag)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("authority: unable to encode private key %v", err)
+	}
+	keyBag, err := newShroudedKeyBag(pkcs8, password, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodePFX([][]safeBag{certBags, []safeBag{keyBag}}, password)
+}
+
+// EncodePKCS12TrustStore returns a PKCS#12 file holding the provided
+// certificates as trusted entries under their aliases, protected by
+// password.
+func EncodePKCS12TrustStore(certs map[string]*x509.Certificate, password string) ([]byte, error) {
+	trusted, err := asn1.Marshal(oidAnyExtendedKeyUsage)
+	if err != nil {
+		return nil, err
+	}
+
+	bags := []safeBag{}
+	for _, alias := range sortedAliases(certs) {
+		name, err := asn1.Marshal(bmpString(alias))
+		if err != nil {
+			return nil, err
+		}
+		bag, err := newCertBag(certs[alias], []pkcs12Attribute{
+			{ID: oidFriendlyName, Value: asn1Set(name)},
+			{ID: oidJavaTrustedKeyUsage, Value: asn1Set(trusted)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		bags = append(bags, bag)
+	}
+	return encodePFX([][]safeBag{bags}, password)
+}
+
+func encodePFX(safeContents [][]safeBag, password string) ([]byte, error) {
+	var authSafe []contentInfo
+	for _, bags := range safeContents {
+		data, err := asn1.Marshal(bags)
+		if err != nil {
+			return nil, err
+		}
+		info, err := dataContentInfo(data)
+		if err != nil {
+			return nil, err
+		}
+		authSafe = append(authSafe, info)
+	}
+	authSafeBytes, err := asn1.Marshal(authSafe)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	macKey := pkcs12KDF(bmpPassword(password), salt, 3, pkcs12MacIterations, sha1.Size)
+	mac := hmac.New(sha1.New, macKey)
+	mac.Write(authSafeBytes)
+
+	info, err := dataContentInfo(authSafeBytes)
+	if err != nil {
+		return nil, err
+	}
+	pfx := pfxPdu{
+		Version:  3,
+		AuthSafe: info,
+		MacData: macData{
+			Mac: digestInfo{
+				Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+				Digest:    mac.Sum(nil),
+			},
+			MacSalt:    salt,
+			Iterations: pkcs12MacIterations,
+		},
+	}
+	der, err := asn1.Marshal(pfx)
+	if err != nil {
+		return nil, fmt.Errorf("authority: unable to encode PKCS#12 file %v", err)
+	}
+	return der, nil
+}
+
+func newCertBag(cert *x509.Certificate, attributes []pkcs12Attribute) (safeBag, error) {
+	data, err := asn1.Marshal(cert.Raw)
+	if err != nil {
+		return safeBag{}, err
+	}
+	value, err := asn1.Marshal(certBag{ID: oidCertTypeX509, Data: explicit(data)})
+	if err != nil {
+		return safeBag{}, err
+	}
+	return safeBag{ID: oidCertBag, Value: explicit(value), Attributes: attributes}, nil
+}
+
+// newShroudedKeyBag encrypts the key with PBES2, which unlike the PKCS#12
+// key derivation takes the password as its UTF-8 bytes.
+func newShroudedKeyBag(pkcs8 []byte, password string, attributes []pkcs12Attribute) (safeBag, error) {
+	value, err := encryptPKCS8(pkcs8, []byte(password))
+	if err != nil {
+		return safeBag{}, err
+	}
+	return safeBag{ID: oidPKCS8ShroudedKeyBag, Value: explicit(value), Attributes: attributes}, nil
+}
+
+func pkcs12Attributes(alias string, keyID []byte) ([]pkcs12Attribute, error) {
+	name, err := asn1.Marshal(bmpString(alias))
+	if err != nil {
+		return nil, err
+	}
+	id, err := asn1.Marshal(keyID)
+	if err != nil {
+		return nil, err
+	}
+	return []pkcs12Attribute{
+		{ID: oidFriendlyName, Value: asn1Set(name)},
+		{ID: oidLocalKeyID, Value: asn1Set(id)},
+	}, nil
+}
+
+// pkcs12KDF derives size bytes of key material for the provided purpose id
+// (1 for keys, 2 for IVs and 3 for MAC keys) with SHA-1, as specified in RFC
+// 7292 appendix B.2.
+func pkcs12KDF(password, salt []byte, id byte, iterations, size int) []byte {
+	const u, v = sha1.Size, 64
+
+	d := bytes.Repeat([]byte{id}, v)
+	i := append(fillBlocks(salt, v), fillBlocks(password, v)...)
+
+	var out []byte
+	for len(out) < size {
+		h := sha1.New()
+		h.Write(d)
+		h.Write(i)
+		a := h.Sum(nil)
+		for n := 1; n < iterations; n++ {
+			sum := sha1.Sum(a)
+			a = sum[:]
+		}
+		out = append(out, a...)
+
+		if len(out) < size {
+			b := fillBlocks(a, v)
+			for j := 0; j < len(i); j += v {
+				carry := 1
+				for k := v - 1; k >= 0; k-- {
+					sum := int(i[j+k]) + int(b[k]) + carry
+					i[j+k] = byte(sum)
+					carry = sum >> 8
+				}
+			}
+		}
+	}
+	return out[:size]
+}
+
+// fillBlocks repeats b to fill a whole number of v byte blocks.
+func fillBlocks(b []byte, v int) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	out := make([]byte, v*((len(b)+v-1)/v))
+	for i := range out {
+		out[i] = b[i%len(b)]
+	}
+	return out
+}
+
+// bmpPassword encodes a password as a null terminated BMPString, as PKCS#12
+// key derivation expects.
+func bmpPassword(password string) []byte {
+	return append(utf16BE(password), 0, 0)
+}
+
+func bmpString(s string) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: 30, Bytes: utf16BE(s)}
+}
+
+func utf16BE(s string) []byte {
+	var out []byte
+	for _, r := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(r>>8), byte(r))
+	}
+	return out
+}
+
+func dataContentInfo(data []byte) (contentInfo, error) {
+	octets, err := asn1.Marshal(data)
+	if err != nil {
+		return contentInfo{}, err
+	}
+	return contentInfo{ContentType: oidDataContentType, Content: explicit(octets)}, nil
+}
+
+// explicit wraps DER encoded content in an explicit [0] tag.
+func explicit(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+func asn1Set(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: der}
+}
+
+func sortedAliases(certs map[string]*x509.Certificate) []string {
+	var aliases []string
+	for alias := range certs {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
@@ -1,13 +1,21 @@
 package util
 
 import (
+	"crypto"
 	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 func GetCertificateFromPath(path string) (*x509.Certificate, error) {
@@ -24,6 +32,9 @@ func GetCertificateFromPEM(data string) (*x509.Certificate, error) {
 
 func GetCertificateFromPEMBytes(bytes []byte) (*x509.Certificate, error) {
 	pem, _ := pem.Decode(bytes)
+	if pem == nil {
+		return nil, fmt.Errorf("authority: no PEM encoded certificate found")
+	}
 	cert, err := x509.ParseCertificate(pem.Bytes)
 	if err != nil {
 		return nil, fmt.Errorf("authority: unable to parse certificate %v", err)
@@ -43,8 +54,24 @@ func GetKeyFromPEM(data string) (*rsa.PrivateKey, error) {
 	return GetKeyFromPEMBytes([]byte(data))
 }
 
+// GetKeyFromPEMBytes parses a PEM encoded RSA private key, in PKCS #1 or
+// PKCS #8 form.
 func GetKeyFromPEMBytes(bytes []byte) (*rsa.PrivateKey, error) {
 	pem, _ := pem.Decode(bytes)
+	if pem == nil {
+		return nil, fmt.Errorf("authority: no PEM encoded private key found")
+	}
+	if pem.Type == "PRIVATE KEY" {
+		parsed, err := x509.ParsePKCS8PrivateKey(pem.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("authority: unable to parse private key %v", err)
+		}
+		key, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("authority: private key is %T, only RSA keys can be stored", parsed)
+		}
+		return key, nil
+	}
 	key, err := x509.ParsePKCS1PrivateKey(pem.Bytes)
 	if err != nil {
 		return nil, fmt.Errorf("authority: unable to parse private key %v", err)
@@ -52,6 +79,38 @@ func GetKeyFromPEMBytes(bytes []byte) (*rsa.PrivateKey, error) {
 	return key, nil
 }
 
+func GetPublicKeyFromPath(path string) (crypto.PublicKey, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("authority: unable to read file %v", err)
+	}
+	return GetPublicKeyFromPEMBytes(bytes)
+}
+
+// GetPublicKeyFromPEMBytes parses a PEM encoded public key, either a
+// PKIX "PUBLIC KEY" holding an RSA, ECDSA or Ed25519 key, as written by
+// openssl pkey -pubout, or a PKCS #1 "RSA PUBLIC KEY".
+func GetPublicKeyFromPEMBytes(bytes []byte) (crypto.PublicKey, error) {
+	pem, _ := pem.Decode(bytes)
+	if pem == nil {
+		return nil, fmt.Errorf("authority: no PEM encoded public key found")
+	}
+	var key crypto.PublicKey
+	var err error
+	switch pem.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(pem.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(pem.Bytes)
+	default:
+		return nil, fmt.Errorf("authority: expected a public key, found %s", pem.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("authority: unable to parse public key %v", err)
+	}
+	return key, nil
+}
+
 func GetPEMFromCertificate(cert *x509.Certificate) string {
 	return string(GetPEMBytesFromCertificate(cert))
 }
@@ -64,6 +123,30 @@ func GetPEMBytesFromCertificate(cert *x509.Certificate) []byte {
 	return bytes
 }
 
+func GetCertificateRequestFromPath(path string) (*x509.CertificateRequest, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("authority: unable to read file %v", err)
+	}
+	pem, _ := pem.Decode(bytes)
+	if pem == nil {
+		return nil, fmt.Errorf("authority: no PEM data found in %s", path)
+	}
+	csr, err := x509.ParseCertificateRequest(pem.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("authority: unable to parse certificate request %v", err)
+	}
+	return csr, nil
+}
+
+func GetPEMFromCertificateRequest(csr *x509.CertificateRequest) string {
+	bytes := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE REQUEST",
+		Bytes: csr.Raw,
+	})
+	return string(bytes)
+}
+
 func GetPEMFromKey(key *rsa.PrivateKey) string {
 	return string(GetPEMBytesFromKey(key))
 }
@@ -76,6 +159,22 @@ func GetPEMBytesFromKey(key *rsa.PrivateKey) []byte {
 	return bytes
 }
 
+// GetEncryptedPEMBytesFromKey returns the PEM encoding of key as an
+// encrypted PKCS#8 private key, protected by the provided passphrase with
+// PBKDF2 and AES-256. The legacy encrypted "RSA PRIVATE KEY" format is not
+// used, as it derives the key from the passphrase with a single MD5 hash.
+func GetEncryptedPEMBytesFromKey(key *rsa.PrivateKey, passphrase []byte) ([]byte, error) {
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("authority: unable to encrypt private key %v", err)
+	}
+	der, err := encryptPKCS8(pkcs8, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("authority: unable to encrypt private key %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}), nil
+}
+
 func GetPEMFromCRL(c *pkix.CertificateList) string {
 	if c == nil {
 		return ""
@@ -87,6 +186,112 @@ func GetPEMFromCRL(c *pkix.CertificateList) string {
 	return string(bytes)
 }
 
+// SHA1Fingerprint returns the SHA-1 digest of cert as colon separated hex,
+// as openssl prints it.
+func SHA1Fingerprint(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	return colonHex(sum[:])
+}
+
+// SHA256Fingerprint returns the SHA-256 digest of cert as colon separated
+// hex, as openssl prints it.
+func SHA256Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return colonHex(sum[:])
+}
+
+// SPKIPin returns the base64 SHA-256 digest of cert's public key info, as
+// used for public key pinning.
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func colonHex(b []byte) string {
+	parts := make([]string, len(b))
+	for i, c := range b {
+		parts[i] = fmt.Sprintf("%02X", c)
+	}
+	return strings.Join(parts, ":")
+}
+
 func Base64String(s string) string {
 	return base64.StdEncoding.EncodeToString([]byte(s))
 }
+
+// ParseOID parses a dotted decimal object identifier such as "2.5.4.9".
+func ParseOID(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("authority: invalid object identifier %q", s)
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("authority: invalid object identifier %q", s)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
+
+// ParseRDN parses a relative distinguished name attribute in the form
+// "OID=value", such as "2.5.4.9=1 Main Street".
+func ParseRDN(s string) (pkix.AttributeTypeAndValue, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		return pkix.AttributeTypeAndValue{}, fmt.Errorf("authority: invalid subject attribute %q, expected OID=value", s)
+	}
+	oid, err := ParseOID(parts[0])
+	if err != nil {
+		return pkix.AttributeTypeAndValue{}, err
+	}
+	return pkix.AttributeTypeAndValue{
+		Type:  oid,
+		Value: strings.TrimSpace(parts[1]),
+	}, nil
+}
+
+// WriteFileAtomic writes data to the file at path with the provided mode and
+// owner, where a uid or gid of -1 leaves it unchanged. The data is written to
+// a temporary file in the same directory, which is then renamed over path,
+// so that readers never see a partly written file or one with the wrong
+// owner.
+func WriteFileAtomic(path string, data []byte, mode os.FileMode, uid, gid int) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := ioutil.TempFile(dir, "."+name+".tmp")
+	if err != nil {
+		return fmt.Errorf("authority: unable to write %s: %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("authority: unable to write %s: %v", path, err)
+	}
+	if uid != -1 || gid != -1 {
+		if err := tmp.Chown(uid, gid); err != nil {
+			tmp.Close()
+			return fmt.Errorf("authority: unable to change owner of %s: %v", path, err)
+		}
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("authority: unable to write %s: %v", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("authority: unable to write %s: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("authority: unable to write %s: %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("authority: unable to write %s: %v", path, err)
+	}
+	return nil
+}
@@ -1,6 +1,14 @@
 package util
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/asn1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -106,3 +114,92 @@ func TestParseKeyBytes(t *testing.T) {
 		t.Fatalf("parsed unexpected key")
 	}
 }
+
+func TestParseRDN(t *testing.T) {
+	rdn, err := ParseRDN("2.5.4.9=1 Main Street")
+	if err != nil {
+		t.Fatalf("got error parsing rdn: %v", err)
+	}
+	if rdn.Type.String() != "2.5.4.9" || rdn.Value != "1 Main Street" {
+		t.Fatalf("parsed unexpected rdn: %v", rdn)
+	}
+
+	for _, bad := range []string{"street=foo", "2.5.4.9", "2.5.4.9=", "2=foo", "2.x.4=foo"} {
+		if _, err := ParseRDN(bad); err == nil {
+			t.Fatalf("expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	key := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64)
+	if hex.EncodeToString(key) != "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783" {
+		t.Fatalf("unexpected derived key %x", key)
+	}
+}
+
+func TestEncryptPKCS8(t *testing.T) {
+	_, pkcs8 := testCertAndKey(t)
+	der, err := encryptPKCS8(pkcs8, []byte("secret"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(decryptPKCS8(t, der, []byte("secret")), pkcs8) {
+		t.Fatal("expected the key to decrypt with the passphrase")
+	}
+}
+
+// decryptPKCS8 decrypts an EncryptedPrivateKeyInfo written by encryptPKCS8.
+func decryptPKCS8(t *testing.T, der, passphrase []byte) []byte {
+	var info encryptedPrivateKeyInfo
+	var params pbes2Params
+	var kdf pbkdf2Params
+	var iv []byte
+	if _, err := asn1.Unmarshal(der, &info); err != nil || !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		t.Fatalf("expected a PBES2 encrypted key: %v", err)
+	}
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	block, err := aes.NewCipher(pbkdf2SHA256(passphrase, kdf.Salt, kdf.IterationCount, 32))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	decrypted := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, info.EncryptedData)
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		t.Fatal("expected the key to decrypt with the passphrase")
+	}
+	return decrypted[:len(decrypted)-padding]
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authority")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "web.key")
+	if err := WriteFileAtomic(path, []byte("key"), 0600, os.Getuid(), os.Getgid()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, got %o", info.Mode().Perm())
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatal("expected the temporary file to be renamed")
+	}
+}